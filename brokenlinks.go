@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// brokenLink is a crawled URL whose request failed, with the pages that link to it.
+type brokenLink struct {
+	URL       string   `json:"url"`
+	Status    int      `json:"status,omitempty"` // 0 for network errors
+	Error     string   `json:"error"`
+	Referrers []string `json:"referrers"`
+}
+
+// brokenLinks lists the URLs whose final request failed, sorted by URL. A
+// URL that succeeded on a retry is not broken. resolve maps link targets
+// to the URL they were fetched as, following redirects.
+func brokenLinks(m *crawlManifest, g *linkGraph, resolve func(string) string) []brokenLink {
+	failed := m.failures()
+
+	referrers := make(map[string]map[string]bool)
+	g.mu.Lock()
+	for from, targets := range g.edges {
+		for to := range targets {
+			// A redirect that fails is recorded under the URL linked to
+			if failed[to].URL == "" {
+				to = resolve(to)
+			}
+			if failed[to].URL != "" {
+				if referrers[to] == nil {
+					referrers[to] = make(map[string]bool)
+				}
+				referrers[to][from] = true
+			}
+		}
+	}
+	g.mu.Unlock()
+
+	var broken []brokenLink
+	for u, e := range failed {
+		link := brokenLink{URL: u, Status: e.Status, Error: e.Error, Referrers: []string{}}
+		for from := range referrers[u] {
+			link.Referrers = append(link.Referrers, from)
+		}
+		sort.Strings(link.Referrers)
+		broken = append(broken, link)
+	}
+	sort.Slice(broken, func(i, j int) bool { return broken[i].URL < broken[j].URL })
+	return broken
+}
+
+// printBrokenLinks logs the broken links and their referrers.
+func printBrokenLinks(logger *log.Logger, broken []brokenLink) {
+	logger.Printf("\nBroken links: %d\n", len(broken))
+	for _, link := range broken {
+		reason := link.Error
+		if link.Status != 0 {
+			reason = fmt.Sprintf("%d %s", link.Status, link.Error)
+		}
+		logger.Printf("  %s (%s)\n", link.URL, reason)
+		for _, from := range link.Referrers {
+			logger.Printf("    linked from %s\n", from)
+		}
+	}
+}
+
+// writeBrokenLinks saves the broken links as JSON to the given file.
+func writeBrokenLinks(path string, broken []brokenLink) error {
+	if broken == nil {
+		broken = []brokenLink{}
+	}
+	data, err := json.MarshalIndent(broken, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
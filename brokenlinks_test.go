@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReportBrokenLinks(t *testing.T) {
+	site := map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/missing">Missing</a>`),
+		"/a": htmlPage("Page A", `<p>Page A.</p><a href="/missing">Missing</a> <a href="/moved">Moved</a> <a href="/fails">Fails</a>`),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/gone", http.StatusFound)
+		case "/fails":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			body, ok := site[r.URL.Path]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(body))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	report := filepath.Join(t.TempDir(), "broken.json")
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxDepth = 3
+	opts.BrokenLinks = report
+	_, out, err := crawlLogged(opts)
+	if err == nil {
+		t.Error("crawl with broken links reported no error")
+	}
+
+	data, err := os.ReadFile(report)
+	if err != nil {
+		t.Fatalf("no report written: %v\n%s", err, out)
+	}
+	var broken []brokenLink
+	if err := json.Unmarshal(data, &broken); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, data)
+	}
+	want := []brokenLink{
+		{URL: srv.URL + "/fails", Status: 500, Referrers: []string{srv.URL + "/a"}},
+		{URL: srv.URL + "/missing", Status: 404, Referrers: []string{srv.URL + "/", srv.URL + "/a"}},
+		// A redirect to a missing page is reported as the link that was followed
+		{URL: srv.URL + "/moved", Status: 404, Referrers: []string{srv.URL + "/a"}},
+	}
+	if len(broken) != len(want) {
+		t.Fatalf("report lists %+v, want %d broken links", broken, len(want))
+	}
+	for i, link := range broken {
+		if link.URL != want[i].URL || link.Status != want[i].Status || !slices.Equal(link.Referrers, want[i].Referrers) || link.Error == "" {
+			t.Errorf("broken link %d is %+v, want %+v with an error", i, link, want[i])
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pageState is the record of a page kept between runs.
+type pageState struct {
+	Title string `json:"title"`
+	Hash  string `json:"hash"`
+}
+
+// crawlState is the saved result of a crawl, keyed by page URL.
+type crawlState struct {
+	Pages map[string]pageState `json:"pages"`
+}
+
+// changeReport lists page URLs by how they changed since the previous run.
+type changeReport struct {
+	New       []string
+	Modified  []string
+	Removed   []string
+	Unchanged []string
+}
+
+// contentHash returns a hex SHA-256 digest of the page's extracted content.
+// Whitespace in the title and text is normalized first, so reformatting the
+// markup alone does not change the digest; code is hashed as extracted.
+func contentHash(p Page) string {
+	var paragraphs []string
+	for _, para := range strings.Split(p.Content, "\n\n") {
+		if para = strings.Join(strings.Fields(para), " "); para != "" {
+			paragraphs = append(paragraphs, para)
+		}
+	}
+	h := sha256.New()
+	h.Write([]byte(strings.Join(strings.Fields(p.Title), " ") + "\x00" + strings.Join(paragraphs, "\n\n")))
+	for _, code := range p.Code {
+		h.Write([]byte("\x00" + code))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func newCrawlState(pages []Page) *crawlState {
+	state := &crawlState{Pages: make(map[string]pageState, len(pages))}
+	for _, p := range pages {
+		state.Pages[p.URL] = pageState{Title: p.Title, Hash: contentHash(p)}
+	}
+	return state
+}
+
+// loadCrawlState reads a state file. A missing file yields an empty state.
+func loadCrawlState(path string) (*crawlState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &crawlState{Pages: map[string]pageState{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	state := &crawlState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	if state.Pages == nil {
+		state.Pages = map[string]pageState{}
+	}
+	return state, nil
+}
+
+func (s *crawlState) save(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+// diffCrawlStates compares the current crawl against a previous one.
+func diffCrawlStates(prev, cur *crawlState) changeReport {
+	var report changeReport
+	for u, page := range cur.Pages {
+		old, ok := prev.Pages[u]
+		switch {
+		case !ok:
+			report.New = append(report.New, u)
+		case old.Hash != page.Hash:
+			report.Modified = append(report.Modified, u)
+		default:
+			report.Unchanged = append(report.Unchanged, u)
+		}
+	}
+	for u := range prev.Pages {
+		if _, ok := cur.Pages[u]; !ok {
+			report.Removed = append(report.Removed, u)
+		}
+	}
+	sort.Strings(report.New)
+	sort.Strings(report.Modified)
+	sort.Strings(report.Removed)
+	sort.Strings(report.Unchanged)
+	return report
+}
+
+// Print writes the change summary to stdout.
+func (r changeReport) Print() {
+	fmt.Printf("\nChanges since last run: %d new, %d modified, %d removed, %d unchanged\n",
+		len(r.New), len(r.Modified), len(r.Removed), len(r.Unchanged))
+	for _, group := range []struct {
+		label string
+		urls  []string
+	}{{"New", r.New}, {"Modified", r.Modified}, {"Removed", r.Removed}} {
+		if len(group.urls) > 0 {
+			fmt.Printf("  %s:\n    %s\n", group.label, strings.Join(group.urls, "\n    "))
+		}
+	}
+}
+
+// renderChanges adds a "What Changed" page listing new, modified and removed
+// pages. Pages still in the document link to their chapters.
+func renderChanges(pdf *gofpdf.Fpdf, fonts pdfFonts, report changeReport, prev *crawlState, pages []Page, links *pdfLinks) {
+	pdf.AddPage()
+	pdf.SetFont(fonts.Heading, "B", 24)
+	pdf.Cell(0, 10, "What Changed")
+	pdf.Ln(20)
+
+	titles := make(map[string]string, len(pages))
+	for _, p := range pages {
+		titles[p.URL] = p.Title
+	}
+
+	for _, group := range []struct {
+		label string
+		urls  []string
+	}{{"New", report.New}, {"Modified", report.Modified}, {"Removed", report.Removed}} {
+		pdf.SetFont(fonts.Body, "B", 12)
+		pdf.Cell(0, 10, fmt.Sprintf("%s (%d)", group.label, len(group.urls)))
+		pdf.Ln(10)
+
+		pdf.SetFont(fonts.Body, "", 10)
+		for _, u := range group.urls {
+			pdf.SetX(20)
+			if linkID, dest, ok := links.lookup(pages, u); ok {
+				links.cell(pdf, 0, 8, titles[u], "", linkID, dest)
+			} else {
+				pdf.Cell(0, 8, prev.Pages[u].Title+" ("+u+")")
+			}
+			pdf.Ln(8)
+		}
+		pdf.Ln(5)
+	}
+}
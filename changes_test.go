@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestChangesBetweenCrawls(t *testing.T) {
+	site := map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a>`),
+		"/a": htmlPage("A", `<p>Version one.</p>`),
+		"/b": htmlPage("B", `<p>Stays the same.</p>`),
+	}
+	srv := testSite(t, site)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	crawlState := func() *crawlState {
+		t.Helper()
+		pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return newCrawlState(pages)
+	}
+
+	if err := crawlState().save(statePath); err != nil {
+		t.Fatal(err)
+	}
+	site["/a"] = htmlPage("A", `<p>Version two.</p>`)
+	prev, err := loadCrawlState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes := diffCrawlStates(prev, crawlState())
+
+	rel := func(urls []string) string { return strings.ReplaceAll(strings.Join(urls, " "), srv.URL, "") }
+	if got := rel(changes.Modified); got != "/a" {
+		t.Errorf("modified pages %s, want /a", got)
+	}
+	if got := rel(changes.Unchanged); got != "/ /b" {
+		t.Errorf("unchanged pages %s, want / /b", got)
+	}
+	if len(changes.New) != 0 || len(changes.Removed) != 0 {
+		t.Errorf("new pages %v and removed pages %v, want none", changes.New, changes.Removed)
+	}
+}
+
+func TestChecksums(t *testing.T) {
+	same := `<h1>Guide</h1><p>Install it.</p><pre>make install</pre>`
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start.</p><a href="/a">A</a> <a href="/b">B</a> <a href="/c">C</a> <a href="/d">D</a>`),
+		"/a": `<html><head><title>One</title></head><body><article>` + same + `</article></body></html>`,
+		// The same content in different markup, whitespace and page chrome
+		"/b": "<html><head><title>Two</title><meta name=\"author\" content=\"Someone\"></head><body><nav>Menu</nav>\n<article>\n  <h1>Guide</h1>\n  <p>Install   it.</p>\n\n  <pre>make install</pre>\n</article><footer>Footer</footer></body></html>",
+		"/c": `<html><head><title>One</title></head><body><article><h1>Guide</h1><p>Install it now.</p><pre>make install</pre></article></body></html>`,
+		"/d": `<html><head><title>One</title></head><body><article><h1>Guide</h1><p>Install it.</p><pre>make all</pre></article></body></html>`,
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "pages.json", "-manifest", "manifest.json")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	var pages []Page
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "pages.json")), &pages); err != nil {
+		t.Fatal(err)
+	}
+	sums := make(map[string]string)
+	for _, p := range pages {
+		if len(p.Checksum) != 64 {
+			t.Errorf("%s has checksum %q, want a hex SHA-256", p.URL, p.Checksum)
+		}
+		sums[p.URL] = p.Checksum
+	}
+	if len(sums) != 5 {
+		t.Fatalf("pages.json holds %d pages, want 5", len(sums))
+	}
+	if sums[srv.URL+"/a"] != sums[srv.URL+"/b"] {
+		t.Errorf("identical content has checksums %s and %s", sums[srv.URL+"/a"], sums[srv.URL+"/b"])
+	}
+	for _, path := range []string{"/c", "/d"} {
+		if sums[srv.URL+path] == sums[srv.URL+"/a"] {
+			t.Errorf("%s has different content but the same checksum as /a", path)
+		}
+	}
+
+	// The manifest lists the same checksums
+	var manifest Manifest
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "manifest.json")), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range manifest.Pages {
+		if p.Checksum != sums[p.URL] {
+			t.Errorf("manifest checksum of %s is %q, want %q as in pages.json", p.URL, p.Checksum, sums[p.URL])
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfChunk is one of the temporary PDFs a chunked document is rendered as.
+type pdfChunk struct {
+	Path  string
+	Pages int
+	// Links records the chunk's links, outline and link destinations, by
+	// chunk page number
+	Links *pdfLinks
+}
+
+// writeChunkedPDF renders the document opts.ChunkSize chapters at a time,
+// each batch into its own temporary PDF with only the images it uses, and
+// joins the batches into path. gofpdf keeps a whole document in memory
+// until it is written, so this holds one batch at a time however many
+// pages there are. The table of contents and the "What Changed" section
+// get batches of their own.
+func writeChunkedPDF(pages []Page, path string, opts pdfOptions) error {
+	dir, err := os.MkdirTemp("", "pdf-scraper-chunks-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	// Every batch carries the keywords of the whole document
+	if opts.Keywords == "" {
+		opts.Keywords = strings.Join(topKeywords(pages, 10), ", ")
+	}
+
+	var chunks []pdfChunk
+	var slugDests []namedDest
+	pageCount := 0
+	save := func(pdf *gofpdf.Fpdf, links *pdfLinks) error {
+		chunkPath := filepath.Join(dir, fmt.Sprintf("chunk-%04d.pdf", len(chunks)+1))
+		n := pdf.PageNo()
+		if err := pdf.OutputFileAndClose(chunkPath); err != nil {
+			return err
+		}
+		chunks = append(chunks, pdfChunk{Path: chunkPath, Pages: n, Links: links})
+		pageCount += n
+		return nil
+	}
+
+	if opts.TOCPosition == "start" || opts.Changes != nil {
+		pdf, fonts, err := newPDF(pages, opts)
+		if err != nil {
+			return err
+		}
+		links := newChunkLinks(pdf, pages, 0, 0)
+		if opts.TOCPosition == "start" {
+			renderTOC(pdf, fonts, pages, links, opts, nil, nil)
+		}
+		if opts.Changes != nil {
+			renderChanges(pdf, fonts, *opts.Changes, opts.PrevState, pages, links)
+		}
+		if err := save(pdf, links); err != nil {
+			return err
+		}
+	}
+
+	// Slugs shared by several pages go to the first heading with it, as
+	// in a document rendered in one go
+	slugTaken := make(map[string]bool)
+	chapterPages := make([]int, len(pages))
+	headingPages := make([][]int, len(pages))
+	for first := 0; first < len(pages); first += opts.ChunkSize {
+		last := min(first+opts.ChunkSize, len(pages))
+		chunkOpts := opts
+		if chunkOpts.Images == nil {
+			chunkOpts.Images = prefetchImages(opts.ImageClient, pages[first:last], opts.ImageWorkers)
+		}
+
+		pdf, fonts, err := newPDF(pages, chunkOpts)
+		if err != nil {
+			return err
+		}
+		links := newChunkLinks(pdf, pages, first, last)
+		chunkPages, chunkHeadingPages, chunkSlugDests, err := renderChapters(pdf, fonts, pages, links, chunkOpts)
+		if err != nil {
+			return err
+		}
+		for i := first; i < last; i++ {
+			chapterPages[i] = pageCount + chunkPages[i]
+			headingPages[i] = make([]int, len(chunkHeadingPages[i]))
+			for j, p := range chunkHeadingPages[i] {
+				headingPages[i][j] = pageCount + p
+			}
+		}
+		for _, d := range chunkSlugDests {
+			if !slugTaken[d.Name] {
+				slugTaken[d.Name] = true
+				d.Page += pageCount
+				slugDests = append(slugDests, d)
+			}
+		}
+		if err := save(pdf, links); err != nil {
+			return err
+		}
+	}
+
+	if opts.TOCPosition == "end" {
+		pdf, fonts, err := newPDF(pages, opts)
+		if err != nil {
+			return err
+		}
+		links := newChunkLinks(pdf, pages, 0, 0)
+		renderTOC(pdf, fonts, pages, links, opts, chapterPages, headingPages)
+		if err := save(pdf, links); err != nil {
+			return err
+		}
+	}
+
+	// With nothing to render the document is a single blank page, as gofpdf makes it
+	if len(chunks) == 0 {
+		pdf, _, err := newPDF(pages, opts)
+		if err != nil {
+			return err
+		}
+		if err := save(pdf, newChunkLinks(pdf, pages, 0, 0)); err != nil {
+			return err
+		}
+	}
+
+	if !opts.NamedDests {
+		slugDests = nil
+	}
+	return joinPDFChunks(chunks, path, newPDFInfo(pages, opts), slugDests)
+}
+
+// newChunkLinks returns the links of a chunk covering the chapters from
+// first up to last. The chunk only records its links: drawing them would
+// make gofpdi read every one back when the chunk is joined.
+func newChunkLinks(pdf *gofpdf.Fpdf, pages []Page, first, last int) *pdfLinks {
+	links := newPDFLinks(pdf, pages, first, last)
+	links.recordOnly = true
+	return links
+}
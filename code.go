@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// wrapCode soft-wraps each line of a code block at cols characters.
+// Continuation lines keep the original line's indentation, followed by
+// marker, so wrapped code stays readable. Lines are broken at the last
+// space before the limit when possible and hard-broken otherwise.
+func wrapCode(code string, cols int, marker string) string {
+	if cols <= 0 {
+		return code
+	}
+
+	var out strings.Builder
+	for i, line := range strings.Split(code, "\n") {
+		if i > 0 {
+			out.WriteString("\n")
+		}
+		runes := []rune(line)
+		if len(runes) <= cols {
+			out.WriteString(line)
+			continue
+		}
+
+		indent := []rune(line[:len(line)-len(strings.TrimLeftFunc(line, unicode.IsSpace))])
+		prefix := string(indent) + marker
+		if len([]rune(prefix)) >= cols/2 {
+			// Deep indentation would leave no room for code
+			prefix = marker
+		}
+		prefixLen := len([]rune(prefix))
+
+		width := cols
+		for len(runes) > width {
+			cut := width
+			for j := width; j > len(indent) && j > width/2; j-- {
+				if runes[j] == ' ' {
+					cut = j
+					break
+				}
+			}
+			out.WriteString(strings.TrimRight(string(runes[:cut]), " "))
+			out.WriteString("\n" + prefix)
+			runes = []rune(strings.TrimLeft(string(runes[cut:]), " "))
+			width = cols - prefixLen
+		}
+		out.WriteString(string(runes))
+	}
+	return out.String()
+}
+
+// cleanCode tidies a code block read from a <pre>. With trim, blank lines
+// at the start and end and trailing whitespace on each line are removed;
+// indentation and blank lines inside the block are kept. A positive
+// tabWidth expands tabs to spaces at tab stops of that width.
+func cleanCode(code string, tabWidth int, trim bool) string {
+	lines := strings.Split(strings.ReplaceAll(code, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		if tabWidth > 0 {
+			line = expandTabs(line, tabWidth)
+		}
+		if trim {
+			line = strings.TrimRightFunc(line, unicode.IsSpace)
+		}
+		lines[i] = line
+	}
+	if trim {
+		for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+			lines = lines[1:]
+		}
+		for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+			lines = lines[:len(lines)-1]
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// expandTabs replaces each tab in line with spaces up to the next tab stop.
+func expandTabs(line string, tabWidth int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var out strings.Builder
+	col := 0
+	for _, r := range line {
+		if r == '\t' {
+			n := tabWidth - col%tabWidth
+			out.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		out.WriteRune(r)
+		col++
+	}
+	return out.String()
+}
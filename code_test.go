@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// longCodeLine returns an indented 200-character line of code.
+func longCodeLine() string {
+	var args []string
+	for i := 0; i < 27; i++ {
+		args = append(args, fmt.Sprintf("arg%02d", i))
+	}
+	return "    call(" + strings.Join(args, ", ") + ", x)"
+}
+
+func TestWrapCode(t *testing.T) {
+	line := longCodeLine()
+	if len(line) != 200 {
+		t.Fatalf("test line has %d characters, want 200", len(line))
+	}
+	wrapped := wrapCode(line, 80, "↪ ")
+	lines := strings.Split(wrapped, "\n")
+	if len(lines) < 3 {
+		t.Fatalf("wrapCode gave %d lines, want at least 3:\n%s", len(lines), wrapped)
+	}
+	var rejoined []string
+	for i, l := range lines {
+		if n := len([]rune(l)); n > 80 {
+			t.Errorf("line %d has %d characters, want at most 80: %q", i, n, l)
+		}
+		if i > 0 {
+			if !strings.HasPrefix(l, "    ↪ ") {
+				t.Errorf("continuation line %d lacks the indentation and marker: %q", i, l)
+			}
+			l = strings.TrimPrefix(l, "    ↪ ")
+		}
+		rejoined = append(rejoined, l)
+	}
+	if got := strings.Join(rejoined, " "); strings.ReplaceAll(got, " ", "") != strings.ReplaceAll(line, " ", "") {
+		t.Errorf("wrapping lost text:\n got %q\nwant %q", got, line)
+	}
+	if got := wrapCode(line, 0, ""); got != line {
+		t.Errorf("wrapCode with no column limit changed the line to %q", got)
+	}
+}
+
+func TestLongCodeLineWrapsInPDF(t *testing.T) {
+	line := longCodeLine()
+	pages := []Page{{
+		Title:   "Code",
+		URL:     "https://example.com/code",
+		Code:    []string{"func f() {\n" + line + "\n}"},
+		Content: "Before the code.\n\n[Code Block 1]\n\nAfter the code.",
+	}}
+	for _, cols := range []int{0, 60} {
+		opts := testPDFOptions()
+		opts.CodeWrapCols = cols
+		pdf := renderPDF(t, pages, opts)
+
+		var code []string
+		for _, page := range pdf.Pages {
+			for _, run := range page {
+				if run.Font == "Courier" && strings.TrimSpace(run.Text) != "" {
+					code = append(code, run.Text)
+				}
+			}
+		}
+		// func f() {, the long line over several lines, and }
+		if len(code) < 4 {
+			t.Fatalf("-code-wrap-cols %d: code shown as %q, want the long line wrapped", cols, code)
+		}
+		for _, l := range code[2 : len(code)-1] {
+			if !strings.HasPrefix(l, "    ") {
+				t.Errorf("-code-wrap-cols %d: continuation line %q lost the indentation", cols, l)
+			}
+		}
+		got := strings.Join(code, "")
+		if strings.ReplaceAll(got, " ", "") != strings.ReplaceAll("func f() {"+line+"}", " ", "") {
+			t.Errorf("-code-wrap-cols %d: code truncated:\n got %q\nwant %q", cols, got, line)
+		}
+	}
+
+	// At the default width a line with nowhere to break fills the code cell
+	// exactly, without gofpdf breaking it again
+	unbroken := "    " + strings.Repeat("x", 196)
+	pdf := renderPDF(t, []Page{{Title: "Code", URL: "https://example.com/code", Code: []string{unbroken}, Content: "[Code Block 1]"}}, testPDFOptions())
+	for _, page := range pdf.Pages {
+		for _, run := range page {
+			if run.Font == "Courier" && !strings.HasPrefix(run.Text, "    x") {
+				t.Errorf("unbroken code shown with a line %q, want each line indented", run.Text)
+			}
+		}
+	}
+}
+
+func TestCodeCaption(t *testing.T) {
+	page := scrapeOne(t, `<h1>Tutorial</h1><p>Create the file.</p>
+		<div class="filename">main.go</div>
+		<pre><code>package main</code></pre>
+		<p>Then run it.</p>
+		<pre><code>go run .</code></pre>`, nil)
+	if len(page.Code) != 2 {
+		t.Fatalf("extracted %d code blocks, want 2", len(page.Code))
+	}
+	if got := page.codeCaption(0); got != "main.go" {
+		t.Errorf("first block captioned %q, want main.go", got)
+	}
+	if got := page.codeCaption(1); got != "" {
+		t.Errorf("unlabelled block captioned %q", got)
+	}
+
+	// In the PDF the caption is the line drawn just above the code
+	pdf := renderPDF(t, []Page{page}, testPDFOptions())
+	runs := pdf.Pages[pdf.find("package main")]
+	for i, run := range runs {
+		if run.Text != "package main" {
+			continue
+		}
+		if i == 0 || runs[i-1].Text != "main.go" {
+			t.Errorf("PDF code block not headed by its filename:\n%s", pdf.AllText())
+		} else if runs[i-1].Y <= run.Y {
+			t.Errorf("PDF caption drawn at y=%.1f, not above the code at y=%.1f", runs[i-1].Y, run.Y)
+		}
+	}
+	if strings.Count(pdf.AllText(), "main.go") != 1 {
+		t.Errorf("PDF shows the caption other than once:\n%s", pdf.AllText())
+	}
+
+	path := filepath.Join(t.TempDir(), "out.md")
+	if err := writeMarkdown([]Page{page}, path, markdownOptions{TOCTitle: "Contents", TOCPosition: "start"}); err != nil {
+		t.Fatal(err)
+	}
+	md, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(md), "**main.go**\n\n```\npackage main\n```") {
+		t.Errorf("Markdown code block not headed by its filename:\n%s", md)
+	}
+	if !strings.Contains(string(md), "Then run it.\n\n```\ngo run .\n```") {
+		t.Errorf("Markdown unlabelled block has a caption:\n%s", md)
+	}
+}
+
+func TestCleanCode(t *testing.T) {
+	html := "<h1>Code</h1><pre>\n\n  \nfunc main() {\n\tif ok {  \n\t\treturn\n\t}\n\n\tdone()\n}\n\n   \n</pre>"
+	want := "func main() {\n    if ok {\n        return\n    }\n\n    done()\n}"
+	if got := scrapeOne(t, html, nil).Code; len(got) != 1 || got[0] != want {
+		t.Errorf("code block extracted as %q, want %q", got, want)
+	}
+
+	// Without trimming the block is left as written; HTML drops the newline
+	// straight after <pre>
+	got := scrapeOne(t, html, func(opts *CrawlOptions) {
+		opts.Extract.TrimCode = false
+		opts.Extract.CodeTabWidth = 0
+	}).Code
+	if len(got) != 1 || !strings.HasPrefix(got[0], "\n  \nfunc main() {\n\tif ok {  \n") {
+		t.Errorf("-flatten-whitespace-in-code=false extracted %q, want the block untouched", got)
+	}
+
+	for _, tc := range []struct {
+		code     string
+		tabWidth int
+		want     string
+	}{
+		{"a\tb", 4, "a   b"},
+		{"ab\tc", 2, "ab  c"},
+		{"\tx", 8, "        x"},
+		{"\tx", 0, "\tx"},
+		{"x \r\ny\t", 4, "x\ny"},
+	} {
+		if got := cleanCode(tc.code, tc.tabWidth, true); got != tc.want {
+			t.Errorf("cleanCode(%q, %d) = %q, want %q", tc.code, tc.tabWidth, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/gocolly/colly/v2"
+)
+
+// nextLinkText matches the text of "next page" style pagination anchors.
+var nextLinkText = regexp.MustCompile(`(?i)^\W*(next|older)\b`)
+
+// visitedSet records the URLs whose content has been extracted, keyed by
+// the final URL after redirects, along with the redirects seen so far. It
+// is safe for concurrent use by colly's callbacks.
+type visitedSet struct {
+	mu        sync.Mutex
+	urls      map[string]bool
+	redirects map[string]string // original URL -> final URL
+}
+
+func newVisitedSet() *visitedSet {
+	return &visitedSet{urls: make(map[string]bool), redirects: make(map[string]string)}
+}
+
+// redirect records that from redirects to to. Every URL earlier in a chain
+// is pointed at the newest target, so lookups resolve to the final URL.
+func (v *visitedSet) redirect(from, to string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for original, target := range v.redirects {
+		if target == from {
+			v.redirects[original] = to
+		}
+	}
+	v.redirects[from] = to
+}
+
+// claim marks a URL as visited, reporting false if it already was.
+func (v *visitedSet) claim(u string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.urls[u] {
+		return false
+	}
+	v.urls[u] = true
+	return true
+}
+
+// has reports whether u, or the URL it is known to redirect to, has been visited.
+func (v *visitedSet) has(u string) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if target, ok := v.redirects[u]; ok {
+		u = target
+	}
+	return v.urls[u]
+}
+
+// resolve returns the URL that u is known to redirect to, or u itself.
+func (v *visitedSet) resolve(u string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if target, ok := v.redirects[u]; ok {
+		return target
+	}
+	return u
+}
+
+// list returns the visited URLs in sorted order.
+func (v *visitedSet) list() []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	urls := make([]string, 0, len(v.urls))
+	for u := range v.urls {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// linkGraph records which pages link to which, keyed by URL without its
+// fragment. It is safe for concurrent use.
+type linkGraph struct {
+	mu    sync.Mutex
+	edges map[string]map[string]bool
+}
+
+func newLinkGraph() *linkGraph {
+	return &linkGraph{edges: make(map[string]map[string]bool)}
+}
+
+func (g *linkGraph) add(from, to string) {
+	from, to = stripFragment(from), stripFragment(to)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]bool)
+	}
+	g.edges[from][to] = true
+}
+
+// list returns each page's link targets, sorted.
+func (g *linkGraph) list() map[string][]string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	edges := make(map[string][]string, len(g.edges))
+	for from, targets := range g.edges {
+		for to := range targets {
+			edges[from] = append(edges[from], to)
+		}
+		sort.Strings(edges[from])
+	}
+	return edges
+}
+
+// reachable returns the URLs on a link path from seed, seed included.
+// resolve maps a link target to the URL its page was recorded under, such
+// as the end of a redirect.
+func (g *linkGraph) reachable(seed string, resolve func(string) string) map[string]bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	seed = resolve(stripFragment(seed))
+	seen := map[string]bool{seed: true}
+	queue := []string{seed}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for to := range g.edges[u] {
+			if to = resolve(to); !seen[to] {
+				seen[to] = true
+				queue = append(queue, to)
+			}
+		}
+	}
+	return seen
+}
+
+// indexPages are the directory index file names dropped by normalizeURL.
+var indexPages = []string{"index.html", "index.htm", "index.php"}
+
+// normalizeURL maps the spellings of a page's URL onto one: the host is
+// lower-cased, the fragment and a trailing index file such as index.html
+// are dropped, and trailing slashes follow the policy: "add" gives paths
+// without a file extension one, "strip" removes them except from the root,
+// and "keep" leaves them as they are.
+func normalizeURL(link, trailingSlash string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	for _, index := range indexPages {
+		if dir, ok := strings.CutSuffix(u.Path, "/"+index); ok {
+			u.Path = dir + "/"
+			break
+		}
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	switch trailingSlash {
+	case "add":
+		if !strings.HasSuffix(u.Path, "/") && path.Ext(u.Path) == "" {
+			u.Path += "/"
+		}
+	case "strip":
+		if u.Path != "/" {
+			u.Path = strings.TrimRight(u.Path, "/")
+		}
+	}
+	u.RawPath = ""
+	return u.String()
+}
+
+// stripFragment removes the #fragment from a URL.
+func stripFragment(link string) string {
+	if i := strings.IndexByte(link, '#'); i >= 0 {
+		return link[:i]
+	}
+	return link
+}
+
+// queryGuard bounds how many query-string variants of the same path are
+// crawled, so search pages and forums don't generate endless URLs. It is
+// safe for concurrent use.
+type queryGuard struct {
+	mu       sync.Mutex
+	max      int
+	variants map[string]map[string]bool // path URL -> queries seen
+	reported map[string]bool            // paths that have hit the limit
+}
+
+func newQueryGuard(max int) *queryGuard {
+	return &queryGuard{max: max, variants: make(map[string]map[string]bool), reported: make(map[string]bool)}
+}
+
+// allow reports whether link may be followed, recording its query. Links
+// without a query, and queries already seen, are always allowed. The
+// second result is true the first time a path hits the limit.
+func (g *queryGuard) allow(link string) (ok, limitReached bool) {
+	u, err := url.Parse(link)
+	if err != nil || u.RawQuery == "" {
+		return true, false
+	}
+	query := u.Query().Encode()
+	u.RawQuery, u.Fragment = "", ""
+	path := u.String()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	seen := g.variants[path]
+	if seen == nil {
+		seen = make(map[string]bool)
+		g.variants[path] = seen
+	}
+	if seen[query] {
+		return true, false
+	}
+	if len(seen) >= g.max {
+		first := !g.reported[path]
+		g.reported[path] = true
+		return false, first
+	}
+	seen[query] = true
+	return true, false
+}
+
+// sectionDepth overrides the crawl depth for URLs whose path starts with Prefix.
+type sectionDepth struct {
+	Prefix string
+	Depth  int
+}
+
+// parseSectionDepths parses "pathprefix=N" rules, e.g. "/api/=5".
+func parseSectionDepths(rules []string) ([]sectionDepth, error) {
+	var sections []sectionDepth
+	for _, rule := range rules {
+		prefix, value, ok := strings.Cut(rule, "=")
+		depth, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || !strings.HasPrefix(prefix, "/") || err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid -section-depth %q: expected /pathprefix=N", rule)
+		}
+		sections = append(sections, sectionDepth{Prefix: prefix, Depth: depth})
+	}
+	return sections, nil
+}
+
+// depthLimit returns the maximum depth for link, taken from the section
+// with the longest matching prefix, or fallback when none matches. 0 means
+// no limit, as with colly.MaxDepth.
+func depthLimit(sections []sectionDepth, link string, fallback int) int {
+	u, err := url.Parse(link)
+	if err != nil {
+		return fallback
+	}
+	limit, longest := fallback, -1
+	for _, section := range sections {
+		if strings.HasPrefix(u.Path, section.Prefix) && len(section.Prefix) > longest {
+			limit, longest = section.Depth, len(section.Prefix)
+		}
+	}
+	return limit
+}
+
+// defaultLinkSources are the places links are read from besides <a href>.
+const defaultLinkSources = `area[href]@href,link[rel~="prev"]@href,link[rel~="up"]@href,[data-href]@data-href`
+
+// linkSource matches elements holding a crawlable URL in an attribute.
+type linkSource struct {
+	Selector string
+	Attr     string
+}
+
+// parseLinkSources parses a comma-separated list of "selector@attribute"
+// pairs, e.g. "area[href]@href".
+func parseLinkSources(spec string) ([]linkSource, error) {
+	var sources []linkSource
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		i := strings.LastIndex(entry, "@")
+		if i <= 0 || i == len(entry)-1 {
+			return nil, fmt.Errorf("invalid link source %q: expected selector@attribute", entry)
+		}
+		if _, err := cascadia.Compile(entry[:i]); err != nil {
+			return nil, fmt.Errorf("invalid link source %q: %w", entry, err)
+		}
+		sources = append(sources, linkSource{Selector: entry[:i], Attr: entry[i+1:]})
+	}
+	return sources, nil
+}
+
+// pageLink is a link found on a page, with the rel of its first occurrence.
+type pageLink struct {
+	URL string
+	Rel string
+}
+
+// pageLinks returns the distinct links of the <a href>s in container and
+// of sources anywhere on page, in document order and after normalize. It
+// stops early once ctx is done, reporting that it was interrupted.
+func pageLinks(ctx context.Context, page, container *colly.HTMLElement, sources []linkSource, normalize func(string) string) (found []pageLink, interrupted bool) {
+	seen := make(map[string]bool)
+	collect := func(el *colly.HTMLElement, attr string) bool {
+		link := normalize(el.Request.AbsoluteURL(el.Attr(attr)))
+		if link != "" && !seen[link] {
+			seen[link] = true
+			found = append(found, pageLink{URL: link, Rel: el.Attr("rel")})
+		}
+		interrupted = ctx.Err() != nil
+		return !interrupted
+	}
+	container.ForEachWithBreak("a[href]", func(_ int, el *colly.HTMLElement) bool {
+		return collect(el, "href")
+	})
+	// Image maps, <link> navigation and the like may sit anywhere on the page
+	for _, source := range sources {
+		if interrupted {
+			break
+		}
+		page.ForEachWithBreak(source.Selector, func(_ int, el *colly.HTMLElement) bool {
+			return collect(el, source.Attr)
+		})
+	}
+	return found, interrupted
+}
+
+// followsRel reports whether a link with the given rel attribute may be
+// crawled. rel="external" and rel="download" links are never followed, and
+// rel="nofollow" ones only when followNofollow is set.
+func followsRel(rel string, followNofollow bool) bool {
+	for _, token := range strings.Fields(strings.ToLower(rel)) {
+		switch token {
+		case "external", "download":
+			return false
+		case "nofollow":
+			if !followNofollow {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isCrawlable reports whether an absolute URL is an HTTP(S) link on one of
+// the crawled domains.
+func isCrawlable(link string, domains []string) bool {
+	if link == "" {
+		return false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+	for _, domain := range domains {
+		if strings.EqualFold(u.Hostname(), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseExcludes compiles the -exclude patterns.
+func parseExcludes(patterns []string) ([]*regexp.Regexp, error) {
+	var excludes []*regexp.Regexp
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -exclude pattern %q: %w", pattern, err)
+		}
+		excludes = append(excludes, re)
+	}
+	return excludes, nil
+}
+
+// isExcluded reports whether link matches any of the excludes.
+func isExcluded(excludes []*regexp.Regexp, link string) bool {
+	for _, re := range excludes {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// paginationLinks returns a page's "next page" links, with their hrefs as
+// written, taken from <link rel="next">, anchors with rel="next", anchors
+// whose text reads like "Next" and "load more" endpoints held in any of
+// attrs, such as data-next="/more?page=2".
+func paginationLinks(page *colly.HTMLElement, attrs []string) []pageLink {
+	var links []pageLink
+	seen := make(map[string]bool)
+	add := func(el *colly.HTMLElement, href string) {
+		if href != "" && !seen[href] {
+			seen[href] = true
+			links = append(links, pageLink{URL: href, Rel: el.Attr("rel")})
+		}
+	}
+
+	page.ForEach("link[rel~=next], a[rel~=next]", func(_ int, el *colly.HTMLElement) {
+		add(el, el.Attr("href"))
+	})
+	page.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
+		if nextLinkText.MatchString(strings.TrimSpace(el.Text)) {
+			add(el, el.Attr("href"))
+		}
+	})
+	for _, attr := range attrs {
+		page.ForEach("["+attr+"]", func(_ int, el *colly.HTMLElement) {
+			add(el, strings.TrimSpace(el.Attr(attr)))
+		})
+	}
+	return links
+}
+
+// dateLayouts are the date formats accepted in metadata and on the command line.
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02"}
+
+// parseDate parses a date in one of dateLayouts or as an HTTP date.
+func parseDate(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// pageDate returns when a page was last changed, preferring its update
+// metadata, then the Last-Modified header, then its publication date.
+func pageDate(resp *colly.Response, m Metadata) (time.Time, bool) {
+	if t, ok := parseDate(m.Modified); ok {
+		return t, true
+	}
+	if resp.Headers != nil {
+		if t, ok := parseDate(resp.Headers.Get("Last-Modified")); ok {
+			return t, true
+		}
+	}
+	return parseDate(m.Date)
+}
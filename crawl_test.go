@@ -0,0 +1,823 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// testSite serves each path in site as an HTML page and 404s the rest.
+func testSite(t testing.TB, site map[string]string) *httptest.Server {
+	srv := httptest.NewServer(siteHandler(site))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// siteHandler is testSite's handler, for tests that wrap it before the
+// server starts.
+func siteHandler(site map[string]string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := site[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body))
+	})
+}
+
+// htmlPage returns a page titled title whose <article> holds body.
+func htmlPage(title, body string) string {
+	return "<html><head><title>" + title + "</title></head><body><article><h1>" + title + "</h1>" + body + "</article></body></html>"
+}
+
+// testCrawlOptions returns the command line's defaults for crawling u,
+// made quick and reproducible: sequential, without delays or retries,
+// and two levels deep.
+func testCrawlOptions(u string) CrawlOptions {
+	opts := DefaultCrawlOptions()
+	opts.URL = u
+	opts.MaxDepth = 2
+	opts.Timeout = 30 * time.Second
+	opts.RequestTimeout = 5 * time.Second
+	opts.Deterministic = true
+	opts.Delay = 0
+	opts.Retries = 0
+	return opts
+}
+
+// pageURLs returns the URLs of pages, relative to base.
+func pageURLs(pages []Page, base string) []string {
+	urls := make([]string, len(pages))
+	for i, p := range pages {
+		urls[i] = strings.TrimPrefix(p.URL, base)
+	}
+	return urls
+}
+
+func TestCrawlReturnsPagesAndCrawlErrors(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":      htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/gone">Gone</a> <a href="/also-gone">Also gone</a>`),
+		"/a":     htmlPage("A", `<p>Page A.</p>`),
+		"/a/old": htmlPage("Old", `<p>Unlinked.</p>`),
+	})
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /a" {
+		t.Errorf("crawl returned pages %s, want / /a", got)
+	}
+	if err == nil {
+		t.Fatal("crawl returned no error for the missing pages")
+	}
+	var failed []string
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var crawlErr *CrawlError
+		if !errors.As(e, &crawlErr) {
+			t.Fatalf("crawl error %v is not a *CrawlError", e)
+		}
+		if crawlErr.Status != http.StatusNotFound {
+			t.Errorf("%s failed with status %d, want 404", crawlErr.URL, crawlErr.Status)
+		}
+		failed = append(failed, strings.TrimPrefix(crawlErr.URL, srv.URL))
+	}
+	if got := strings.Join(failed, " "); got != "/also-gone /gone" {
+		t.Errorf("crawl reported failures %s, want /also-gone /gone", got)
+	}
+}
+
+func TestFailOnErrors(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p><a href="/gone">Gone</a>`),
+	})
+	for _, tc := range []struct {
+		args   []string
+		status int
+	}{
+		{nil, 0},
+		{[]string{"-fail-on-errors"}, 1},
+	} {
+		args := append([]string{"-url", srv.URL + "/", "-output", "out.json", "-retries", "0"}, tc.args...)
+		dir, out, status := runMain(t, args...)
+		if status != tc.status {
+			t.Errorf("%v: exit status %d, want %d:\n%s", tc.args, status, tc.status, out)
+		}
+		if !strings.Contains(out, srv.URL+"/gone: status 404") {
+			t.Errorf("%v: failed URL not listed:\n%s", tc.args, out)
+		}
+		if _, err := os.Stat(filepath.Join(dir, "out.json")); err != nil {
+			t.Errorf("%v: output not written: %v", tc.args, err)
+		}
+	}
+}
+
+func TestCrawlWithoutFailuresReturnsNil(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a>`),
+		"/a": htmlPage("A", `<p>Page A.</p>`),
+	})
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+	if err != nil {
+		t.Errorf("crawl returned error %v, want nil", err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("crawl returned %d pages, want 2", len(pages))
+	}
+}
+
+// linkHeavySite serves a start page linking to distinct pages, each of them
+// repeats times, as navigation menus and footers repeat links.
+func linkHeavySite(t testing.TB, distinct, repeats int) *httptest.Server {
+	site := make(map[string]string)
+	var body strings.Builder
+	for i := 0; i < distinct; i++ {
+		site[fmt.Sprintf("/p/%d", i)] = htmlPage(fmt.Sprintf("Page %d", i), "<p>Text.</p>")
+	}
+	for r := 0; r < repeats; r++ {
+		for i := 0; i < distinct; i++ {
+			fmt.Fprintf(&body, `<a href="/p/%d">Page %d</a> `, i, i)
+		}
+	}
+	site["/"] = htmlPage("Home", body.String())
+	return testSite(t, site)
+}
+
+func TestRepeatedLinksVisitedOnce(t *testing.T) {
+	site := linkHeavySite(t, 5, 20)
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	if _, err := Crawl(testCrawlOptions(srv.URL + "/")); err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 7 {
+		t.Errorf("fetched %v, want robots.txt, the start page and its 5 links", hits)
+	}
+	for path, n := range hits {
+		if n != 1 {
+			t.Errorf("%s fetched %d times, want once", path, n)
+		}
+	}
+}
+
+func TestPageLinks(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": `<html><head><link rel="next" href="/b"></head><body><article>
+			<a href="/a" rel="nofollow">A</a> <a href="/b">B</a> <a href="/a">A again</a> <a href="a#top">A top</a>
+			<span data-href="/c">C</span></article><a href="/outside">Outside</a></body></html>`,
+	})
+	sources, err := parseLinkSources(defaultLinkSources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []pageLink
+	c := colly.NewCollector()
+	c.OnHTML("html", func(page *colly.HTMLElement) {
+		container := page.DOM.Find("article")
+		e := colly.NewHTMLElementFromSelectionNode(page.Response, container, container.Nodes[0], 0)
+		got, _ = pageLinks(context.Background(), page, e, sources, stripFragment)
+	})
+	if err := c.Visit(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each URL once, in order, with the rel it first appeared with
+	want := []pageLink{{srv.URL + "/a", "nofollow"}, {srv.URL + "/b", ""}, {srv.URL + "/c", ""}}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("pageLinks = %v, want %v", got, want)
+	}
+}
+
+// BenchmarkLinkDiscovery follows the links of a page that repeats each of
+// its 50 links 20 times, calling c.Visit for every anchor, as the scraper
+// did before, or for every distinct link from pageLinks. It reports the
+// c.Visit calls made per page.
+func BenchmarkLinkDiscovery(b *testing.B) {
+	srv := linkHeavySite(b, 50, 20)
+	for _, mode := range []string{"per-anchor", "deduplicated"} {
+		b.Run(mode, func(b *testing.B) {
+			visits := 0
+			for i := 0; i < b.N; i++ {
+				c := colly.NewCollector()
+				c.OnHTML("html", func(page *colly.HTMLElement) {
+					if page.Request.URL.Path != "/" {
+						return
+					}
+					if mode == "per-anchor" {
+						page.ForEach("a[href]", func(_ int, el *colly.HTMLElement) {
+							visits++
+							el.Request.Visit(el.Attr("href"))
+						})
+						return
+					}
+					found, _ := pageLinks(context.Background(), page, page, nil, func(link string) string { return link })
+					for _, l := range found {
+						visits++
+						page.Request.Visit(l.URL)
+					}
+				})
+				if err := c.Visit(srv.URL + "/"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(visits)/float64(b.N), "visits/op")
+		})
+	}
+}
+
+func TestFallbackSelector(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": `<html><head><title>Plain</title></head><body><header>Site header</header><nav>Menu</nav>
+			<div class="text"><h1>Plain</h1><p>Body text without an article.</p></div><footer><p>Footer</p></footer></body></html>`,
+	})
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("crawl returned %d pages, want 1", len(pages))
+	}
+	content := pages[0].Content
+	if !strings.Contains(content, "Body text without an article.") {
+		t.Errorf("content %q lacks the body text", content)
+	}
+	for _, chrome := range []string{"Site header", "Menu", "Footer"} {
+		if strings.Contains(content, chrome) {
+			t.Errorf("content %q still has the boilerplate %q", content, chrome)
+		}
+	}
+
+	// A custom fallback is used as given, and none skips the page
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.FallbackSelector = "footer"
+	opts.StripBoilerplate = false
+	if pages, _ = Crawl(opts); len(pages) != 1 || strings.Contains(pages[0].Content, "Body text") {
+		t.Errorf("-fallback-selector footer captured %+v, want only the footer", pages)
+	}
+	opts.FallbackSelector = ""
+	if pages, _ = Crawl(opts); len(pages) != 0 {
+		t.Errorf("an empty -fallback-selector captured %d pages, want none", len(pages))
+	}
+}
+
+func TestFallbackBareText(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": `<html><head><title>Bare</title></head><body><nav>Menu</nav>Text straight in the body.
+			<div>Text in a div<br>on two lines.</div><footer>Footer</footer></body></html>`,
+		"/main": `<html><head><title>Main</title></head><body><main><h1>Main</h1><span>Text in a span</span> and more.</main></body></html>`,
+	})
+	for _, tc := range []struct {
+		path, want string
+	}{
+		{"/", "Text straight in the body.\n\nText in a div\n\non two lines.\n\n"},
+		// A container that matches but has no paragraphs is read the same way
+		{"/main", "Text in a span and more.\n\n"},
+	} {
+		pages, err := Crawl(testCrawlOptions(srv.URL + tc.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != 1 {
+			t.Fatalf("%s: crawl returned %d pages, want 1", tc.path, len(pages))
+		}
+		if pages[0].Content != tc.want {
+			t.Errorf("%s: content %q, want %q", tc.path, pages[0].Content, tc.want)
+		}
+	}
+}
+
+func TestFollowPaginationAtDepthOne(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": `<html><head><title>Posts</title><link rel="next" href="/posts/2"></head><body>
+			<article><h1>Posts</h1><p>First posts.</p><a href="/other">Other</a></article></body></html>`,
+		"/posts/2": htmlPage("Posts 2", `<p>Older posts.</p>`) + `<a href="/posts/3">Next »</a>`,
+		"/posts/3": `<html><head><title>Posts 3</title></head><body>
+			<article><h1>Posts 3</h1><p>Oldest posts.</p><a rel="next" href="/posts/4">4</a></article></body></html>`,
+		"/posts/4": htmlPage("Posts 4", `<p>Archive.</p>`),
+		"/other":   htmlPage("Other", `<p>Not part of the series.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxDepth = 1
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /posts/2 /posts/3 /posts/4" {
+		t.Errorf("crawl at depth 1 returned pages %s, want / /posts/2 /posts/3 /posts/4", got)
+	}
+
+	opts.FollowNext = false
+	if pages, _ = Crawl(opts); len(pages) != 1 {
+		t.Errorf("crawl without -follow-next returned %d pages, want 1", len(pages))
+	}
+}
+
+func TestPaginationNofollow(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":        `<html><head><title>Posts</title><link rel="next nofollow" href="/posts/2"></head><body><article><h1>Posts</h1><p>First posts.</p></article></body></html>`,
+		"/posts/2": htmlPage("Posts 2", `<p>Older posts.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/" {
+		t.Errorf("crawl returned pages %s, want only / without a rel=nofollow next link", got)
+	}
+
+	opts.FollowNofollow = true
+	if pages, _ = Crawl(opts); len(pages) != 2 {
+		t.Errorf("crawl with -follow-nofollow returned %d pages, want 2", len(pages))
+	}
+}
+
+func TestPaginationQueryVariantsBounded(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		next := ""
+		if page < 20 {
+			next = fmt.Sprintf(`<link rel="next" href="/?page=%d">`, page+1)
+		}
+		fmt.Fprintf(w, `<html><head><title>Page %d</title>%s</head><body><article><h1>Page %[1]d</h1><p>Threads.</p></article></body></html>`, page, next)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxQueryVariants = 3
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The start page and three variants
+	if len(pages) != 4 {
+		t.Errorf("crawl returned %d pages, want 4: %v", len(pages), pageURLs(pages, srv.URL))
+	}
+}
+
+func TestDepthLimit(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a>`),
+		"/a": htmlPage("A", `<p>Depth 2.</p><a href="/b">B</a>`),
+		"/b": htmlPage("B", `<p>Depth 3.</p><a href="/c">C</a>`),
+		"/c": htmlPage("C", `<p>Depth 4.</p>`),
+	})
+	for _, tc := range []struct {
+		args []string
+		want string
+	}{
+		{nil, "/ /a /b /c"},
+		{[]string{"-depth", "0"}, "/ /a /b /c"},
+		{[]string{"-depth", "2"}, "/ /a"},
+		{[]string{"-depth", "3"}, "/ /a /b"},
+	} {
+		args := append([]string{"-url", srv.URL + "/", "-output", "out.json", "-deterministic"}, tc.args...)
+		dir, out, status := runMain(t, args...)
+		if status != 0 {
+			t.Fatalf("%v: exit status %d:\n%s", tc.args, status, out)
+		}
+		var pages []Page
+		if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "out.json")), &pages); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(pageURLs(pages, srv.URL), " "); got != tc.want {
+			t.Errorf("%v: crawled %s, want %s", tc.args, got, tc.want)
+		}
+	}
+	if _, out, status := runMain(t, "-url", srv.URL+"/", "-depth", "-1"); status == 0 || !strings.Contains(out, "-depth must not be negative") {
+		t.Errorf("-depth -1: exit status %d:\n%s", status, out)
+	}
+}
+
+func TestAllowDomain(t *testing.T) {
+	docs := testSite(t, map[string]string{
+		"/guide": htmlPage("Guide", `<p>On the docs host.</p>`),
+	})
+	// The docs host is reached as localhost so the two hosts differ by name
+	docsURL := strings.Replace(docs.URL, "127.0.0.1", "localhost", 1)
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p><a href="`+docsURL+`/guide">Guide</a> <a href="https://elsewhere.example/">Elsewhere</a>`),
+	})
+	for _, tc := range []struct {
+		allow []string
+		want  string
+	}{
+		{nil, srv.URL + "/"},
+		{[]string{"localhost"}, srv.URL + "/ " + docsURL + "/guide"},
+	} {
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.AllowDomains = tc.allow
+		pages, err := Crawl(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(pageURLs(pages, ""), " "); got != tc.want {
+			t.Errorf("-allow-domain %v: crawled %s, want %s", tc.allow, got, tc.want)
+		}
+	}
+	if _, out, status := runMain(t, "-url", srv.URL+"/", "-allow-domain", "https://docs.example.com/"); status == 0 || !strings.Contains(out, "Invalid -allow-domain") {
+		t.Errorf("-allow-domain with a URL: exit status %d:\n%s", status, out)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/":     htmlPage("Home", `<p>Start here.</p><a href="/fast">Fast</a> <a href="/slow">Slow</a>`),
+		"/fast": htmlPage("Fast", `<p>Quick.</p>`),
+		"/slow": htmlPage("Slow", `<p>Eventually.</p>`),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			select {
+			case <-time.After(5 * time.Second):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.RequestTimeout = 200 * time.Millisecond
+	start := time.Now()
+	pages, err := Crawl(opts)
+	if elapsed := time.Since(start); elapsed > 3*time.Second {
+		t.Errorf("crawl took %v, want the slow page abandoned after -request-timeout", elapsed)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /fast" {
+		t.Errorf("crawl returned pages %s, want / /fast", got)
+	}
+	var crawlErr *CrawlError
+	if !errors.As(err, &crawlErr) || crawlErr.URL != srv.URL+"/slow" {
+		t.Errorf("crawl returned error %v, want one for /slow", err)
+	}
+}
+
+func TestModifiedSince(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/":         htmlPage("Home", `<p>Start here.</p><a href="/old">Old</a> <a href="/new">New</a>`),
+		"/old":      htmlPage("Old", `<p>Written long ago.</p><a href="/old/next">Next</a>`),
+		"/new":      htmlPage("New", `<p>Just written.</p>`),
+		"/old/next": htmlPage("Next", `<p>Linked from an old page.</p>`),
+	})
+	lastModified := map[string]time.Time{
+		"/old": time.Date(2023, 3, 1, 12, 0, 0, 0, time.UTC),
+		"/new": time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if at, ok := lastModified[r.URL.Path]; ok {
+			w.Header().Set("Last-Modified", at.Format(http.TimeFormat))
+		}
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Since = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Undated pages are kept by default, and old pages' links followed
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /old/next /new" {
+		t.Errorf("-modified-since 2024-01-01 kept pages %s, want / /old/next /new", got)
+	}
+
+	opts.IncludeUndated = false
+	if pages, _ = Crawl(opts); strings.Join(pageURLs(pages, srv.URL), " ") != "/new" {
+		t.Errorf("-include-undated=false kept pages %v, want /new", pageURLs(pages, srv.URL))
+	}
+}
+
+func TestSortByBreadcrumb(t *testing.T) {
+	crumbs := func(trail ...string) string {
+		var b strings.Builder
+		b.WriteString(`<nav aria-label="breadcrumb"><ol>`)
+		for _, label := range trail {
+			fmt.Fprintf(&b, `<li><a href="#">%s</a></li>`, label)
+		}
+		return b.String() + `</ol></nav>`
+	}
+	page := func(title, trail, body string) string {
+		return "<html><head><title>" + title + "</title></head><body>" + trail + "<article><h1>" + title + "</h1>" + body + "</article></body></html>"
+	}
+	srv := testSite(t, map[string]string{
+		"/":          page("Home", "", `<p>Start here.</p><a href="/z-install">Install</a> <a href="/a-api">API</a> <a href="/m-setup">Setup</a>`),
+		"/z-install": page("Install", crumbs("Docs", "Guides", "Install"), `<p>Install it.</p>`),
+		"/a-api":     page("API", crumbs("Docs", "Reference", "API"), `<p>Call it.</p>`),
+		"/m-setup":   page("Setup", crumbs("Docs", "Guides", "Setup"), `<p>Set it up.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.SortBy = "breadcrumb"
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trails := make(map[string]string)
+	for _, p := range pages {
+		trails[strings.TrimPrefix(p.URL, srv.URL)] = strings.Join(p.Breadcrumb, " > ")
+	}
+	if got := trails["/a-api"]; got != "Docs > Reference > API" {
+		t.Errorf("/a-api breadcrumb %q, want Docs > Reference > API", got)
+	}
+	// Guides before Reference, and the page without a trail last
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/z-install /m-setup /a-api /" {
+		t.Errorf("-sort breadcrumb ordered pages %s, want /z-install /m-setup /a-api /", got)
+	}
+}
+
+func TestLoadMoreEndpoint(t *testing.T) {
+	var fetched []string
+	site := testSite(t, map[string]string{
+		"/":     htmlPage("Feed", `<p>Latest posts.</p><button data-next="/more?page=2">Load more</button>`),
+		"/more": htmlPage("More", `<p>Older posts.</p><div data-more="/more?page=3"></div>`),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched = append(fetched, r.URL.RequestURI())
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxDepth = 1
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /more?page=2" {
+		t.Errorf("crawl returned pages %s, want / /more?page=2", got)
+	}
+
+	// Other attributes are only followed when configured
+	opts.NextAttrs = []string{"data-next", "data-more"}
+	fetched = nil
+	if pages, _ = Crawl(opts); len(pages) != 3 || !slices.Contains(fetched, "/more?page=3") {
+		t.Errorf("-next-attrs data-next,data-more fetched %v, want /more?page=3 too", fetched)
+	}
+}
+
+func TestRedirectedPageCapturedOnce(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	site := testSite(t, map[string]string{
+		"/":    htmlPage("Home", `<p>Start here.</p><a href="/old">Old</a> <a href="/new">New</a> <a href="/a">A</a>`),
+		"/a":   htmlPage("A", `<p>Page A.</p><a href="/old">Old again</a>`),
+		"/new": htmlPage("New", `<p>Moved here.</p>`),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusMovedPermanently)
+			return
+		}
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /new /a" {
+		t.Errorf("crawl returned pages %s, want / /new /a", got)
+	}
+	if hits["/old"] != 1 || hits["/new"] != 1 {
+		t.Errorf("server saw /old %d times and /new %d times, want once each", hits["/old"], hits["/new"])
+	}
+}
+
+func TestQueryVariantsBounded(t *testing.T) {
+	var links strings.Builder
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&links, `<a href="/search?page=%d">%d</a> `, i, i)
+	}
+	srv := testSite(t, map[string]string{
+		"/":       htmlPage("Forum", `<p>Threads.</p>`+links.String()+`<a href="/rules">Rules</a>`),
+		"/search": htmlPage("Results", `<p>More threads.</p>`),
+		"/rules":  htmlPage("Rules", `<p>Be nice.</p>`),
+	})
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxQueryVariants = 5
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The start page, five variants and the unrelated page
+	if len(pages) != 7 {
+		t.Errorf("crawl returned %d pages, want 7: %v", len(pages), pageURLs(pages, srv.URL))
+	}
+	if !slices.Contains(pageURLs(pages, srv.URL), "/rules") {
+		t.Errorf("crawl skipped /rules along with the query variants")
+	}
+
+	opts.AllowQueryCrawl = true
+	if pages, _ = Crawl(opts); len(pages) != 52 {
+		t.Errorf("crawl with -allow-query-crawl returned %d pages, want 52", len(pages))
+	}
+}
+
+func TestNofollowLinks(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	site := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/private" rel="nofollow">Private</a>
+			<a href="/out" rel="external">Out</a> <a href="/file" rel="download">File</a> <a href="/both" rel="noopener NOFOLLOW">Both</a>`),
+		"/a":       htmlPage("A", `<p>Page A.</p>`),
+		"/private": htmlPage("Private", `<p>Hidden.</p>`),
+		"/out":     htmlPage("Out", `<p>External.</p>`),
+		"/file":    htmlPage("File", `<p>Download.</p>`),
+		"/both":    htmlPage("Both", `<p>Hidden too.</p>`),
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	if _, err := Crawl(opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fetched, " "); got != "/robots.txt / /a" {
+		t.Errorf("crawl fetched %s, want /robots.txt / /a", got)
+	}
+
+	// -follow-nofollow lifts only the nofollow rule
+	fetched = nil
+	opts.FollowNofollow = true
+	if _, err := Crawl(opts); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(fetched, " "); got != "/robots.txt / /a /private /both" {
+		t.Errorf("crawl with -follow-nofollow fetched %s, want /robots.txt / /a /private /both", got)
+	}
+}
+
+func TestLinkSources(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": `<html><head><title>Map</title><link rel="up" href="/up"></head><body><article><h1>Map</h1><p>Pick a region.</p>
+			<map name="regions"><area shape="rect" coords="0,0,10,10" href="/north"></map>
+			<button data-href="/button">Go</button><span data-url="/custom">Custom</span></article></body></html>`,
+		"/north":  htmlPage("North", `<p>The north.</p>`),
+		"/up":     htmlPage("Up", `<p>The parent.</p>`),
+		"/button": htmlPage("Button", `<p>From a button.</p>`),
+		"/custom": htmlPage("Custom", `<p>From a custom attribute.</p>`),
+	})
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := pageURLs(pages, srv.URL)
+	for _, want := range []string{"/north", "/up", "/button"} {
+		if !slices.Contains(got, want) {
+			t.Errorf("crawl returned pages %v, want %s among them", got, want)
+		}
+	}
+	if slices.Contains(got, "/custom") {
+		t.Errorf("crawl followed data-url without it being a -link-sources entry")
+	}
+
+	opts := testCrawlOptions(srv.URL + "/")
+	if opts.LinkSources, err = parseLinkSources(`[data-url]@data-url`); err != nil {
+		t.Fatal(err)
+	}
+	if pages, _ = Crawl(opts); strings.Join(pageURLs(pages, srv.URL), " ") != "/ /custom" {
+		t.Errorf("-link-sources [data-url]@data-url crawled %v, want / /custom", pageURLs(pages, srv.URL))
+	}
+}
+
+func TestSectionDepth(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":        htmlPage("Home", `<p>Start here.</p><a href="/guide/1">Guide</a> <a href="/api/1">API</a>`),
+		"/guide/1": htmlPage("Guide 1", `<p>Guide.</p><a href="/guide/2">More</a>`),
+		"/guide/2": htmlPage("Guide 2", `<p>Guide.</p><a href="/guide/3">More</a>`),
+		"/guide/3": htmlPage("Guide 3", `<p>Guide.</p>`),
+		"/api/1":   htmlPage("API 1", `<p>API.</p><a href="/api/2">More</a>`),
+		"/api/2":   htmlPage("API 2", `<p>API.</p><a href="/api/3">More</a>`),
+		"/api/3":   htmlPage("API 3", `<p>API.</p><a href="/api/4">More</a>`),
+		"/api/4":   htmlPage("API 4", `<p>API.</p>`),
+	})
+	sections, err := parseSectionDepths([]string{"/api/=4"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Sections = sections
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /guide/1 /api/1 /api/2 /api/3" {
+		t.Errorf("-depth 2 -section-depth /api/=4 crawled %s, want /api/ pages beyond depth 2 only", got)
+	}
+
+	for _, rule := range []string{"api=3", "/api/", "/api/=x", "/api/=-1"} {
+		if _, err := parseSectionDepths([]string{rule}); err == nil {
+			t.Errorf("-section-depth %q accepted", rule)
+		}
+	}
+}
+
+func TestOnlyReachableFrom(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":       htmlPage("Home", `<p>Start here.</p><a href="/docs/">Docs</a> <a href="/other">Other</a>`),
+		"/docs/":  htmlPage("Docs", `<p>Docs.</p><a href="/docs/a">A</a>`),
+		"/docs/a": htmlPage("Docs A", `<p>Page A.</p>`),
+		"/other":  htmlPage("Other", `<p>Other.</p><a href="/docs/b">B</a>`),
+		"/docs/b": htmlPage("Docs B", `<p>Only linked from outside the docs.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxDepth = 3
+	opts.ReachableFrom = srv.URL + "/docs/"
+	pages, out, err := crawlLogged(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/docs/ /docs/a" {
+		t.Errorf("-only-reachable-from /docs/ kept %s, want /docs/ /docs/a", got)
+	}
+	if !strings.Contains(out, "/docs/b: not reachable from") {
+		t.Errorf("/docs/b not reported as unreachable:\n%s", out)
+	}
+}
+
+func TestNormalizeURLs(t *testing.T) {
+	var mu sync.Mutex
+	fetched := map[string]int{}
+	site := map[string]string{
+		"/":                htmlPage("Home", `<p>Start here.</p><a href="/docs/">Docs</a> <a href="/docs/index.html">Docs index</a> <a href="/docs">Docs again</a>`),
+		"/docs/":           htmlPage("Docs", `<p>Docs.</p>`),
+		"/docs/index.html": htmlPage("Docs", `<p>Docs.</p>`),
+		"/docs":            htmlPage("Docs", `<p>Docs.</p>`),
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(site[r.URL.Path]))
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, tc := range []struct {
+		trailingSlash string
+		want          string
+	}{
+		{"keep", "/ /docs/ /docs"},
+		{"add", "/ /docs/"},
+		{"strip", "/ /docs"},
+	} {
+		clear(fetched)
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.NormalizeURLs = true
+		opts.TrailingSlash = tc.trailingSlash
+		opts.DedupeThreshold = 0
+		pages, err := Crawl(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(pageURLs(pages, srv.URL), " "); got != tc.want {
+			t.Errorf("-trailing-slash %s: crawled %s, want %s", tc.trailingSlash, got, tc.want)
+		}
+		if fetched["/docs/index.html"] != 0 {
+			t.Errorf("-trailing-slash %s: /docs/index.html fetched separately from /docs/", tc.trailingSlash)
+		}
+	}
+
+	for link, want := range map[string]string{
+		"https://Example.com/docs/index.html#top": "https://example.com/docs/",
+		"https://example.com/docs/index.php?x=1":  "https://example.com/docs/?x=1",
+		"https://example.com":                     "https://example.com/",
+	} {
+		if got := normalizeURL(link, "keep"); got != want {
+			t.Errorf("normalizeURL(%s) = %s, want %s", link, got, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// CrawlError describes a URL whose final request failed.
+type CrawlError struct {
+	URL    string
+	Status int // HTTP status code, 0 for network errors
+	Err    error
+}
+
+func (e *CrawlError) Error() string {
+	if e.Status != 0 {
+		return fmt.Sprintf("%s: status %d: %v", e.URL, e.Status, e.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.URL, e.Err)
+}
+
+func (e *CrawlError) Unwrap() error { return e.Err }
+
+// crawlErrors joins a CrawlError for every failed URL, sorted by URL, or
+// returns nil when every URL was fetched. Callers can recover the
+// individual failures with errors.As on the joined error's Unwrap list.
+func crawlErrors(m *crawlManifest) error {
+	failed := m.failures()
+	urls := make([]string, 0, len(failed))
+	for u := range failed {
+		urls = append(urls, u)
+	}
+	sort.Strings(urls)
+
+	var errs []error
+	for _, u := range urls {
+		e := failed[u]
+		errs = append(errs, &CrawlError{URL: u, Status: e.Status, Err: e.err})
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCrawlErrors(t *testing.T) {
+	m := newCrawlManifest(time.Now())
+	if err := crawlErrors(m); err != nil {
+		t.Errorf("crawl without failures returned %v", err)
+	}
+
+	notFound := errors.New("Not Found")
+	m.recordError("https://example.com/gone", 404, notFound)
+	m.recordError("https://example.com/down", 0, syscall.ECONNREFUSED)
+	// A URL that succeeded on a retry is not a failure
+	m.recordError("https://example.com/flaky", 503, errors.New("Service Unavailable"))
+	m.recordStatus("https://example.com/flaky", 200)
+
+	err := crawlErrors(m)
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("crawlErrors returned %v, want a joined error", err)
+	}
+	var urls []string
+	for _, e := range joined.Unwrap() {
+		var crawlErr *CrawlError
+		if !errors.As(e, &crawlErr) {
+			t.Fatalf("%v is not a *CrawlError", e)
+		}
+		urls = append(urls, crawlErr.URL)
+	}
+	if len(urls) != 2 || urls[0] != "https://example.com/down" || urls[1] != "https://example.com/gone" {
+		t.Errorf("failed URLs %v, want /down and /gone sorted by URL", urls)
+	}
+	if !errors.Is(err, notFound) || !errors.Is(err, syscall.ECONNREFUSED) {
+		t.Errorf("%v does not wrap the underlying errors", err)
+	}
+	if got, want := joined.Unwrap()[1].Error(), "https://example.com/gone: status 404: Not Found"; got != want {
+		t.Errorf("error reads %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/csv"
+	"strconv"
+	"strings"
+)
+
+// csvPreviewRunes is the length of the content preview column.
+const csvPreviewRunes = 200
+
+// csvHeader names the columns written by writeCSV.
+var csvHeader = []string{"url", "title", "depth", "word_count", "heading_count", "code_block_count", "preview"}
+
+// writeCSV saves one row per page with its size counts and the start of
+// its text, for spreadsheet analysis.
+func writeCSV(pages []Page, path string, bom bool) error {
+	f, err := createTextFile(path, bom)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	if err := w.Write(csvHeader); err != nil {
+		f.Close()
+		return err
+	}
+	for _, page := range pages {
+		words := strings.Fields(page.prose())
+		if err := w.Write([]string{
+			page.URL,
+			page.Title,
+			strconv.Itoa(page.Depth),
+			strconv.Itoa(len(words)),
+			strconv.Itoa(len(page.Headings)),
+			strconv.Itoa(len(page.Code)),
+			preview(strings.Join(words, " "), csvPreviewRunes),
+		}); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// preview shortens text to at most n runes, ending it with "…" when cut.
+func preview(text string, n int) string {
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	return strings.TrimRight(string(runes[:n-1]), " ") + "…"
+}
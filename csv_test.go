@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestCSV(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Install, Configure", `<p>Say "hello", then wave.</p><h2>Steps</h2><p>First line<br>second line.</p>
+			<pre>make install</pre><a href="/long">Long</a>`),
+		"/long": htmlPage("Long", "<p>"+strings.Repeat("word ", 300)+"</p>"),
+	})
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "pages.csv")
+	if err := writeCSV(pages, path, false); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(bytes.NewReader(readOutput(t, path))).ReadAll()
+	if err != nil {
+		t.Fatalf("CSV does not parse: %v", err)
+	}
+	if len(rows) != len(pages)+1 || !slices.Equal(rows[0], csvHeader) {
+		t.Fatalf("CSV has %d rows headed %q, want a header and %d pages", len(rows), rows[0], len(pages))
+	}
+
+	for i, page := range pages {
+		row := rows[i+1]
+		words := strings.Fields(page.prose())
+		want := []string{page.URL, page.Title, strconv.Itoa(page.Depth), strconv.Itoa(len(words)),
+			strconv.Itoa(len(page.Headings)), strconv.Itoa(len(page.Code))}
+		if !slices.Equal(row[:6], want) {
+			t.Errorf("row %d is %q, want %q", i+1, row[:6], want)
+		}
+		if n := utf8.RuneCountInString(row[6]); n > csvPreviewRunes {
+			t.Errorf("row %d preview has %d characters, want at most %d", i+1, n, csvPreviewRunes)
+		}
+	}
+	if row := rows[1]; row[1] != "Install, Configure" || row[4] != "2" || row[5] != "1" ||
+		!strings.HasPrefix(row[6], `Say "hello", then wave.`) {
+		t.Errorf("first row %q lost its commas, quotes or counts", row)
+	}
+	if preview := rows[2][6]; !strings.HasSuffix(preview, "…") || rows[2][3] != "300" {
+		t.Errorf("long page row %q, want 300 words and a cut preview", rows[2])
+	}
+}
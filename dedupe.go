@@ -0,0 +1,53 @@
+package main
+
+import "strings"
+
+// dedupeBoilerplate strips content paragraphs that appear on at least
+// threshold (a fraction) of the pages, and on two or more, such as a
+// notice or footer repeated inside every page's content container. Heading,
+// code block, image and note markers are never stripped. It returns the
+// number of distinct paragraphs removed.
+func dedupeBoilerplate(pages []Page, threshold float64) int {
+	key := func(para string) string {
+		return strings.Join(strings.Fields(para), " ")
+	}
+
+	// Pages each paragraph appears on, counting a page once
+	counts := make(map[string]int)
+	for _, p := range pages {
+		seen := make(map[string]bool)
+		for _, para := range strings.Split(p.Content, "\n\n") {
+			para = strings.TrimSpace(para)
+			if k := key(para); k != "" && !isMarker(para) && !seen[k] {
+				seen[k] = true
+				counts[k]++
+			}
+		}
+	}
+	boilerplate := make(map[string]bool)
+	for k, n := range counts {
+		if n >= 2 && float64(n) >= threshold*float64(len(pages)) {
+			boilerplate[k] = true
+		}
+	}
+	if len(boilerplate) == 0 {
+		return 0
+	}
+
+	for i := range pages {
+		var kept []string
+		removed := false
+		for _, para := range strings.Split(pages[i].Content, "\n\n") {
+			if boilerplate[key(para)] && !isMarker(strings.TrimSpace(para)) {
+				removed = true
+				continue
+			}
+			kept = append(kept, para)
+		}
+		if removed {
+			pages[i].Content = strings.Join(kept, "\n\n")
+			pages[i].Checksum = contentHash(pages[i])
+		}
+	}
+	return len(boilerplate)
+}
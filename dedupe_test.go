@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedupeBoilerplate(t *testing.T) {
+	const footer = `<p>Copyright Acme. All rights reserved.</p>`
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a> <a href="/c">C</a>`+footer),
+		"/a": htmlPage("Page A", `<p>Page A.</p><h2>Usage</h2><p>See the release notes.</p>`+footer),
+		"/b": htmlPage("Page B", `<p>Page B.</p><h2>Usage</h2><p>See the   release notes.</p><p>Copyright  Acme.
+			All rights reserved.</p>`),
+		"/c": htmlPage("Page C", `<p>Page C.</p>`+footer),
+	})
+	for _, tc := range []struct {
+		dedupe    bool
+		threshold float64
+		footer    bool // whether the footer is kept
+		notes     bool // whether the paragraph on two of four pages is kept
+	}{
+		{false, 0.5, true, true},
+		{true, 0.5, false, false},
+		{true, 0.75, false, true},
+	} {
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.Dedupe = tc.dedupe
+		opts.DedupeThreshold = tc.threshold
+		pages, out, err := crawlLogged(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != 4 {
+			t.Fatalf("got %d pages, want 4", len(pages))
+		}
+		for i, p := range pages {
+			if own := []string{"Start here.", "Page A.", "Page B.", "Page C."}[i]; !strings.HasPrefix(p.Content, own) {
+				t.Errorf("%s lost its own paragraph %q: %q", p.URL, own, p.Content)
+			}
+			if kept := strings.Contains(p.Content, "Copyright"); kept != tc.footer {
+				t.Errorf("dedupe %t at %g: %s keeps the footer %t, want %t", tc.dedupe, tc.threshold, p.URL, kept, tc.footer)
+			}
+			if p.Checksum != contentHash(p) {
+				t.Errorf("%s checksum is not of its deduplicated content", p.URL)
+			}
+		}
+		for _, p := range pages[1:3] {
+			if kept := strings.Contains(p.Content, "release notes"); kept != tc.notes {
+				t.Errorf("dedupe %t at %g: %s keeps the repeated notes %t, want %t", tc.dedupe, tc.threshold, p.URL, kept, tc.notes)
+			}
+			if !strings.Contains(p.Content, "[Heading 2]") {
+				t.Errorf("%s lost the heading marker it shares with another page: %q", p.URL, p.Content)
+			}
+		}
+		if reported := strings.Contains(out, "boilerplate paragraphs"); reported != tc.dedupe {
+			t.Errorf("dedupe %t: removal reported %t:\n%s", tc.dedupe, reported, out)
+		}
+	}
+}
+
+func TestDedupeRejectsJSONL(t *testing.T) {
+	srv := testSite(t, map[string]string{"/": htmlPage("Home", `<p>Start here.</p>`)})
+	for _, format := range []string{"jsonl", "json,jsonl"} {
+		_, out, status := runMain(t, "-url", srv.URL+"/", "-format", format, "-content-dedupe-within-page")
+		if status == 0 || !strings.Contains(out, "-content-dedupe-within-page requires a format other than jsonl") {
+			t.Errorf("-format %s: exit status %d:\n%s", format, status, out)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDeterministicCrawl crawls the same site twice in deterministic mode
+// and checks that pages come back in the same, discovery, order and that
+// the PDFs written from them are identical.
+func TestDeterministicCrawl(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":    htmlPage("Home", `<p>Start here.</p><a href="/z">Z</a> <a href="/m">M</a> <a href="/a">A</a>`),
+		"/z":   htmlPage("Z", `<p>Page Z.</p><a href="/z/1">Z1</a>`),
+		"/z/1": htmlPage("Z1", `<p>Page Z1.</p>`),
+		"/m":   htmlPage("M", `<p>Page M.</p>`),
+		"/a":   htmlPage("A", `<p>Page A.</p>`),
+	})
+	dir := t.TempDir()
+	var outputs [][]byte
+	for run := 0; run < 2; run++ {
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.MaxDepth = 3
+		pages, err := Crawl(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := strings.Join(pageURLs(pages, srv.URL), " "), "/ /z /z/1 /m /a"; got != want {
+			t.Errorf("run %d returned %s, want discovery order %s", run, got, want)
+		}
+
+		path := filepath.Join(dir, "out.pdf")
+		pdfOpts := testPDFOptions()
+		pdfOpts.Images = prefetchImages(nil, pages, 1)
+		if err := writePDF(pages, path, pdfOpts); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, data)
+	}
+	if !bytes.Equal(outputs[0], outputs[1]) {
+		t.Error("the two runs wrote different PDFs")
+	}
+}
@@ -0,0 +1,868 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/htmlquery"
+	"github.com/antchfx/xpath"
+	"github.com/gocolly/colly/v2"
+	"golang.org/x/net/html"
+)
+
+// defaultContentSelectors match the containers that hold a page's main
+// content, in order of preference.
+var defaultContentSelectors = []string{"article", "main", "[role=main]", "div.Article"}
+
+// defaultBreadcrumbSelector matches the common markup for a page's breadcrumb trail.
+const defaultBreadcrumbSelector = `nav[aria-label="breadcrumb"], nav[aria-label="Breadcrumb"], .breadcrumb, .breadcrumbs`
+
+// boilerplateSelector matches page chrome that is dropped from fallback content.
+const boilerplateSelector = "nav, header, footer, aside, script, style, noscript, form"
+
+// Page is the content extracted from one scraped page.
+type Page struct {
+	Title        string    `json:"title"`
+	DocTitle     string    `json:"doc_title,omitempty"` // the document's <title>, used for bookmarks
+	Content      string    `json:"content"`
+	URL          string    `json:"url"`
+	Headings     []Heading `json:"headings,omitempty"`
+	Code         []string  `json:"code,omitempty"`
+	CodeCaptions []string  `json:"code_captions,omitempty"` // filename or caption per code block, if any has one
+	Links        []Link    `json:"links,omitempty"`
+	Images       []Image   `json:"images,omitempty"`
+	Notes        []Note    `json:"notes,omitempty"` // <aside> callouts, with -asides note
+	Breadcrumb   []string  `json:"breadcrumb,omitempty"`
+	Language     string    `json:"language,omitempty"`
+	Depth        int       `json:"depth"`              // link hops from the start URL; pagination keeps its page's depth
+	Checksum     string    `json:"checksum,omitempty"` // hex SHA-256 of the title, content and code, as kept by -state
+	Metadata     Metadata  `json:"metadata"`
+}
+
+// Metadata is descriptive information taken from a page's <head>.
+type Metadata struct {
+	Description string `json:"description,omitempty"`
+	Author      string `json:"author,omitempty"`
+	Date        string `json:"date,omitempty"`
+	Modified    string `json:"modified,omitempty"`
+	Canonical   string `json:"canonical,omitempty"`
+}
+
+// Note is an <aside> callout such as a tip or warning.
+type Note struct {
+	Label string `json:"label"`
+	Text  string `json:"text"`
+}
+
+// Heading is a section heading within a page, with Level 1 for h1 and so on.
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id,omitempty"`
+}
+
+// textWithBreaks returns the text of a selection like Text, but turns <br>
+// elements into newlines so line breaks inside a paragraph survive.
+func textWithBreaks(s *goquery.Selection) string {
+	var text strings.Builder
+	s.Contents().Each(func(_ int, child *goquery.Selection) {
+		switch goquery.NodeName(child) {
+		case "br":
+			text.WriteString("\n")
+		case "#text":
+			text.WriteString(child.Text())
+		default:
+			text.WriteString(textWithBreaks(child))
+		}
+	})
+	return text.String()
+}
+
+// bareTextBlocks are the elements whose text is a paragraph of its own
+// when a container is read as bare text.
+var bareTextBlocks = map[string]bool{
+	"address": true, "article": true, "blockquote": true, "body": true, "dd": true, "div": true,
+	"dl": true, "dt": true, "figure": true, "main": true, "section": true, "table": true, "td": true, "th": true, "tr": true,
+}
+
+// bareText returns the text of a selection other than its headings as
+// content paragraphs, one for each block element's run of text, for
+// containers whose text is not in the paragraphs and lists extraction
+// looks for.
+func bareText(s *goquery.Selection) string {
+	var content, para strings.Builder
+	flush := func() {
+		if text := strings.Join(strings.Fields(para.String()), " "); text != "" {
+			content.WriteString(text + "\n\n")
+		}
+		para.Reset()
+	}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			para.WriteString(n.Data)
+		case html.ElementNode:
+			switch {
+			case n.Data == "script" || n.Data == "style" || n.Data == "noscript":
+				return
+			case len(n.Data) == 2 && n.Data[0] == 'h' && n.Data[1] >= '1' && n.Data[1] <= '6':
+				// Headings are the page's title or have markers of their own
+				return
+			case n.Data == "br":
+				flush()
+			case bareTextBlocks[n.Data]:
+				flush()
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					walk(c)
+				}
+				flush()
+			default:
+				for c := n.FirstChild; c != nil; c = c.NextSibling {
+					walk(c)
+				}
+			}
+		}
+	}
+	for _, n := range s.Nodes {
+		walk(n)
+		flush()
+	}
+	return content.String()
+}
+
+// headingID returns the anchor ID of a heading, taken from its own id
+// attribute or from an anchor nested inside it.
+func headingID(el *colly.HTMLElement) string {
+	if id := el.Attr("id"); id != "" {
+		return id
+	}
+	if id := el.ChildAttr("[id]", "id"); id != "" {
+		return id
+	}
+	return el.ChildAttr("a[name]", "name")
+}
+
+// anchorLinkTexts are the labels doc generators give heading permalinks.
+var anchorLinkTexts = map[string]bool{"link": true, "permalink": true, "anchor": true, "link to this heading": true}
+
+// headingText returns a heading's text without the permalink anchors doc
+// sites add next to it, such as "Installation¶". In-page links holding only
+// anchor glyphs or a permalink label are dropped, then trailing glyphs are
+// trimmed; a "#" directly after a letter or digit is kept, as in "C#".
+func headingText(h *goquery.Selection, anchorChars string) string {
+	if anchorChars == "" {
+		return h.Text()
+	}
+	h = h.Clone()
+	h.Find(`a[href^="#"]`).Each(func(_ int, a *goquery.Selection) {
+		label := strings.TrimSpace(strings.Trim(strings.TrimSpace(a.Text()), anchorChars))
+		if label == "" || anchorLinkTexts[strings.ToLower(label)] {
+			a.Remove()
+		}
+	})
+
+	runes := []rune(strings.TrimRightFunc(h.Text(), unicode.IsSpace))
+	for len(runes) > 0 && strings.ContainsRune(anchorChars, runes[len(runes)-1]) {
+		if last := runes[len(runes)-1]; last == '#' && len(runes) > 1 {
+			if prev := runes[len(runes)-2]; unicode.IsLetter(prev) || unicode.IsDigit(prev) {
+				break
+			}
+		}
+		runes = []rune(strings.TrimRightFunc(string(runes[:len(runes)-1]), unicode.IsSpace))
+	}
+	return string(runes)
+}
+
+// slug returns the anchor name of the heading: its ID when it has one,
+// otherwise its text in lower case with runs of other characters turned
+// into dashes, e.g. "Getting Started" becomes "getting-started".
+func (h Heading) slug() string {
+	if h.ID != "" {
+		return h.ID
+	}
+	return slugify(h.Text)
+}
+
+func slugify(text string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(text)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// slugger hands out anchor names that are unique within one document,
+// suffixing repeats the way Markdown renderers do: "install", "install-1".
+type slugger map[string]bool
+
+func (s slugger) unique(slug string) string {
+	if slug == "" {
+		return ""
+	}
+	name := slug
+	for n := 1; s[name]; n++ {
+		name = fmt.Sprintf("%s-%d", slug, n)
+	}
+	s[name] = true
+	return name
+}
+
+// headingSlugs returns the anchor name of each of the page's headings,
+// with repeated slugs made unique.
+func (p Page) headingSlugs() []string {
+	s := slugger{}
+	slugs := make([]string, len(p.Headings))
+	for j, h := range p.Headings {
+		slugs[j] = s.unique(h.slug())
+	}
+	return slugs
+}
+
+// tocSections returns the indices of the page's headings listed in a table
+// of contents of the given depth, capped at maxEntries when that is
+// positive, and how many more were left out.
+func (p Page) tocSections(depth, maxEntries int) (listed []int, more int) {
+	for j, heading := range p.Headings {
+		if !heading.inTOC(depth) {
+			continue
+		}
+		if maxEntries > 0 && len(listed) >= maxEntries {
+			more++
+			continue
+		}
+		listed = append(listed, j)
+	}
+	return listed, more
+}
+
+// tocRollup is the table of contents line standing in for more left-out sections.
+func tocRollup(more int) string {
+	if more == 1 {
+		return "... and 1 more section"
+	}
+	return fmt.Sprintf("... and %d more sections", more)
+}
+
+// inTOC reports whether the heading is listed in a table of contents of the
+// given depth. h1 is the chapter itself, so only h2 and deeper are listed.
+func (h Heading) inTOC(depth int) bool {
+	return h.Level >= 2 && h.Level-1 <= depth
+}
+
+// findContainers returns the elements matched by the first selector that
+// matches anything in the document.
+func findContainers(doc *goquery.Selection, selectors []string) *goquery.Selection {
+	for _, selector := range selectors {
+		if found := doc.Find(selector); found.Length() > 0 {
+			return outermost(found)
+		}
+	}
+	return doc.Slice(0, 0)
+}
+
+// findXPathContainers returns the elements an XPath expression selects
+// from the document, for use like the CSS content selectors.
+func findXPathContainers(doc *goquery.Selection, expr *xpath.Expr) *goquery.Selection {
+	return outermost(xpathElements(doc, expr))
+}
+
+// xpathElements returns every element an XPath expression selects.
+func xpathElements(doc *goquery.Selection, expr *xpath.Expr) *goquery.Selection {
+	var elements []*html.Node
+	for _, n := range htmlquery.QuerySelectorAll(doc.Nodes[0], expr) {
+		if n.Type == html.ElementNode {
+			elements = append(elements, n)
+		}
+	}
+	return doc.Slice(0, 0).AddNodes(elements...)
+}
+
+// richestContainer picks the candidate container holding the most prose,
+// counted as words outside links so that navigation scores low. A
+// candidate nested in the winner is preferred when it holds nearly all of
+// its words, trimming surrounding chrome. The result is empty when even
+// the richest candidate has fewer than minWords words.
+func richestContainer(candidates *goquery.Selection, minWords int) *goquery.Selection {
+	scores := make([]int, candidates.Length())
+	best := -1
+	candidates.Each(func(i int, s *goquery.Selection) {
+		scores[i] = proseWords(s)
+		if best < 0 || scores[i] > scores[best] {
+			best = i
+		}
+	})
+	if best < 0 || scores[best] < minWords {
+		return candidates.Slice(0, 0)
+	}
+	for narrowed := true; narrowed; {
+		narrowed = false
+		outer := candidates.Eq(best)
+		candidates.Each(func(i int, s *goquery.Selection) {
+			if !narrowed && i != best && scores[i]*10 >= scores[best]*9 && s.ParentsFiltered("*").FilterSelection(outer).Length() > 0 {
+				best, narrowed = i, true
+			}
+		})
+	}
+	return candidates.Eq(best)
+}
+
+// proseWords counts the words in a selection that are not link text.
+func proseWords(s *goquery.Selection) int {
+	words := len(strings.Fields(s.Text()))
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		words -= len(strings.Fields(a.Text()))
+	})
+	return words
+}
+
+// outermost drops containers nested inside another matched container,
+// such as an article within a div.Article, so no content is read twice.
+func outermost(containers *goquery.Selection) *goquery.Selection {
+	return containers.FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.ParentsFiltered("*").FilterSelection(containers).Length() == 0
+	})
+}
+
+// extractOptions controls how content is read from a container.
+type extractOptions struct {
+	// MultiContainer is "split" to make every matched container its own
+	// Page, or "first"/"concat" to read the given containers as one.
+	MultiContainer string
+	// MaxHeadingDepth is the deepest heading level captured (2-6).
+	MaxHeadingDepth int
+	// ExcludeEmptyHeadings skips headings whose text is blank.
+	ExcludeEmptyHeadings bool
+	// BreadcrumbSelector matches the page's breadcrumb trail; empty disables it.
+	BreadcrumbSelector string
+	// DetectLanguage fills in each Page's Language.
+	DetectLanguage bool
+	// AnchorChars are the permalink glyphs stripped from headings; empty
+	// keeps heading text as is.
+	AnchorChars string
+	// Ctx stops extraction early when cancelled; nil never cancels.
+	Ctx context.Context
+	// Logger reports pages that fail to extract; nil discards the reports.
+	Logger *log.Logger
+	// TrimCode strips blank lines around code blocks and trailing
+	// whitespace from their lines.
+	TrimCode bool
+	// CodeTabWidth expands tabs in code blocks to this many columns; 0
+	// keeps them.
+	CodeTabWidth int
+	// ContentOrder rearranges the extracted content: dom, code-appendix or
+	// prose-first (see reorderContent).
+	ContentOrder string
+	// NoURLTitle leaves pages without any title as untitled instead of
+	// naming them after their URL.
+	NoURLTitle bool
+	// ImageMode is "embed" to record images, "alt" to put an "[Image: alt]"
+	// placeholder in the content instead, or "skip" to leave them out.
+	ImageMode string
+	// ImageWidth is the preferred pixel width when picking among srcset
+	// candidates; 0 picks the largest.
+	ImageWidth int
+	// Asides is "inline" to read <aside> content as ordinary prose, "note"
+	// to record each aside as a Note callout, or "skip" to leave them out.
+	Asides string
+	// CollapseBlankLines squeezes runs of blank lines in the content down
+	// to a single blank line.
+	CollapseBlankLines bool
+}
+
+// Extractor turns a matched content container into a Page, stopping
+// early when ctx is cancelled. The scraper fills in the URL, metadata,
+// breadcrumb and language afterwards.
+type Extractor interface {
+	Extract(ctx context.Context, e *colly.HTMLElement) (*Page, error)
+}
+
+// SelectorExtractor is the default Extractor, reading paragraphs, headings,
+// code blocks, lists and images from the container in document order.
+type SelectorExtractor struct {
+	Options extractOptions
+}
+
+// Extract implements Extractor. When e spans several containers the title
+// comes from the first one.
+func (x SelectorExtractor) Extract(ctx context.Context, e *colly.HTMLElement) (*Page, error) {
+	opts := x.Options
+	opts.Ctx = ctx
+	p, err := extractPage(e, opts)
+	if err != nil {
+		return nil, err
+	}
+	first := e.DOM.First()
+	p.Title = pageTitle(colly.NewHTMLElementFromSelectionNode(e.Response, first, first.Nodes[0], 0))
+	return &p, nil
+}
+
+// extractPages turns a page's matched content containers into Pages using
+// extractor. In split mode every container becomes its own Page, with a
+// "#n" suffix on the URL of all but the first; otherwise the containers are
+// read as one. Containers the extractor fails on are skipped.
+func extractPages(page *colly.HTMLElement, containers *goquery.Selection, extractor Extractor, opts extractOptions) []Page {
+	pageURL := page.Request.URL.String()
+	metadata := extractMetadata(page)
+	docTitle := documentTitle(page)
+	structured := extractJSONLD(page)
+	breadcrumb := extractBreadcrumb(page, opts.BreadcrumbSelector)
+
+	elements := []*colly.HTMLElement{colly.NewHTMLElementFromSelectionNode(page.Response, containers, containers.Nodes[0], 0)}
+	if opts.MultiContainer == "split" {
+		elements = elements[:0]
+		containers.Each(func(i int, s *goquery.Selection) {
+			elements = append(elements, colly.NewHTMLElementFromSelectionNode(page.Response, s, s.Nodes[0], i))
+		})
+	}
+
+	ctx := opts.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var pages []Page
+	for i, e := range elements {
+		if ctx.Err() != nil {
+			break
+		}
+		p, err := extractor.Extract(ctx, e)
+		if err != nil {
+			if opts.Logger != nil {
+				opts.Logger.Printf("Failed to extract %s: %v\n", pageURL, err)
+			}
+			continue
+		}
+		if opts.CollapseBlankLines {
+			p.Content = collapseBlankLines(p.Content)
+		}
+		reorderContent(p, opts.ContentOrder)
+		p.URL = pageURL
+		if i > 0 {
+			p.URL = fmt.Sprintf("%s#%d", pageURL, i+1)
+		}
+		p.Depth = crawlDepth(page.Request) - 1
+		p.Metadata = metadata
+		// JSON-LD only fills in what the HTML is missing
+		structured.fill(p)
+		if p.Title == untitledPage {
+			p.Title = fallbackTitle(page, opts.NoURLTitle)
+		}
+		p.DocTitle = docTitle
+		p.Breadcrumb = breadcrumb
+		if opts.DetectLanguage {
+			p.Language = detectLanguage(p.Title+" "+p.Content, page.DOM.AttrOr("lang", ""))
+		}
+		pages = append(pages, *p)
+	}
+	return pages
+}
+
+// extractWithin runs extract with opts.Ctx limited to budget, giving up
+// once it passes or opts.Ctx is cancelled. A page abandoned this way
+// yields no Pages and ok is false; its extraction sees the cancelled
+// context and stops. A zero budget waits indefinitely.
+func extractWithin(opts extractOptions, budget time.Duration, extract func(extractOptions) []Page) (pages []Page, ok bool) {
+	if budget <= 0 {
+		return extract(opts), true
+	}
+	parent := opts.Ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, budget)
+	defer cancel()
+	opts.Ctx = ctx
+
+	result := make(chan []Page, 1)
+	go func() { result <- extract(opts) }()
+	select {
+	case pages = <-result:
+		return pages, true
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// extractMetadata reads the description, author, publication and update
+// dates and canonical URL of a document, preferring standard meta tags over their
+// Open Graph and article equivalents.
+func extractMetadata(page *colly.HTMLElement) Metadata {
+	first := func(selectors ...string) string {
+		for _, selector := range selectors {
+			if value := strings.TrimSpace(page.ChildAttr(selector, "content")); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+
+	m := Metadata{
+		Description: first(`meta[name="description"]`, `meta[property="og:description"]`),
+		Author:      first(`meta[name="author"]`, `meta[property="article:author"]`),
+		Date:        first(`meta[property="article:published_time"]`, `meta[name="date"]`, `meta[itemprop="datePublished"]`),
+		Modified:    first(`meta[property="article:modified_time"]`, `meta[property="og:updated_time"]`, `meta[itemprop="dateModified"]`),
+	}
+	if m.Date == "" {
+		m.Date = strings.TrimSpace(page.ChildAttr("time[datetime]", "datetime"))
+	}
+	if canonical := page.ChildAttr(`link[rel="canonical"]`, "href"); canonical != "" {
+		m.Canonical = page.Request.AbsoluteURL(canonical)
+	}
+	return m
+}
+
+// extractBreadcrumb returns the labels of the first breadcrumb trail matched
+// by selector, read from its list items or, failing that, its links.
+func extractBreadcrumb(page *colly.HTMLElement, selector string) []string {
+	if selector == "" {
+		return nil
+	}
+	trail := page.DOM.Find(selector).First()
+	items := trail.Find("li")
+	if items.Length() == 0 {
+		items = trail.Find("a")
+	}
+	var labels []string
+	items.Each(func(_ int, item *goquery.Selection) {
+		if label := strings.Join(strings.Fields(item.Text()), " "); label != "" {
+			labels = append(labels, label)
+		}
+	})
+	return labels
+}
+
+// compareBreadcrumbs orders two trails label by label, so pages sharing a
+// parent end up next to each other. Pages without a trail sort last.
+func compareBreadcrumbs(a, b []string) int {
+	if len(a) == 0 || len(b) == 0 {
+		return len(b) - len(a)
+	}
+	return slices.Compare(a, b)
+}
+
+// untitledPage is the title of pages without a heading or other title.
+const untitledPage = "Untitled Article"
+
+// pageTitle picks the title of a content container.
+func pageTitle(e *colly.HTMLElement) string {
+	// Try different title selectors
+	title := strings.TrimSpace(e.ChildText(".Header h1, h1"))
+	if title == "" {
+		title = strings.TrimSpace(e.ChildText(".Header h2, h2"))
+	}
+	if title == "" {
+		title = untitledPage
+	}
+	return title
+}
+
+// fallbackTitle names a page whose content has no title, from the
+// document's <title> or, unless noURLTitle is set, its URL path.
+func fallbackTitle(page *colly.HTMLElement, noURLTitle bool) string {
+	if title := documentTitle(page); title != "" {
+		return title
+	}
+	if !noURLTitle {
+		if title := titleFromURL(page.Request.URL); title != "" {
+			return title
+		}
+	}
+	return untitledPage
+}
+
+// documentTitle returns the text of the document's <title>, with runs of
+// whitespace collapsed.
+func documentTitle(page *colly.HTMLElement) string {
+	return strings.Join(strings.Fields(page.DOM.Find("title").First().Text()), " ")
+}
+
+// titleFromURL derives a readable title from the last meaningful segment of
+// a URL's path, e.g. /docs/getting-started.html becomes "Getting Started".
+// Index pages are named after their directory and the site root after its host.
+func titleFromURL(u *url.URL) string {
+	segment := ""
+	for p := strings.TrimSuffix(u.Path, "/"); p != "" && p != "/"; p = path.Dir(p) {
+		segment = strings.TrimSuffix(path.Base(p), path.Ext(path.Base(p)))
+		if decoded, err := url.PathUnescape(segment); err == nil {
+			segment = decoded
+		}
+		if !strings.EqualFold(segment, "index") && !strings.EqualFold(segment, "default") {
+			break
+		}
+		segment = ""
+	}
+	if segment == "" {
+		return u.Hostname()
+	}
+	words := strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '+' || unicode.IsSpace(r) })
+	for i, word := range words {
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// extractPage extracts the title, content, headings, code blocks and links
+// from a content container. The caller fills in the URL. It stops with the
+// context's error when opts.Ctx is cancelled part way through.
+func extractPage(e *colly.HTMLElement, opts extractOptions) (Page, error) {
+	var content strings.Builder
+	var headings []Heading
+	var codeBlocks []string
+	var codeCaptions []string
+	var links []Link
+	var images []Image
+	var notes []Note
+
+	// Record prose links so they can be made clickable in the PDF
+	collectLinks := func(el *colly.HTMLElement) {
+		el.ForEach("a[href]", func(_ int, a *colly.HTMLElement) {
+			linkURL, parseErr := e.Request.URL.Parse(a.Attr("href"))
+			if parseErr == nil && strings.TrimSpace(a.Text) != "" {
+				links = append(links, Link{Text: a.Text, URL: linkURL.String()})
+			}
+		})
+	}
+
+	// Extract content and headings with better formatting
+	var cancelErr error
+	e.ForEachWithBreak("p, pre, h1, h2, h3, h4, h5, h6, ul, ol, img, aside", func(_ int, el *colly.HTMLElement) bool {
+		if opts.Ctx != nil && opts.Ctx.Err() != nil {
+			cancelErr = opts.Ctx.Err()
+			return false
+		}
+		// A noted or skipped aside takes its contents with it
+		if opts.Asides != "inline" && el.DOM.ParentsUntilSelection(e.DOM).Filter("aside").Length() > 0 {
+			return true
+		}
+		switch el.Name {
+		case "aside":
+			if opts.Asides == "note" {
+				if note := asideNote(el.DOM); note.Text != "" {
+					notes = append(notes, note)
+					content.WriteString("[Note " + fmt.Sprintf("%d", len(notes)) + "]\n\n")
+				}
+			}
+		case "h1", "h2", "h3", "h4", "h5", "h6":
+			level := int(el.Name[1] - '0')
+			if level > opts.MaxHeadingDepth {
+				return true
+			}
+			text := headingText(el.DOM, opts.AnchorChars)
+			if opts.ExcludeEmptyHeadings && strings.TrimSpace(text) == "" {
+				return true
+			}
+			headings = append(headings, Heading{Level: level, Text: text, ID: headingID(el)})
+			// h1 is the chapter title, so only deeper headings are rendered inline
+			if level >= 2 {
+				content.WriteString("[Heading " + fmt.Sprintf("%d", len(headings)) + "]\n\n")
+			}
+		case "p":
+			collectLinks(el)
+			content.WriteString(textWithBreaks(el.DOM) + "\n\n")
+		case "pre":
+			codeBlock := cleanCode(el.Text, opts.CodeTabWidth, opts.TrimCode)
+			codeBlocks = append(codeBlocks, codeBlock)
+			codeCaptions = append(codeCaptions, codeCaption(el.DOM))
+			content.WriteString("[Code Block " + fmt.Sprintf("%d", len(codeBlocks)) + "]\n\n")
+		case "ul", "ol":
+			el.ForEach("li", func(_ int, li *colly.HTMLElement) {
+				collectLinks(li)
+				content.WriteString("• " + textWithBreaks(li.DOM) + "\n")
+			})
+			content.WriteString("\n")
+		case "img":
+			alt := strings.TrimSpace(el.Attr("alt"))
+			if alt == "" {
+				// Images in a <figure> fall back to its caption
+				alt = strings.TrimSpace(el.DOM.Closest("figure").Find("figcaption").First().Text())
+			}
+			switch opts.ImageMode {
+			case "skip":
+			case "alt":
+				// Images without alt text are decorative
+				if alt != "" {
+					content.WriteString("[Image: " + alt + "]\n\n")
+				}
+			default:
+				src := e.Request.AbsoluteURL(imageSource(el.DOM, opts.ImageWidth))
+				if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+					images = append(images, Image{URL: src, Alt: alt})
+					content.WriteString("[Image " + fmt.Sprintf("%d", len(images)) + "]\n\n")
+				}
+			}
+		}
+		return true
+	})
+	if cancelErr != nil {
+		return Page{}, cancelErr
+	}
+
+	// Only keep captions when at least one block has one
+	if strings.Join(codeCaptions, "") == "" {
+		codeCaptions = nil
+	}
+
+	return Page{
+		Title:        pageTitle(e),
+		Content:      content.String(),
+		Headings:     headings,
+		Code:         codeBlocks,
+		CodeCaptions: codeCaptions,
+		Links:        links,
+		Images:       images,
+		Notes:        notes,
+	}, nil
+}
+
+// noteKinds are the aside classes that name the kind of callout.
+var noteKinds = []string{"note", "tip", "info", "important", "warning", "caution", "danger"}
+
+// asideNote reads an aside as a callout. The label is its aria-label, its
+// first heading or a kind named by its class, defaulting to "Note"; the
+// text is its paragraphs and list items, one per line.
+func asideNote(aside *goquery.Selection) Note {
+	label := strings.TrimSpace(aside.AttrOr("aria-label", ""))
+	if label == "" {
+		label = strings.TrimSpace(aside.Find("h1, h2, h3, h4, h5, h6").First().Text())
+	}
+	if label == "" {
+		class := strings.ToLower(aside.AttrOr("class", ""))
+		for _, kind := range noteKinds {
+			if strings.Contains(class, kind) {
+				label = strings.ToUpper(kind[:1]) + kind[1:]
+				break
+			}
+		}
+	}
+	if label == "" {
+		label = "Note"
+	}
+
+	var lines []string
+	aside.Find("p, li").Each(func(_ int, s *goquery.Selection) {
+		// Paragraphs inside list items are read with their item
+		if goquery.NodeName(s) == "p" && s.ParentsUntilSelection(aside).Filter("li").Length() > 0 {
+			return
+		}
+		text := strings.TrimSpace(textWithBreaks(s))
+		if text == "" {
+			return
+		}
+		if goquery.NodeName(s) == "li" {
+			text = "• " + text
+		}
+		lines = append(lines, text)
+	})
+	if len(lines) == 0 {
+		// Bare text, minus the heading used as the label
+		body := aside.Clone()
+		body.Find("h1, h2, h3, h4, h5, h6").Remove()
+		lines = strings.Fields(body.Text())
+		return Note{Label: label, Text: strings.Join(lines, " ")}
+	}
+	return Note{Label: label, Text: strings.Join(lines, "\n")}
+}
+
+// isEmpty reports whether extraction found neither text nor code in the page.
+func (p Page) isEmpty() bool {
+	return strings.TrimSpace(p.Content) == "" && len(p.Code) == 0
+}
+
+// prose returns the page's text without the heading, code block, image and
+// note markers or list bullets.
+func (p Page) prose() string {
+	return strings.ReplaceAll(p.unmarkedContent(), "• ", "")
+}
+
+// unmarkedContent returns the page's content without the heading, code
+// block, image and note markers, which the renderers replace with the
+// items they stand for.
+func (p Page) unmarkedContent() string {
+	var text []string
+	for _, para := range strings.Split(p.Content, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" || isMarker(para) {
+			continue
+		}
+		text = append(text, para)
+	}
+	return strings.Join(text, "\n\n")
+}
+
+// isMarker reports whether a content paragraph is a marker such as
+// "[Heading 2]" or "[Image 1]".
+func isMarker(para string) bool {
+	for _, prefix := range []string{"[Heading ", "[Code Block ", "[Image ", "[Note "} {
+		if strings.HasPrefix(para, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// codeCaption returns the caption of code block i, or "" when it has none.
+func (p Page) codeCaption(i int) string {
+	if i < len(p.CodeCaptions) {
+		return p.CodeCaptions[i]
+	}
+	return ""
+}
+
+// codeCaptionClass matches the class names tutorials give code block labels.
+var codeCaptionClass = regexp.MustCompile(`(?i)file-?name|caption|code-?(block-?)?title`)
+
+// codeCaption returns the filename or caption labelling a <pre> block,
+// taken from a data-filename, data-title or title attribute, the caption
+// of an enclosing <figure>, or a labelled element just before the block or
+// before the wrapper it sits in alone.
+func codeCaption(pre *goquery.Selection) string {
+	for _, attr := range []string{"data-filename", "data-title", "title"} {
+		if v := strings.TrimSpace(pre.AttrOr(attr, pre.Children().Filter("code").AttrOr(attr, ""))); v != "" {
+			return v
+		}
+	}
+	if caption := strings.TrimSpace(pre.Closest("figure").Find("figcaption").First().Text()); caption != "" {
+		return caption
+	}
+	for block := pre; block.Length() > 0; block = block.Parent() {
+		if prev := block.Prev(); prev.Length() > 0 {
+			if codeCaptionClass.MatchString(prev.AttrOr("class", "")) {
+				return strings.TrimSpace(prev.Text())
+			}
+			return ""
+		}
+		if block.Parent().Children().Length() != 1 {
+			return ""
+		}
+	}
+	return ""
+}
+
+// blankLines matches three or more line breaks, counting lines that hold
+// only spaces or tabs as blank.
+var blankLines = regexp.MustCompile(`\n[ \t]*(?:\n[ \t]*){2,}`)
+
+// collapseBlankLines leaves at most one blank line between blocks of content.
+func collapseBlankLines(content string) string {
+	return blankLines.ReplaceAllString(content, "\n\n")
+}
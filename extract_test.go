@@ -0,0 +1,637 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antchfx/xpath"
+	"github.com/gocolly/colly/v2"
+)
+
+// fakeExtractor records the text of every container it is given and
+// titles the page with it, failing on containers reading "fail".
+type fakeExtractor struct {
+	mu    sync.Mutex
+	texts []string
+}
+
+func (x *fakeExtractor) Extract(_ context.Context, e *colly.HTMLElement) (*Page, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.texts = append(x.texts, e.Text)
+	if e.Text == "fail" {
+		return nil, errors.New("cannot extract")
+	}
+	return &Page{Title: "fake " + e.Text, Content: e.Text}, nil
+}
+
+func TestWithExtractorUsedForEveryContainer(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  `<html><body><article>one</article><article>two <a href="/a">A</a></article><article>fail</article></body></html>`,
+		"/a": `<html><body><article>three</article></body></html>`,
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Extract.MultiContainer = "split"
+	fake := &fakeExtractor{}
+	pages, err := Crawl(opts, WithExtractor(fake))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := len(fake.texts), 4; got != want {
+		t.Errorf("extractor ran on %d containers %q, want %d", got, fake.texts, want)
+	}
+	var titles []string
+	for _, p := range pages {
+		titles = append(titles, p.Title)
+	}
+	// The failed container is skipped; the rest keep the extractor's titles
+	want := []string{"fake one", "fake two A", "fake three"}
+	if len(titles) != len(want) {
+		t.Fatalf("crawl returned pages %q, want %q", titles, want)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Errorf("page %d is titled %q, want %q", i, titles[i], want[i])
+		}
+	}
+}
+
+// scrapeHTML crawls a site whose only page is html, with the default
+// options changed by edit when it is not nil.
+func scrapeHTML(t testing.TB, html string, edit func(*CrawlOptions)) []Page {
+	t.Helper()
+	srv := testSite(t, map[string]string{"/page": html})
+	opts := testCrawlOptions(srv.URL + "/page")
+	if edit != nil {
+		edit(&opts)
+	}
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pages
+}
+
+// scrapeOne is scrapeHTML for a page expected to give exactly one Page.
+func scrapeOne(t testing.TB, html string, edit func(*CrawlOptions)) Page {
+	t.Helper()
+	pages := scrapeHTML(t, html, edit)
+	if len(pages) != 1 {
+		t.Fatalf("scraped %d pages, want 1", len(pages))
+	}
+	return pages[0]
+}
+
+func TestHeadingLevels(t *testing.T) {
+	p := scrapeOne(t, htmlPage("Guide", `<h2>Install</h2><p>Get it.</p><h3>From source</h3><p>Build it.</p><h2>Use</h2><p>Run it.</p>`), nil)
+	want := []Heading{{Level: 1, Text: "Guide"}, {Level: 2, Text: "Install"}, {Level: 3, Text: "From source"}, {Level: 2, Text: "Use"}}
+	if fmt.Sprint(p.Headings) != fmt.Sprint(want) {
+		t.Errorf("headings = %v, want %v", p.Headings, want)
+	}
+}
+
+func TestMultipleContainers(t *testing.T) {
+	changelog := `<html><head><title>Changelog</title></head><body>
+		<article><h2>Release 2.0</h2><p>Adds streaming.</p></article>
+		<article><h2>Release 1.0</h2><p>First release.</p></article></body></html>`
+
+	p := scrapeOne(t, changelog, func(o *CrawlOptions) { o.Extract.MultiContainer = "concat" })
+	for _, text := range []string{"Adds streaming.", "First release."} {
+		if !strings.Contains(p.Content, text) {
+			t.Errorf("-multi-container concat: content %q lacks %q", p.Content, text)
+		}
+	}
+	if len(p.Headings) != 2 {
+		t.Errorf("-multi-container concat: headings = %v, want both releases", p.Headings)
+	}
+
+	pages := scrapeHTML(t, changelog, func(o *CrawlOptions) { o.Extract.MultiContainer = "split" })
+	if len(pages) != 2 {
+		t.Fatalf("-multi-container split: scraped %d pages, want 2", len(pages))
+	}
+	if !strings.Contains(pages[0].Content, "Adds streaming.") || !strings.Contains(pages[1].Content, "First release.") {
+		t.Errorf("-multi-container split: pages %q and %q, want one release each", pages[0].Content, pages[1].Content)
+	}
+	if !strings.HasSuffix(pages[1].URL, "/page#2") || strings.Contains(pages[0].URL, "#") {
+		t.Errorf("-multi-container split: URLs %s and %s, want the second with a #2 suffix", pages[0].URL, pages[1].URL)
+	}
+
+	p = scrapeOne(t, changelog, nil)
+	if strings.Contains(p.Content, "First release.") {
+		t.Errorf("-multi-container first: content %q has the second article", p.Content)
+	}
+}
+
+func TestLineBreaksInParagraph(t *testing.T) {
+	p := scrapeOne(t, htmlPage("Contact", `<p>221B Baker Street<br>London<br/>NW1 6XE</p><p>Next paragraph.</p>`), nil)
+	if !strings.Contains(p.Content, "221B Baker Street\nLondon\nNW1 6XE") {
+		t.Errorf("content %q lost the line breaks", p.Content)
+	}
+
+	text := renderPDF(t, []Page{p}, testPDFOptions()).AllText()
+	for _, line := range []string{"221B Baker Street", "London", "NW1 6XE"} {
+		if !strings.Contains("\n"+text+"\n", "\n"+line+"\n") {
+			t.Errorf("PDF does not show %q on a line of its own:\n%s", line, text)
+		}
+	}
+}
+
+func TestMainContentSelectors(t *testing.T) {
+	for _, tc := range []struct{ name, html string }{
+		{"main", `<main role="main"><h1>Docs</h1><p>Main content.</p></main>`},
+		{"role=main", `<div role="main"><h1>Docs</h1><p>Main content.</p></div>`},
+	} {
+		p := scrapeOne(t, `<html><head><title>Docs</title></head><body><nav><p>Menu</p></nav>`+tc.html+`<div class="aside"><p>Sidebar</p></div></body></html>`, nil)
+		if !strings.Contains(p.Content, "Main content.") {
+			t.Errorf("%s: content %q lacks the main content", tc.name, p.Content)
+		}
+		if strings.Contains(p.Content, "Sidebar") || strings.Contains(p.Content, "Menu") {
+			t.Errorf("%s: content %q has text from outside the main content", tc.name, p.Content)
+		}
+	}
+
+	// An explicit selector still wins
+	p := scrapeOne(t, `<html><head><title>Docs</title></head><body><main><p>Main content.</p></main><div class="body"><p>Chosen.</p></div></body></html>`,
+		func(o *CrawlOptions) { o.ContentSelectors = []string{"div.body"} })
+	if strings.TrimSpace(p.Content) != "Chosen." {
+		t.Errorf("-content-selector div.body captured %q, want only the chosen div", p.Content)
+	}
+}
+
+func TestMaxHeadingDepth(t *testing.T) {
+	html := htmlPage("Guide", `<h2>Options</h2><p>All of them.</p><h3>Output</h3><p>Where it goes.</p><h4>Compression</h4><p>Smaller files.</p>`)
+
+	p := scrapeOne(t, html, nil)
+	want := []Heading{{Level: 1, Text: "Guide"}, {Level: 2, Text: "Options"}, {Level: 3, Text: "Output"}, {Level: 4, Text: "Compression"}}
+	if fmt.Sprint(p.Headings) != fmt.Sprint(want) {
+		t.Errorf("headings = %v, want %v", p.Headings, want)
+	}
+	// Deeper headings render in smaller type
+	sizes := make(map[string]float64)
+	pdf := renderPDF(t, []Page{p}, testPDFOptions())
+	for _, run := range pdf.Pages[pdf.find("Smaller files.")] {
+		for _, h := range want[1:] {
+			if strings.HasSuffix(run.Text, h.Text) {
+				sizes[h.Text] = run.Size
+			}
+		}
+	}
+	if !(sizes["Options"] > sizes["Output"] && sizes["Output"] > sizes["Compression"] && sizes["Compression"] > 0) {
+		t.Errorf("heading font sizes %v, want them to shrink with depth", sizes)
+	}
+
+	p = scrapeOne(t, html, func(o *CrawlOptions) { o.Extract.MaxHeadingDepth = 3 })
+	if len(p.Headings) != 3 {
+		t.Errorf("-max-heading-depth 3: headings = %v, want no h4", p.Headings)
+	}
+	if text := renderPDF(t, []Page{p}, testPDFOptions()).AllText(); strings.Contains(text, "Compression") {
+		t.Errorf("-max-heading-depth 3: PDF shows the h4:\n%s", text)
+	}
+}
+
+func TestOverlappingSelectorsGiveOnePage(t *testing.T) {
+	for _, order := range [][]string{defaultContentSelectors, {"div.Article", "article"}} {
+		pages := scrapeHTML(t, `<html><head><title>Doc</title></head><body>
+			<div class="Article"><article><h1>Doc</h1><p>Only once.</p></article></div></body></html>`,
+			func(o *CrawlOptions) {
+				o.ContentSelectors = order
+				o.Extract.MultiContainer = "concat"
+			})
+		if len(pages) != 1 {
+			t.Fatalf("selectors %v: scraped %d pages, want 1", order, len(pages))
+		}
+		if n := strings.Count(pages[0].Content, "Only once."); n != 1 {
+			t.Errorf("selectors %v: content %q has the text %d times, want once", order, pages[0].Content, n)
+		}
+	}
+}
+
+func TestStripAnchorChars(t *testing.T) {
+	html := htmlPage("Guide", `<h2>Setup¶</h2><p>One.</p>
+		<h2 id="usage">Usage <a class="headerlink" href="#usage">#</a></h2><p>Two.</p>
+		<h2>Options <a href="#options">Permalink</a></h2><p>Three.</p>
+		<h2>Learning C#</h2><p>Four.</p>`)
+	p := scrapeOne(t, html, nil)
+	var got []string
+	for _, h := range p.Headings[1:] {
+		got = append(got, h.Text)
+	}
+	if want := "Setup|Usage|Options|Learning C#"; strings.Join(got, "|") != want {
+		t.Errorf("headings = %q, want %q", strings.Join(got, "|"), want)
+	}
+
+	p = scrapeOne(t, html, func(o *CrawlOptions) { o.Extract.AnchorChars = "" })
+	if p.Headings[1].Text != "Setup¶" {
+		t.Errorf("with no -strip-anchor-chars the heading is %q, want it unchanged", p.Headings[1].Text)
+	}
+}
+
+// stallingExtractor stands in for extraction of a pathological DOM: it
+// runs until its context ends on containers of more than limit bytes of text.
+type stallingExtractor struct {
+	SelectorExtractor
+	limit int
+}
+
+func (x stallingExtractor) Extract(ctx context.Context, e *colly.HTMLElement) (*Page, error) {
+	if len(e.Text) > x.limit {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return x.SelectorExtractor.Extract(ctx, e)
+}
+
+func TestPageTimeoutSkipsSlowPages(t *testing.T) {
+	huge := strings.Repeat("<p>Row after row of generated text.</p>", 20000)
+	srv := testSite(t, map[string]string{
+		"/":     htmlPage("Home", `<p>Start here.</p><a href="/huge">Huge</a> <a href="/a">A</a>`),
+		"/huge": htmlPage("Huge", huge+`<a href="/b">B</a>`),
+		"/a":    htmlPage("A", `<p>Page A.</p>`),
+		"/b":    htmlPage("B", `<p>Page B.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxDepth = 3
+	opts.PageTimeout = 100 * time.Millisecond
+
+	start := time.Now()
+	pages, logged, err := crawlLogged(opts, WithExtractor(stallingExtractor{SelectorExtractor{opts.Extract}, 100000}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("crawl took %v, want the huge page abandoned", elapsed)
+	}
+	// The huge page is skipped, but its links are still followed
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /b /a" {
+		t.Errorf("crawl returned pages %s, want / /b /a", got)
+	}
+	if !strings.Contains(logged, "Warning: extracting "+srv.URL+"/huge took longer than") {
+		t.Errorf("no warning logged for the huge page: %q", logged)
+	}
+}
+
+// cancelAfter is a context that is cancelled once Err has been checked n
+// times, so a test can stop work part way through.
+type cancelAfter struct {
+	context.Context
+	mu     sync.Mutex
+	checks int
+	n      int
+}
+
+func (c *cancelAfter) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.checks++; c.checks > c.n {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestCancelMidExtraction(t *testing.T) {
+	var body strings.Builder
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&body, `<h2>Section %d</h2><p>Paragraph %d with <a href="/p/%d">a link</a>.</p>`, i, i, i)
+	}
+	srv := testSite(t, map[string]string{"/": htmlPage("Long", body.String())})
+	sources, err := parseLinkSources(defaultLinkSources)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := colly.NewCollector()
+	c.OnHTML("article", func(e *colly.HTMLElement) {
+		ctx := &cancelAfter{Context: context.Background(), n: 10}
+		opts := extractOptions{MaxHeadingDepth: 6}
+		if p, err := (SelectorExtractor{opts}).Extract(ctx, e); !errors.Is(err, context.Canceled) || p != nil {
+			t.Errorf("cancelled extraction returned %v, %v, want no page and context.Canceled", p, err)
+		}
+		if ctx.checks > 12 {
+			t.Errorf("extraction checked the context %d times after it was cancelled", ctx.checks-10)
+		}
+
+		if p, err := (SelectorExtractor{opts}).Extract(context.Background(), e); err != nil || !strings.Contains(p.Content, "Paragraph 99") {
+			t.Errorf("extraction without cancellation returned %v, %v, want the whole page", p, err)
+		}
+
+		ctx = &cancelAfter{Context: context.Background(), n: 10}
+		found, interrupted := pageLinks(ctx, e, e, sources, stripFragment)
+		if !interrupted || len(found) == 0 || len(found) > 11 {
+			t.Errorf("cancelled pageLinks found %d links, interrupted %v, want a few and true", len(found), interrupted)
+		}
+	})
+	if err := c.Visit(srv.URL + "/"); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crawl whose deadline passes mid-extraction drops that page and keeps the rest
+	srv = testSite(t, map[string]string{
+		"/":     htmlPage("Home", `<p>Start here.</p><a href="/huge">Huge</a>`),
+		"/huge": htmlPage("Huge", strings.Repeat("<p>Generated text.</p>", 10000)),
+	})
+	crawlOpts := testCrawlOptions(srv.URL + "/")
+	crawlOpts.Timeout = 300 * time.Millisecond
+	pages, _ := Crawl(crawlOpts, WithExtractor(stallingExtractor{SelectorExtractor{crawlOpts.Extract}, 100000}))
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/" {
+		t.Errorf("cancelled crawl returned pages %s, want /", got)
+	}
+}
+
+func TestDuplicateHeadingSlugs(t *testing.T) {
+	filler := strings.Repeat("<p>Background reading that fills the page.</p>", 60)
+	page := scrapeOne(t, htmlPage("Guide", `<h2>Install</h2><p>First steps.</p>`+filler+
+		`<h2>Install</h2><p>Second steps.</p><h2>Install 1</h2><p>Third steps.</p>`), nil)
+	slugs := page.headingSlugs()
+	if want := []string{"guide", "install", "install-1", "install-1-1"}; !slices.Equal(slugs, want) {
+		t.Fatalf("heading slugs %q, want %q", slugs, want)
+	}
+	if again := page.headingSlugs(); !slices.Equal(again, slugs) {
+		t.Errorf("heading slugs changed between calls: %q then %q", slugs, again)
+	}
+
+	// Each heading's named destination points at the page it is on
+	pdf := renderPDF(t, []Page{page}, testPDFOptions())
+	dests := pdf.namedDests()
+	for slug, text := range map[string]string{"install": "First steps.", "install-1": "Second steps.", "install-1-1": "Third steps."} {
+		if n, ok := dests[slug]; !ok || n < 0 || !strings.Contains(pdf.Text(n), text) {
+			t.Errorf("named destination %q points to page %d, want the one with %q (destinations %v)", slug, n, text, dests)
+		}
+	}
+
+	// Markdown and HTML link their TOC entries to the same distinct anchors
+	dir := t.TempDir()
+	mdPath, htmlPath := filepath.Join(dir, "out.md"), filepath.Join(dir, "out.html")
+	if err := writeMarkdown([]Page{page}, mdPath, markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "none"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeHTML([]Page{page}, htmlPath, htmlOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "none"}); err != nil {
+		t.Fatal(err)
+	}
+	md, html := string(readOutput(t, mdPath)), string(readOutput(t, htmlPath))
+	for _, slug := range slugs[1:] {
+		if !strings.Contains(md, "](#"+slug+")") {
+			t.Errorf("Markdown TOC does not link to #%s:\n%s", slug, md)
+		}
+		if !strings.Contains(html, `href="#`+slug+`"`) || !strings.Contains(html, `id="`+slug+`"`) {
+			t.Errorf("HTML lacks a TOC link to and an anchor for %s:\n%s", slug, html)
+		}
+	}
+}
+
+func TestTitleFromURL(t *testing.T) {
+	untitled := `<html><head></head><body><article><p>No title anywhere.</p></article></body></html>`
+	srv := testSite(t, map[string]string{"/docs/getting-started.html": untitled})
+	for _, noURLTitle := range []bool{false, true} {
+		opts := testCrawlOptions(srv.URL + "/docs/getting-started.html")
+		opts.Extract.NoURLTitle = noURLTitle
+		pages, err := Crawl(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "Getting Started"
+		if noURLTitle {
+			want = untitledPage
+		}
+		if len(pages) != 1 || pages[0].Title != want {
+			t.Errorf("-no-url-title=%t: got %+v, want one page titled %q", noURLTitle, pages, want)
+		}
+	}
+
+	for link, want := range map[string]string{
+		"https://example.com/docs/getting-started.html": "Getting Started",
+		"https://example.com/blog/release_notes/":       "Release Notes",
+		"https://example.com/guide/index.html":          "Guide",
+		"https://example.com/caf%C3%A9-menu":            "Café Menu",
+		"https://example.com/":                          "example.com",
+	} {
+		u, err := url.Parse(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := titleFromURL(u); got != want {
+			t.Errorf("titleFromURL(%s) = %q, want %q", link, got, want)
+		}
+	}
+}
+
+func TestExcludeEmptyHeadings(t *testing.T) {
+	html := htmlPage("Guide", `<h2>Install</h2><p>Get it.</p><h2> </h2><p>Decoration above.</p>
+		<h2><a href="#x">¶</a></h2><p>Anchor only above.</p><h2>Usage</h2><p>Run it.</p>`)
+	for _, exclude := range []bool{false, true} {
+		page := scrapeOne(t, html, func(opts *CrawlOptions) { opts.Extract.ExcludeEmptyHeadings = exclude })
+		var headings []string
+		for _, h := range page.Headings {
+			headings = append(headings, h.Text)
+		}
+		want := []string{"Guide", "Install", "", "", "Usage"}
+		if exclude {
+			want = []string{"Guide", "Install", "Usage"}
+		}
+		if !slices.Equal(headings, want) {
+			t.Errorf("-exclude-empty-headings=%t: headings %q, want %q", exclude, headings, want)
+		}
+		if !exclude {
+			continue
+		}
+
+		pdf := renderPDF(t, []Page{page}, testPDFOptions())
+		if got, want := pdf.bookmarks(), []string{"1. Guide", "Install", "Usage"}; !slices.Equal(got, want) {
+			t.Errorf("-exclude-empty-headings: bookmarks %q, want %q", got, want)
+		}
+		if toc := pdf.Text(0); !strings.Contains(toc, "1.1. Install\n") || !strings.Contains(toc, "1.2. Usage") || strings.Contains(toc, "1.3.") {
+			t.Errorf("-exclude-empty-headings: TOC lists empty headings:\n%s", toc)
+		}
+		if text := pdf.AllText(); !strings.Contains(text, "Decoration above.") || !strings.Contains(text, "Anchor only above.") {
+			t.Errorf("-exclude-empty-headings dropped the text after empty headings:\n%s", text)
+		}
+	}
+}
+
+func TestContentXPath(t *testing.T) {
+	html := `<html><head><title>Guide</title></head><body>
+		<div class="sidebar"><h2>Links</h2><p>Elsewhere.</p></div>
+		<div class="post" data-kind="doc"><h1>Guide</h1><p>Intro.</p><h2>Install</h2><pre>make install</pre><p>Done.</p></div>
+		</body></html>`
+	scrapeWith := func(edit func(*CrawlOptions)) Page {
+		return scrapeOne(t, html, func(opts *CrawlOptions) {
+			opts.FallbackSelector = ""
+			edit(opts)
+		})
+	}
+	css := scrapeWith(func(opts *CrawlOptions) { opts.ContentSelectors = []string{`div.post`} })
+	for _, expr := range []string{
+		`//div[@class="post"]`,
+		`//div[@data-kind="doc"]`,
+		// Something CSS cannot say: the div holding an Install heading
+		`//div[h2[normalize-space(.)="Install"]]`,
+	} {
+		compiled, err := xpath.Compile(expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page := scrapeWith(func(opts *CrawlOptions) {
+			opts.ContentSelectors = nil
+			opts.ContentXPath = compiled
+		})
+		if page.Title != css.Title || page.Content != css.Content || !slices.Equal(page.Code, css.Code) || !slices.Equal(page.Headings, css.Headings) {
+			t.Errorf("-content-xpath %s extracted\n%+v\nwant the same as -content-selector div.post\n%+v", expr, page, css)
+		}
+	}
+	if strings.Contains(css.Content, "Elsewhere.") || !strings.Contains(css.Content, "Intro.") {
+		t.Errorf("div.post extracted %q", css.Content)
+	}
+}
+
+func TestNestedContainersReadOnce(t *testing.T) {
+	// A post whose comments are articles too, inside a div.Article wrapper
+	html := `<html><head><title>Post</title></head><body><div class="Article"><article><h1>Post</h1><p>The post body.</p>
+		<section><article><p>A reader's comment.</p></article><article><p>Another comment.</p></article></section>
+		</article></div></body></html>`
+	xpathSelector, err := xpath.Compile(`//article | //div[@class="Article"]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, edit := range map[string]func(*CrawlOptions){
+		"first":  func(o *CrawlOptions) {},
+		"concat": func(o *CrawlOptions) { o.Extract.MultiContainer = "concat" },
+		"split":  func(o *CrawlOptions) { o.Extract.MultiContainer = "split" },
+		"wrapper first": func(o *CrawlOptions) {
+			o.ContentSelectors = []string{"div.Article, article"}
+			o.Extract.MultiContainer = "concat"
+		},
+		"xpath": func(o *CrawlOptions) {
+			o.ContentSelectors, o.ContentXPath = nil, xpathSelector
+			o.Extract.MultiContainer = "split"
+		},
+	} {
+		pages := scrapeHTML(t, html, edit)
+		if len(pages) != 1 {
+			t.Errorf("%s: scraped %d pages, want 1", name, len(pages))
+			continue
+		}
+		for _, text := range []string{"The post body.", "A reader's comment.", "Another comment."} {
+			if n := strings.Count(pages[0].Content, text); n != 1 {
+				t.Errorf("%s: content has %q %d times, want once:\n%s", name, text, n, pages[0].Content)
+			}
+		}
+		if n := strings.Count(renderPDF(t, pages, testPDFOptions()).AllText(), "The post body."); n != 1 {
+			t.Errorf("%s: PDF shows the post %d times, want once", name, n)
+		}
+	}
+}
+
+func TestContentMinWordsPicksRichestContainer(t *testing.T) {
+	html := `<html><head><title>Guide</title></head><body>
+		<div class="content"><ul><li><a href="#home">Home</a></li><li><a href="#docs">Docs</a></li><li><a href="#about">About us and more</a></li></ul></div>
+		<div class="content"><h1>Guide</h1><p>This is the real article with plenty of words to read through.</p></div>
+		</body></html>`
+	scrape := func(minWords int) Page {
+		return scrapeOne(t, html, func(opts *CrawlOptions) {
+			opts.ContentSelectors = []string{".content"}
+			opts.ContentMinWords = minWords
+		})
+	}
+	if page := scrape(0); strings.Contains(page.Content, "real article") {
+		t.Errorf("-content-min-words 0: took %q, want the first match", page.Content)
+	}
+	if page := scrape(5); !strings.Contains(page.Content, "real article") || strings.Contains(page.Content, "About us") {
+		t.Errorf("-content-min-words 5: took %q, want the article", page.Content)
+	}
+
+	// A candidate holding nearly all of a wrapper's words is preferred over it
+	wrapped := `<html><head><title>Guide</title></head><body><main><p>Share</p>
+		<article><h1>Guide</h1><p>` + strings.Repeat("Plenty of words here. ", 10) + `</p></article></main></body></html>`
+	page := scrapeOne(t, wrapped, func(opts *CrawlOptions) { opts.ContentMinWords = 5 })
+	if strings.Contains(page.Content, "Share") || !strings.Contains(page.Content, "Plenty of words") {
+		t.Errorf("-content-min-words with a wrapper took %q, want the article inside it", page.Content)
+	}
+
+	// Too few words anywhere leaves only the fallback
+	page = scrapeOne(t, html, func(opts *CrawlOptions) {
+		opts.ContentSelectors = []string{".content"}
+		opts.ContentMinWords = 100
+	})
+	if !strings.Contains(page.Content, "real article") || !strings.Contains(page.Content, "About us") {
+		t.Errorf("-content-min-words 100: took %q, want the body fallback", page.Content)
+	}
+}
+
+func TestCollapseBlankLines(t *testing.T) {
+	html := htmlPage("Gaps", `<p>First.</p><p></p><p> </p><p>&nbsp;</p><ul></ul><p>Second.</p><p></p><pre>code</pre><p></p><p></p><p>Third.</p>`)
+	for _, collapse := range []bool{false, true} {
+		page := scrapeOne(t, html, func(opts *CrawlOptions) { opts.Extract.CollapseBlankLines = collapse })
+		gaps := blankLines.MatchString(page.Content)
+		if gaps == collapse {
+			t.Errorf("-collapse-consecutive-blank-lines=%t: content has runs of blank lines: %v\n%q", collapse, gaps, page.Content)
+		}
+		if got := strings.Fields(page.Content); !slices.Equal(got, []string{"First.", "Second.", "[Code", "Block", "1]", "Third."}) {
+			t.Errorf("-collapse-consecutive-blank-lines=%t: content %q, want every block kept", collapse, page.Content)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"a\n\n\n\nb":         "a\n\nb",
+		"a\n \t\n\n  \nb":    "a\n\nb",
+		"a\n\nb\n\n\n":       "a\n\nb\n\n",
+		"line one\nline two": "line one\nline two",
+	} {
+		if got := collapseBlankLines(in); got != want {
+			t.Errorf("collapseBlankLines(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestAsideNotes(t *testing.T) {
+	html := htmlPage("Caching", `<p>Before the tip.</p><aside class="callout tip"><p>Use the cache.</p><ul><li>It is fast.</li></ul></aside><p>After the tip.</p>`)
+	scrape := func(mode string) Page {
+		return scrapeOne(t, html, func(opts *CrawlOptions) { opts.Extract.Asides = mode })
+	}
+
+	page := scrape("note")
+	if want := []Note{{Label: "Tip", Text: "Use the cache.\n• It is fast."}}; !slices.Equal(page.Notes, want) {
+		t.Errorf("-asides note: notes %+v, want %+v", page.Notes, want)
+	}
+	if got := strings.Fields(page.Content); !slices.Equal(got, strings.Fields("Before the tip. [Note 1] After the tip.")) {
+		t.Errorf("-asides note: content %q, want the note between the paragraphs", page.Content)
+	}
+	pdf := renderPDF(t, []Page{page}, testPDFOptions())
+	var label, text bool
+	for _, runs := range pdf.Pages {
+		for _, run := range runs {
+			label = label || run.Text == "Tip" && run.Font == "Helvetica-Bold"
+			text = text || run.Text == "Use the cache."
+		}
+	}
+	if !label || !text {
+		t.Errorf("-asides note: PDF lacks the labelled note:\n%s", pdf.AllText())
+	}
+	path := filepath.Join(t.TempDir(), "out.md")
+	if err := writeMarkdown([]Page{page}, path, markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start"}); err != nil {
+		t.Fatal(err)
+	}
+	if md := string(readOutput(t, path)); !strings.Contains(md, "Before the tip.\n\n> **Tip**\n>\n> Use the cache.\n> - It is fast.\n\nAfter the tip.") {
+		t.Errorf("-asides note: Markdown lacks the labelled blockquote:\n%s", md)
+	}
+
+	page = scrape("skip")
+	if strings.Contains(page.Content, "cache") || len(page.Notes) != 0 {
+		t.Errorf("-asides skip: content %q with notes %+v, want the aside left out", page.Content, page.Notes)
+	}
+	if text := renderPDF(t, []Page{page}, testPDFOptions()).AllText(); strings.Contains(text, "Use the cache.") {
+		t.Errorf("-asides skip: PDF shows the aside:\n%s", text)
+	}
+
+	page = scrape("inline")
+	if !strings.Contains(page.Content, "Use the cache.") || len(page.Notes) != 0 {
+		t.Errorf("-asides inline: content %q with notes %+v, want the aside read as prose", page.Content, page.Notes)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// contentMarker matches a paragraph standing in for a heading, code block,
+// image or note, such as "[Heading 2]".
+var contentMarker = regexp.MustCompile(`^\[(Heading|Code Block|Image|Note) \d+\]$`)
+
+// contentMarkers returns content's marker paragraphs in order.
+func contentMarkers(content string) []string {
+	var markers []string
+	for _, para := range strings.Split(content, "\n\n") {
+		if para = strings.TrimSpace(para); contentMarker.MatchString(para) {
+			markers = append(markers, para)
+		}
+	}
+	return markers
+}
+
+// filterContent pipes a page's content through command, run by sh, and
+// returns what it writes to stdout. The page's URL and title are passed
+// in the PAGE_URL and PAGE_TITLE environment variables. Output that drops,
+// reorders or alters any marker paragraph is an error, since the markers
+// tie the content to the page's headings, code blocks, images and notes.
+func filterContent(ctx context.Context, command string, p Page) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = append(os.Environ(), "PAGE_URL="+p.URL, "PAGE_TITLE="+p.Title)
+	cmd.Stdin = strings.NewReader(p.Content)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", err
+	}
+	if !slices.Equal(contentMarkers(stdout.String()), contentMarkers(p.Content)) {
+		return "", fmt.Errorf("output does not keep the content's [Heading N]-style marker paragraphs")
+	}
+	return stdout.String(), nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentFilterCmd(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Colours", `<p>The colour of the sky.</p><h2>Mixing</h2><p>Mix each colour well.</p><pre><code>paint()</code></pre>`),
+	})
+	const original = "The colour of the sky.\n\n[Heading 2]\n\nMix each colour well.\n\n[Code Block 1]"
+	for _, tc := range []struct {
+		name, cmd, want string
+		warning         string
+	}{
+		{"rewrite", "sed s/colour/color/g", "The color of the sky.\n\n[Heading 2]\n\nMix each color well.\n\n[Code Block 1]", ""},
+		{"environment", `sed "s|sky|$PAGE_TITLE|"`, "The colour of the Colours.\n\n[Heading 2]\n\nMix each colour well.\n\n[Code Block 1]", ""},
+		{"altered markers", "tr a-z A-Z", original, "marker paragraphs"},
+		{"dropped markers", "grep colour", original, "marker paragraphs"},
+		{"failure", "echo broken >&2; exit 3", original, "exit status 3: broken"},
+	} {
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.ContentFilterCmd = tc.cmd
+		pages, logged, err := crawlLogged(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pages) != 1 {
+			t.Fatalf("%s: got %d pages, want 1", tc.name, len(pages))
+		}
+		if got := strings.TrimSpace(pages[0].Content); got != tc.want {
+			t.Errorf("%s: content %q, want %q", tc.name, got, tc.want)
+		}
+		if want := contentHash(pages[0]); pages[0].Checksum != want {
+			t.Errorf("%s: checksum %s is not of the filtered content (%s)", tc.name, pages[0].Checksum, want)
+		}
+		if tc.warning == "" && strings.Contains(logged, "Warning:") {
+			t.Errorf("%s: unexpected warning:\n%s", tc.name, logged)
+		}
+		if tc.warning != "" && (!strings.Contains(logged, "-content-filter-cmd failed") || !strings.Contains(logged, tc.warning)) {
+			t.Errorf("%s: warning does not mention %q:\n%s", tc.name, tc.warning, logged)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfFonts are the font families used for each text role.
+type pdfFonts struct {
+	Body    string
+	Heading string
+	Code    string
+}
+
+// coreFonts are the standard PDF fonts, which need no font file.
+var coreFonts = map[string]string{
+	"arial":     "Arial",
+	"helvetica": "Helvetica",
+	"times":     "Times",
+	"courier":   "Courier",
+}
+
+// ttfStyleSuffixes are the file name suffixes looked for next to a TTF
+// font for its bold and italic variants.
+var ttfStyleSuffixes = map[string]string{"B": "-Bold", "I": "-Italic"}
+
+// checkFont reports whether spec names a core font or an existing TTF file.
+func checkFont(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	if _, ok := coreFonts[strings.ToLower(spec)]; ok {
+		return nil
+	}
+	if !strings.EqualFold(filepath.Ext(spec), ".ttf") {
+		return fmt.Errorf("unknown font %q: expected Arial, Helvetica, Times, Courier or a .ttf file", spec)
+	}
+	if _, err := os.Stat(spec); err != nil {
+		return fmt.Errorf("font file %s: %w", spec, err)
+	}
+	return nil
+}
+
+// loadFont makes the font named by spec available to pdf in the given
+// styles ("", "B", "I") and returns its family name, or fallback when spec
+// is empty. A TTF file's bold and italic styles come from "Name-Bold.ttf"
+// and "Name-Italic.ttf" beside it when present, and from the regular file
+// otherwise. Only the styles asked for are embedded.
+func loadFont(pdf *gofpdf.Fpdf, spec, fallback string, styles ...string) (string, error) {
+	if spec == "" {
+		return fallback, nil
+	}
+	if family, ok := coreFonts[strings.ToLower(spec)]; ok {
+		return family, nil
+	}
+	if err := checkFont(spec); err != nil {
+		return "", err
+	}
+
+	base := strings.TrimSuffix(spec, filepath.Ext(spec))
+	family := filepath.Base(base)
+	regular, err := os.ReadFile(spec)
+	if err != nil {
+		return "", err
+	}
+	for _, style := range styles {
+		data := regular
+		if suffix, ok := ttfStyleSuffixes[style]; ok {
+			if variant, err := os.ReadFile(base + suffix + filepath.Ext(spec)); err == nil {
+				data = variant
+			}
+		}
+		pdf.AddUTF8FontFromBytes(family, style, data)
+	}
+	if err := pdf.Error(); err != nil {
+		return "", fmt.Errorf("font %s: %w", spec, err)
+	}
+	return family, nil
+}
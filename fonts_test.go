@@ -0,0 +1,47 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCodeFont(t *testing.T) {
+	pages := []Page{{
+		Title:    "Fonts",
+		URL:      "https://example.com/fonts",
+		Headings: []Heading{{Level: 2, Text: "Example"}},
+		Code:     []string{"fmt.Println(x)"},
+		Content:  "[Heading 1]\n\nSome prose.\n\n[Code Block 1]",
+	}}
+	opts := testPDFOptions()
+	opts.TOCPosition = "none"
+	opts.CodeFont = "Times"
+	opts.HeadingFont = "courier"
+	pdf := renderPDF(t, pages, opts)
+
+	fonts := make(map[string]string)
+	for _, run := range pdf.Pages[0] {
+		fonts[run.Text] = run.Font
+	}
+	for text, want := range map[string]string{
+		"fmt.Println(x)": "Times-Roman",
+		"Some prose.":    "Helvetica",
+		"Example":        "Courier-Bold",
+	} {
+		if fonts[text] != want {
+			t.Errorf("%q rendered in %q, want %s", text, fonts[text], want)
+		}
+	}
+
+	// Fonts that are neither core fonts nor existing TTF files are rejected
+	for _, spec := range []string{"Comic Sans", filepath.Join(t.TempDir(), "missing.ttf")} {
+		opts.CodeFont = spec
+		if err := checkFont(spec); err == nil {
+			t.Errorf("checkFont accepted %q", spec)
+		}
+		if err := writePDF(pages, filepath.Join(t.TempDir(), "out.pdf"), opts); err == nil || !strings.Contains(err.Error(), "font") {
+			t.Errorf("writePDF with -code-font %q returned %v, want a font error", spec, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// depthOffsetKey is the request context key holding how many levels deep
+// a resumed request really is, since colly restarts depths at 1.
+const depthOffsetKey = "depthOffset"
+
+// crawlDepth returns the request's depth counted from the start URL of
+// the original crawl, resumed or not.
+func crawlDepth(r *colly.Request) int {
+	offset, _ := strconv.Atoi(r.Ctx.Get(depthOffsetKey))
+	return r.Depth + offset
+}
+
+// frontier tracks the URLs queued for fetching but not yet fetched, so an
+// interrupted crawl can be resumed later. It is safe for concurrent use.
+type frontier struct {
+	mu      sync.Mutex
+	pending map[string]int // URL -> crawl depth it was queued at
+}
+
+// frontierFile is the saved form of a frontier: the URLs already
+// scraped and the ones still to fetch, along with the scraped pages and
+// the links between them so a resumed run's output still holds them.
+type frontierFile struct {
+	Visited []string            `json:"visited"`
+	Pending []frontierPending   `json:"pending"`
+	Pages   []Page              `json:"pages"`
+	Links   map[string][]string `json:"links,omitempty"`
+}
+
+type frontierPending struct {
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+}
+
+func newFrontier() *frontier {
+	return &frontier{pending: make(map[string]int)}
+}
+
+// queue records that u is about to be requested at the given depth.
+func (f *frontier) queue(u string, depth int) {
+	f.mu.Lock()
+	f.pending[u] = depth
+	f.mu.Unlock()
+}
+
+// done records that u has been fetched, successfully or not.
+func (f *frontier) done(u string) {
+	f.mu.Lock()
+	delete(f.pending, u)
+	f.mu.Unlock()
+}
+
+// len returns the number of URLs queued but not yet fetched.
+func (f *frontier) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pending)
+}
+
+// move follows a redirect, keeping the queued depth for the new URL.
+func (f *frontier) move(from, to string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if depth, ok := f.pending[from]; ok {
+		delete(f.pending, from)
+		f.pending[to] = depth
+	}
+}
+
+// loadFrontier reads a frontier file, marking its visited URLs in visited
+// and its links in links, and returns it for the pending URLs and pages.
+// A missing file yields nothing to resume.
+func loadFrontier(path string, visited *visitedSet, links *linkGraph) (frontierFile, error) {
+	var saved frontierFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return saved, nil
+	}
+	if err != nil {
+		return saved, err
+	}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return frontierFile{}, fmt.Errorf("invalid frontier file %s: %w", path, err)
+	}
+	for _, u := range saved.Visited {
+		visited.claim(u)
+	}
+	for from, targets := range saved.Links {
+		for _, to := range targets {
+			links.add(from, to)
+		}
+	}
+	return saved, nil
+}
+
+// save writes the frontier with every visited URL and scraped page that
+// isn't pending again, and the links found so far. Once nothing is
+// pending the crawl is complete and the file is removed, so the next run
+// starts afresh; save reports whether it was.
+func (f *frontier) save(path string, visited *visitedSet, pages []Page, links *linkGraph) (complete bool, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.pending) == 0 {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return false, err
+		}
+		return true, nil
+	}
+
+	saved := frontierFile{Visited: []string{}, Pages: []Page{}, Links: links.list()}
+	for _, u := range visited.list() {
+		if _, ok := f.pending[u]; !ok {
+			saved.Visited = append(saved.Visited, u)
+		}
+	}
+	// Pages fetched again on resume are extracted again then
+	for _, p := range pages {
+		if _, ok := f.pending[stripFragment(p.URL)]; !ok {
+			saved.Pages = append(saved.Pages, p)
+		}
+	}
+	for u, depth := range f.pending {
+		saved.Pending = append(saved.Pending, frontierPending{URL: u, Depth: depth})
+	}
+	sort.Slice(saved.Pending, func(i, j int) bool { return saved.Pending[i].URL < saved.Pending[j].URL })
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	return false, os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestFrontierResume stops a crawl on -timeout while a page is being
+// fetched, leaving it and the rest of the start page's links queued, and
+// checks that the next run fetches only what was left and still returns
+// every page.
+func TestFrontierResume(t *testing.T) {
+	site := map[string]string{
+		"/":     htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/slow">Slow</a> <a href="/c">C</a>`),
+		"/a":    htmlPage("A", `<p>Page A.</p>`),
+		"/slow": htmlPage("Slow", `<p>Takes a while.</p>`),
+		"/c":    htmlPage("C", `<p>Page C.</p>`),
+	}
+	var slow atomic.Bool
+	slow.Store(true)
+	var mu sync.Mutex
+	var fetched []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := site[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/slow" && slow.Load() {
+			time.Sleep(300 * time.Millisecond)
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	takeFetched := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+		got := strings.Join(fetched, " ")
+		fetched = nil
+		return got
+	}
+
+	path := filepath.Join(t.TempDir(), "frontier.json")
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Frontier = path
+	opts.Timeout = 150 * time.Millisecond
+
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /a" {
+		t.Fatalf("first run scraped %s, want / /a", got)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("first run saved no frontier: %v", err)
+	}
+	takeFetched()
+
+	slow.Store(false)
+	opts.Timeout = 30 * time.Second
+	pages, err = Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The start page's links weren't all queued, so it is fetched again
+	// along with the slow page; the page scraped in full is restored instead
+	if got := takeFetched(); got != "/ /slow /c" {
+		t.Errorf("second run fetched %s, want / /slow /c", got)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/a / /slow /c" {
+		t.Errorf("second run returned %s, want /a / /slow /c", got)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("frontier still exists after the crawl completed: %v", err)
+	}
+}
+
+// TestFrontierResumeKeepsReachablePages checks that pages restored from the
+// frontier still count as reachable through links found in earlier runs.
+func TestFrontierResumeKeepsReachablePages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontier.json")
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a>`),
+		"/a": htmlPage("A", `<p>Page A.</p><a href="/b">B</a>`),
+		"/b": htmlPage("B", `<p>Page B.</p>`),
+	})
+	visited := newVisitedSet()
+	for _, u := range []string{"/", "/a"} {
+		visited.claim(srv.URL + u)
+	}
+	links := newLinkGraph()
+	links.add(srv.URL+"/", srv.URL+"/a")
+	links.add(srv.URL+"/a", srv.URL+"/b")
+	queued := newFrontier()
+	queued.queue(srv.URL+"/b", 3)
+	saved := []Page{{Title: "Home", URL: srv.URL + "/", Content: "Start here."}, {Title: "A", URL: srv.URL + "/a", Content: "Page A."}}
+	if _, err := queued.save(path, visited, saved, links); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Frontier = path
+	opts.MaxDepth = 3
+	opts.ReachableFrom = srv.URL + "/"
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /a /b" {
+		t.Errorf("resumed crawl returned %s, want / /a /b", got)
+	}
+}
+
+func TestFrontierSaveAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frontier.json")
+	visited := newVisitedSet()
+	f := newFrontier()
+	for _, u := range []string{"/", "/a", "/old"} {
+		visited.claim(u)
+		f.queue(u, 2)
+	}
+	f.done("/")
+	f.done("/a")
+	f.move("/old", "/new")
+	if n := f.len(); n != 1 {
+		t.Errorf("frontier holds %d queued URLs, want 1", n)
+	}
+
+	pages := []Page{{URL: "/"}, {URL: "/a"}}
+	if complete, err := f.save(path, visited, pages, newLinkGraph()); err != nil || complete {
+		t.Fatalf("save with a URL pending returned %v, %v, want an incomplete crawl", complete, err)
+	}
+	resumed := newVisitedSet()
+	saved, err := loadFrontier(path, resumed, newLinkGraph())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Pending) != 1 || saved.Pending[0] != (frontierPending{URL: "/new", Depth: 2}) {
+		t.Errorf("resumed pending URLs %+v, want /new at depth 2", saved.Pending)
+	}
+	if len(saved.Pages) != 2 {
+		t.Errorf("resumed %d pages, want the 2 already scraped", len(saved.Pages))
+	}
+	// Pages fetched before the interruption are not fetched again
+	for _, u := range []string{"/", "/a"} {
+		if !resumed.has(u) {
+			t.Errorf("resumed crawl would fetch %s again", u)
+		}
+	}
+
+	// Once nothing is pending the file is removed
+	f.done("/new")
+	if complete, err := f.save(path, visited, pages, newLinkGraph()); err != nil || !complete {
+		t.Errorf("save with nothing pending returned %v, %v, want a complete crawl", complete, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("frontier file still exists after the crawl completed: %v", err)
+	}
+	if saved, err := loadFrontier(path, newVisitedSet(), newLinkGraph()); err != nil || len(saved.Pending) != 0 {
+		t.Errorf("loading a missing frontier returned %v, %v, want nothing to resume", saved.Pending, err)
+	}
+}
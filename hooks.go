@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net/http"
+)
+
+// CrawlProgress is a snapshot of the crawl taken when a page is finalized.
+type CrawlProgress struct {
+	Pages    int // pages scraped so far, this one included
+	Queued   int // URLs queued but not yet fetched
+	Requests int // requests made so far, retries included
+	Errors   int // failed requests so far
+}
+
+// PageScrapedFunc is called once per page after it has been extracted,
+// filtered and redacted, in the order pages are added to the document.
+// With ReachableFrom or Dedupe set, pages can still be dropped or have
+// boilerplate stripped once the crawl is over, so the calls are held back
+// until then and made for the pages Crawl returns, in their final order.
+// Calls are serialized, so hooks need no locking of their own.
+type PageScrapedFunc func(Page, CrawlProgress)
+
+// CrawlOption customizes a crawl beyond its CrawlOptions, such as the
+// hooks main streams JSON Lines output through.
+type CrawlOption func(*CrawlOptions)
+
+// WithOnPageScraped calls fn for every page as it is finalized. Given more
+// than once, the hooks run in the order they were added.
+func WithOnPageScraped(fn PageScrapedFunc) CrawlOption {
+	return func(o *CrawlOptions) {
+		o.onPageScraped = append(o.onPageScraped, fn)
+	}
+}
+
+// WithExtractor reads each matched content container with e instead of
+// the default SelectorExtractor.
+func WithExtractor(e Extractor) CrawlOption {
+	return func(o *CrawlOptions) {
+		o.extractor = e
+	}
+}
+
+// WithHTTPClient sends the crawl's requests through client's transport
+// instead of one built from the options, so the caller can reuse it for
+// later requests, such as image downloads, with the same TLS, proxy, host
+// and User-Agent settings.
+func WithHTTPClient(client *http.Client) CrawlOption {
+	return func(o *CrawlOptions) {
+		o.client = client
+	}
+}
+
+// WithLogger reports the crawl's progress, such as each URL visited,
+// retries, skipped pages and the final statistics, to logger. Without it
+// Crawl logs nothing.
+func WithLogger(logger *log.Logger) CrawlOption {
+	return func(o *CrawlOptions) {
+		o.logger = logger
+	}
+}
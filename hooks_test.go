@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestWithOnPageScraped(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a>`),
+		"/a": htmlPage("A", `<p>Page A.</p><a href="/b">B</a>`),
+		"/b": htmlPage("B", `<p>Page B.</p>`),
+	})
+
+	var seen []Page
+	var progress []CrawlProgress
+	var second int
+	pages, err := Crawl(testCrawlOptions(srv.URL+"/"),
+		WithOnPageScraped(func(p Page, pr CrawlProgress) {
+			seen = append(seen, p)
+			progress = append(progress, pr)
+		}),
+		WithOnPageScraped(func(Page, CrawlProgress) { second++ }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != len(pages) || len(pages) != 3 {
+		t.Fatalf("hook ran %d times for %d pages, want 3 for 3", len(seen), len(pages))
+	}
+	if second != len(pages) {
+		t.Errorf("second hook ran %d times, want %d", second, len(pages))
+	}
+	for i, pr := range progress {
+		if pr.Pages != i+1 {
+			t.Errorf("call %d reported %d pages so far, want %d", i, pr.Pages, i+1)
+		}
+		if pr.Requests < pr.Pages {
+			t.Errorf("call %d reported %d requests for %d pages", i, pr.Requests, pr.Pages)
+		}
+		if seen[i].Checksum == "" {
+			t.Errorf("hook got %s before it was finalized", seen[i].URL)
+		}
+	}
+}
+
+func TestOnPageScrapedAfterPruningAndDedupe(t *testing.T) {
+	const footer = `<p>Copyright Acme. All rights reserved.</p>`
+	srv := testSite(t, map[string]string{
+		"/":       htmlPage("Home", `<p>Start here.</p><a href="/docs/">Docs</a> <a href="/other">Other</a>`+footer),
+		"/docs/":  htmlPage("Docs", `<p>Docs.</p><a href="/docs/a">A</a>`+footer),
+		"/docs/a": htmlPage("Docs A", `<p>Page A.</p>`+footer),
+		"/other":  htmlPage("Other", `<p>Other.</p>`+footer),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.MaxDepth = 3
+	opts.ReachableFrom = srv.URL + "/docs/"
+	opts.Dedupe = true
+
+	var seen []Page
+	var progress []CrawlProgress
+	pages, err := Crawl(opts, WithOnPageScraped(func(p Page, pr CrawlProgress) {
+		seen = append(seen, p)
+		progress = append(progress, pr)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The hook sees exactly the pages returned, pruned and deduplicated
+	if got, want := strings.Join(pageURLs(seen, srv.URL), " "), strings.Join(pageURLs(pages, srv.URL), " "); got != want || want != "/docs/ /docs/a" {
+		t.Errorf("hook saw %s, want the returned pages /docs/ /docs/a", got)
+	}
+	for i, p := range seen {
+		if strings.Contains(p.Content, "Copyright") {
+			t.Errorf("hook saw %s with its boilerplate: %q", p.URL, p.Content)
+		}
+		if progress[i].Pages != i+1 {
+			t.Errorf("call %d reported %d pages so far, want %d", i, progress[i].Pages, i+1)
+		}
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+
+	_, logged, err := crawlLogged(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged, "Visiting "+srv.URL+"/") || !strings.Contains(logged, "Scraped 1 pages") {
+		t.Errorf("logger got %q, want the crawl's progress", logged)
+	}
+
+	// Without a logger nothing reaches standard output or the log package
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	log.SetOutput(w)
+	_, err = Crawl(opts)
+	os.Stdout = stdout
+	log.SetOutput(os.Stderr)
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := io.ReadAll(r); len(out) > 0 {
+		t.Errorf("crawl without a logger printed %q", out)
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// htmlStyle keeps the HTML output readable without external stylesheets.
+const htmlStyle = `body { font-family: sans-serif; max-width: 50em; margin: 2em auto; padding: 0 1em; line-height: 1.5; }
+pre { background: #f0f0f0; padding: 0.75em; overflow-x: auto; }
+figure { margin: 1em 0; }
+figcaption { font-weight: bold; font-size: 0.9em; background: #dcdcdc; padding: 0.25em 0.75em; }
+img { max-width: 100%; }
+aside.note { background: #e1ebf5; border: 1px solid #96afc8; padding: 0.5em 0.75em; margin: 1em 0; }
+.source { font-style: italic; font-size: 0.9em; }`
+
+// htmlOptions controls how scraped pages are laid out as HTML.
+type htmlOptions struct {
+	TOCDepth int
+	// TOCTitle heads the table of contents; TOCPosition places it at the
+	// "start" or "end" of the document, or "none" to leave it out.
+	TOCTitle    string
+	TOCPosition string
+	// MaxTOCEntries caps the sections listed per chapter; 0 lists all.
+	MaxTOCEntries int
+	Numbering     string
+	NoSource      bool
+	BOM           bool
+	// InlineImages embeds each image as a data: URI from Images, so the
+	// file needs no external assets. Images that failed to download are
+	// replaced by their alt text.
+	InlineImages bool
+	Images       *imageCache
+}
+
+// writeHTML renders the pages as a single HTML document: a table of
+// contents followed by a section per page.
+func writeHTML(pages []Page, path string, opts htmlOptions) error {
+	f, err := createTextFile(path, opts.BOM)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	writeHTMLHead(w, "Go Blog Content")
+
+	// Anchors are unique across the document: chapters first, then each
+	// chapter's headings
+	slugs := slugger{}
+	slugs.unique("table-of-contents")
+	chapterIDs := make([]string, len(pages))
+	headingIDs := make([][]string, len(pages))
+	for i, page := range pages {
+		chapterIDs[i] = slugs.unique(slugify(numberedTitle(page.Title, opts.Numbering, i+1)))
+		headingIDs[i] = markdownHeadingSlugs(page, slugs)
+	}
+
+	var toc strings.Builder
+	fmt.Fprintf(&toc, "<nav id=\"table-of-contents\"><h1>%s</h1><ul>\n", html.EscapeString(opts.TOCTitle))
+	for i, page := range pages {
+		fmt.Fprintf(&toc, `<li><a href="#%s">%s</a>`, chapterIDs[i], html.EscapeString(numberedTitle(page.Title, opts.Numbering, i+1)))
+		var sections strings.Builder
+		listed, more := page.tocSections(opts.TOCDepth, opts.MaxTOCEntries)
+		for n, j := range listed {
+			fmt.Fprintf(&sections, `<li><a href="#%s">%s</a></li>`, headingIDs[i][j], html.EscapeString(numberedTitle(page.Headings[j].Text, opts.Numbering, i+1, n+1)))
+		}
+		if more > 0 {
+			fmt.Fprintf(&sections, "<li>%s</li>", html.EscapeString(tocRollup(more)))
+		}
+		if sections.Len() > 0 {
+			fmt.Fprintf(&toc, "<ul>%s</ul>", sections.String())
+		}
+		fmt.Fprintln(&toc, "</li>")
+	}
+	fmt.Fprintln(&toc, "</ul></nav>")
+
+	if opts.TOCPosition == "start" {
+		w.WriteString(toc.String())
+	}
+	for i, page := range pages {
+		writeHTMLChapter(w, page, numberedTitle(page.Title, opts.Numbering, i+1), chapterIDs[i], headingIDs[i], opts)
+	}
+	if opts.TOCPosition == "end" {
+		w.WriteString(toc.String())
+	}
+	fmt.Fprintln(w, "</body></html>")
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeHTMLDir writes each page to its own HTML file in dir, named after
+// its position and title, plus an index.html linking to all of them.
+func writeHTMLDir(pages []Page, dir string, opts htmlOptions) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var index strings.Builder
+	fmt.Fprintf(&index, "<nav id=\"table-of-contents\"><h1>%s</h1><ul>\n", html.EscapeString(opts.TOCTitle))
+	digits := len(strconv.Itoa(len(pages)))
+	for i, page := range pages {
+		name := fmt.Sprintf("%0*d", digits, i+1)
+		if slug := slugify(page.Title); slug != "" {
+			name += "-" + slug
+		}
+		name += ".html"
+		title := numberedTitle(page.Title, opts.Numbering, i+1)
+		slugs := slugger{}
+		chapterID := slugs.unique(slugify(title))
+		headingIDs := markdownHeadingSlugs(page, slugs)
+
+		fmt.Fprintf(&index, `<li><a href="%s">%s</a>`, html.EscapeString(name), html.EscapeString(title))
+		var sections strings.Builder
+		listed, more := page.tocSections(opts.TOCDepth, opts.MaxTOCEntries)
+		for n, j := range listed {
+			fmt.Fprintf(&sections, `<li><a href="%s#%s">%s</a></li>`, html.EscapeString(name), headingIDs[j], html.EscapeString(numberedTitle(page.Headings[j].Text, opts.Numbering, i+1, n+1)))
+		}
+		if more > 0 {
+			fmt.Fprintf(&sections, "<li>%s</li>", html.EscapeString(tocRollup(more)))
+		}
+		if sections.Len() > 0 {
+			fmt.Fprintf(&index, "<ul>%s</ul>", sections.String())
+		}
+		fmt.Fprintln(&index, "</li>")
+
+		if err := writeHTMLFile(filepath.Join(dir, name), title, opts, func(w *bufio.Writer) {
+			fmt.Fprintln(w, `<p><a href="index.html">Index</a></p>`)
+			writeHTMLChapter(w, page, title, chapterID, headingIDs, opts)
+		}); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(&index, "</ul></nav>")
+
+	return writeHTMLFile(filepath.Join(dir, "index.html"), opts.TOCTitle, opts, func(w *bufio.Writer) {
+		w.WriteString(index.String())
+	})
+}
+
+// writeHTMLFile writes a standalone HTML document titled title to path,
+// with body writing what goes inside <body>.
+func writeHTMLFile(path, title string, opts htmlOptions, body func(w *bufio.Writer)) error {
+	f, err := createTextFile(path, opts.BOM)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	writeHTMLHead(w, title)
+	body(w)
+	fmt.Fprintln(w, "</body></html>")
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeHTMLHead starts a document titled title, up to the opening <body>.
+func writeHTMLHead(w *bufio.Writer, title string) {
+	fmt.Fprintln(w, "<!DOCTYPE html>")
+	fmt.Fprintln(w, `<html><head><meta charset="utf-8">`)
+	fmt.Fprintf(w, "<title>%s</title>\n<style>\n%s\n</style>\n</head><body>\n", html.EscapeString(title), htmlStyle)
+}
+
+// writeHTMLChapter writes one page as a section headed by title.
+func writeHTMLChapter(w *bufio.Writer, page Page, title, id string, headingIDs []string, opts htmlOptions) {
+	fmt.Fprintf(w, "<section>\n<h1 id=\"%s\">%s</h1>\n", id, html.EscapeString(title))
+	if !opts.NoSource {
+		fmt.Fprintf(w, "<p class=\"source\">Source: <a href=\"%[1]s\">%[1]s</a></p>\n", html.EscapeString(page.URL))
+	}
+	writeHTMLContent(w, page, headingIDs, opts)
+	fmt.Fprintln(w, "</section>")
+}
+
+// writeHTMLContent writes a page's paragraphs, expanding the heading, code
+// block, image and note markers in its content.
+func writeHTMLContent(w *bufio.Writer, page Page, headingIDs []string, opts htmlOptions) {
+	for _, para := range strings.Split(page.Content, "\n\n") {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+
+		var n int
+		switch {
+		case strings.HasPrefix(para, "[Heading "):
+			fmt.Sscanf(para, "[Heading %d]", &n)
+			if n > 0 && n <= len(page.Headings) {
+				heading := page.Headings[n-1]
+				fmt.Fprintf(w, "<h%[1]d id=\"%[2]s\">%[3]s</h%[1]d>\n", heading.Level, headingIDs[n-1], html.EscapeString(strings.TrimSpace(heading.Text)))
+			}
+		case strings.HasPrefix(para, "[Code Block "):
+			fmt.Sscanf(para, "[Code Block %d]", &n)
+			if n > 0 && n <= len(page.Code) {
+				code := fmt.Sprintf("<pre><code>%s</code></pre>", html.EscapeString(strings.TrimRight(page.Code[n-1], "\n")))
+				if caption := page.codeCaption(n - 1); caption != "" {
+					code = fmt.Sprintf("<figure><figcaption>%s</figcaption>%s</figure>", html.EscapeString(caption), code)
+				}
+				fmt.Fprintln(w, code)
+			}
+		case strings.HasPrefix(para, "[Image "):
+			fmt.Sscanf(para, "[Image %d]", &n)
+			if n > 0 && n <= len(page.Images) {
+				writeHTMLImage(w, page.Images[n-1], opts)
+			}
+		case strings.HasPrefix(para, "[Note "):
+			fmt.Sscanf(para, "[Note %d]", &n)
+			if n > 0 && n <= len(page.Notes) {
+				note := page.Notes[n-1]
+				fmt.Fprintf(w, "<aside class=\"note\"><strong>%s</strong>\n", html.EscapeString(note.Label))
+				for _, line := range strings.Split(note.Text, "\n") {
+					fmt.Fprintf(w, "<p>%s</p>\n", html.EscapeString(line))
+				}
+				fmt.Fprintln(w, "</aside>")
+			}
+		default:
+			// List items keep one per line; breaks within prose become <br>
+			lines := strings.Split(strings.TrimSpace(para), "\n")
+			var items, prose []string
+			for _, line := range lines {
+				if item, ok := strings.CutPrefix(line, "• "); ok {
+					items = append(items, "<li>"+html.EscapeString(item)+"</li>")
+				} else {
+					prose = append(prose, html.EscapeString(line))
+				}
+			}
+			if len(prose) > 0 {
+				fmt.Fprintf(w, "<p>%s</p>\n", strings.Join(prose, "<br>\n"))
+			}
+			if len(items) > 0 {
+				fmt.Fprintf(w, "<ul>\n%s\n</ul>\n", strings.Join(items, "\n"))
+			}
+		}
+	}
+}
+
+// writeHTMLImage writes an <img>, embedding the downloaded image as a data:
+// URI when opts.InlineImages is set.
+func writeHTMLImage(w *bufio.Writer, img Image, opts htmlOptions) {
+	src := img.URL
+	if opts.InlineImages {
+		data, err := opts.Images.get(img.URL)
+		if err != nil {
+			fmt.Printf("Skipping image %s: %v\n", img.URL, err)
+			if img.Alt != "" {
+				fmt.Fprintf(w, "<p><em>%s</em></p>\n", html.EscapeString(img.Alt))
+			}
+			return
+		}
+		mime := "image/png"
+		if data.Type == "JPG" {
+			mime = "image/jpeg"
+		}
+		src = "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data.Data)
+	}
+	fmt.Fprintf(w, "<p><img src=\"%s\" alt=\"%s\"></p>\n", html.EscapeString(src), html.EscapeString(img.Alt))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var htmlImgSrcPattern = regexp.MustCompile(`<img src="([^"]*)"`)
+
+func TestInlineImages(t *testing.T) {
+	images := imageServer(t, 8)
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>A diagram.</p><img src="`+images.URL+`/diagram.png" alt="Diagram"><p>A photo.</p><img src="`+images.URL+`/photo.png" alt="Photo">`),
+	})
+	for _, inline := range []bool{false, true} {
+		args := []string{"-url", srv.URL + "/", "-output", "out.html", "-deterministic"}
+		if inline {
+			args = append(args, "-inline-images")
+		}
+		dir, out, status := runMain(t, args...)
+		if status != 0 {
+			t.Fatalf("exit status %d:\n%s", status, out)
+		}
+		html := readOutput(t, filepath.Join(dir, "out.html"))
+		srcs := htmlImgSrcPattern.FindAllSubmatch(html, -1)
+		if len(srcs) != 2 {
+			t.Fatalf("-inline-images=%t: %d images in the HTML, want 2:\n%s", inline, len(srcs), html)
+		}
+		for _, m := range srcs {
+			src := string(m[1])
+			data, isData := bytes.CutPrefix(m[1], []byte("data:image/png;base64,"))
+			if isData != inline {
+				t.Errorf("-inline-images=%t: image src %.60s", inline, src)
+				continue
+			}
+			if !inline {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(string(data))
+			if err != nil {
+				t.Errorf("data: URI is not base64: %v", err)
+			} else if _, err := png.Decode(bytes.NewReader(decoded)); err != nil {
+				t.Errorf("data: URI does not hold the PNG: %v", err)
+			}
+		}
+		if inline && bytes.Contains(html, []byte(images.URL)) {
+			t.Errorf("-inline-images left a reference to the image host:\n%s", html)
+		}
+	}
+}
+
+var htmlHrefPattern = regexp.MustCompile(`<a href="([^"#]+)(#[^"]*)?"`)
+
+func TestHTMLDirIndex(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a>`),
+		"/a": htmlPage("Install Guide", `<h2>Steps</h2><p>Page A.</p>`),
+		"/b": htmlPage("Reference", `<p>Page B.</p>`),
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "site/docs/", "-format", "html", "-deterministic", "-no-source")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	docs := filepath.Join(dir, "site", "docs")
+	index := readOutput(t, filepath.Join(docs, "index.html"))
+
+	linked := make(map[string]bool)
+	for _, m := range htmlHrefPattern.FindAllSubmatch(index, -1) {
+		linked[string(m[1])] = true
+	}
+	entries, err := os.ReadDir(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Name() != "index.html" {
+			files = append(files, e.Name())
+		}
+	}
+	if got := strings.Join(files, " "); got != "1-home.html 2-install-guide.html 3-reference.html" {
+		t.Errorf("wrote files %s, want one per page", got)
+	}
+	for _, name := range files {
+		if !linked[name] {
+			t.Errorf("index does not link to %s:\n%s", name, index)
+		}
+		delete(linked, name)
+		page := readOutput(t, filepath.Join(docs, name))
+		if !bytes.Contains(page, []byte(`<a href="index.html">`)) || !bytes.HasSuffix(bytes.TrimSpace(page), []byte("</html>")) {
+			t.Errorf("%s is not a page linking back to the index:\n%s", name, page)
+		}
+	}
+	for name := range linked {
+		t.Errorf("index links to %s, which was not written", name)
+	}
+	if !bytes.Contains(index, []byte(`href="2-install-guide.html#steps"`)) {
+		t.Errorf("index lacks the link to the Steps section:\n%s", index)
+	}
+	if guide := readOutput(t, filepath.Join(docs, "2-install-guide.html")); !bytes.Contains(guide, []byte(`<h2 id="steps">Steps</h2>`)) {
+		t.Errorf("the Steps section has no steps anchor:\n%s", guide)
+	}
+
+	for _, format := range []string{"pdf", "markdown,html"} {
+		if _, out, status := runMain(t, "-url", srv.URL+"/", "-output", "docs/", "-format", format); status == 0 || !strings.Contains(out, "requires -format markdown or -format html") {
+			t.Errorf("-format %s to a directory: exit status %d:\n%s", format, status, out)
+		}
+	}
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	_ "embed"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// hyphenateParagraph hyphenates the words that would otherwise be pushed
+// to the next line of a MultiCell of the given width, so lines end closer
+// to the margin. Each split is written as "head- tail", which MultiCell
+// breaks at the space after the hyphen. It lays lines out as MultiCell
+// does, so the current font must be the one the paragraph is set in.
+func hyphenateParagraph(pdf *gofpdf.Fpdf, text string, width float64) string {
+	avail := multiCellWidth(pdf, width)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		var out []string
+		current := ""
+		for _, word := range strings.Fields(line) {
+			if pdf.GetStringWidth(word) > avail {
+				// MultiCell splits over-long words anywhere, so stop predicting its breaks
+				out = nil
+				break
+			}
+			if current == "" {
+				current = word
+				continue
+			}
+			if pdf.GetStringWidth(current+" "+word) <= avail {
+				current += " " + word
+				continue
+			}
+			head, tail := splitWord(word, func(head string) bool {
+				return pdf.GetStringWidth(current+" "+head) <= avail
+			})
+			if head != "" {
+				out = append(out, current+" "+head)
+				current = tail
+			} else {
+				out = append(out, current)
+				current = word
+			}
+		}
+		if out != nil {
+			lines[i] = strings.Join(append(out, current), " ")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// multiCellWidth returns the width MultiCell sets text in within a cell of
+// the given width: inside the cell margins, rounded up to whole font units.
+func multiCellWidth(pdf *gofpdf.Fpdf, width float64) float64 {
+	fontSize, _ := pdf.GetFontSize()
+	units := math.Ceil((width - 2*pdf.GetCellMargin()) * 1000 / fontSize)
+	return units * fontSize / 1000
+}
+
+// flowWord is a word of a flowed paragraph, in one run or, when a link
+// starts or ends inside it, several.
+type flowWord []textRun
+
+func (w flowWord) text() string {
+	var b strings.Builder
+	for _, run := range w {
+		b.WriteString(run.Text)
+	}
+	return b.String()
+}
+
+// splitAt splits the word before its p-th rune.
+func (w flowWord) splitAt(p int) (head, tail flowWord) {
+	for _, run := range w {
+		n := utf8.RuneCountInString(run.Text)
+		switch {
+		case p <= 0:
+			tail = append(tail, run)
+		case p >= n:
+			head = append(head, run)
+		default:
+			runes := []rune(run.Text)
+			first, second := run, run
+			first.Text, second.Text = string(runes[:p]), string(runes[p:])
+			head, tail = append(head, first), append(tail, second)
+		}
+		p -= n
+	}
+	return head, tail
+}
+
+// flowWords splits runs into words, one slice per line of the paragraph.
+func flowWords(runs []textRun) [][]flowWord {
+	lines := [][]flowWord{nil}
+	var word flowWord
+	add := func(run textRun, text string) {
+		if text != "" {
+			run.Text = text
+			word = append(word, run)
+		}
+	}
+	for _, run := range runs {
+		start := 0
+		for i, r := range run.Text {
+			if !unicode.IsSpace(r) {
+				continue
+			}
+			add(run, run.Text[start:i])
+			if word != nil {
+				lines[len(lines)-1] = append(lines[len(lines)-1], word)
+				word = nil
+			}
+			if r == '\n' {
+				lines = append(lines, nil)
+			}
+			start = i + utf8.RuneLen(r)
+		}
+		add(run, run.Text[start:])
+	}
+	if word != nil {
+		lines[len(lines)-1] = append(lines[len(lines)-1], word)
+	}
+	return lines
+}
+
+// writeFlowedParagraph lays out a paragraph of runs within width as
+// MultiCell would, hyphenating words at line ends and spreading the words
+// of every line but the last to both margins when asked. Each run keeps
+// its own color and link, so it suits paragraphs that contain links.
+func writeFlowedParagraph(pdf *gofpdf.Fpdf, lineHeight float64, runs []textRun, width float64, justify, hyphenate bool, links *pdfLinks) {
+	avail := multiCellWidth(pdf, width)
+	space := pdf.GetStringWidth(" ")
+	for _, words := range flowWords(runs) {
+		var line []flowWord
+		lineWidth := 0.0
+		for len(words) > 0 {
+			word := words[0]
+			gap := 0.0
+			if line != nil {
+				gap = space
+			}
+			if w := pdf.GetStringWidth(word.text()); lineWidth+gap+w <= avail {
+				line = append(line, word)
+				lineWidth += gap + w
+				words = words[1:]
+				continue
+			}
+			var head, tail flowWord
+			if hyphenate {
+				head, tail = hyphenateWord(pdf, word, avail-lineWidth-gap)
+			}
+			if head == nil && line == nil {
+				// Too long for a line of its own; split it anywhere, as MultiCell does
+				head, tail = breakWord(pdf, word, avail)
+			}
+			if head != nil {
+				line = append(line, head)
+				words[0] = tail
+			}
+			writeFlowedLine(pdf, lineHeight, line, avail, justify, links)
+			line, lineWidth = nil, 0
+		}
+		writeFlowedLine(pdf, lineHeight, line, avail, false, links)
+	}
+}
+
+// hyphenateWord splits word at the last hyphenation point whose head,
+// ending in a hyphen, fits in room. It returns a nil head when there is none.
+func hyphenateWord(pdf *gofpdf.Fpdf, word flowWord, room float64) (head, tail flowWord) {
+	text := word.text()
+	headText, tailText := splitWord(text, func(head string) bool {
+		return pdf.GetStringWidth(head) <= room
+	})
+	if headText == "" {
+		return nil, nil
+	}
+	head, tail = word.splitAt(utf8.RuneCountInString(text) - utf8.RuneCountInString(tailText))
+	if head.text() != headText {
+		head[len(head)-1].Text += "-"
+	}
+	return head, tail
+}
+
+// breakWord splits word after as many runes as fit in room, and at least one.
+func breakWord(pdf *gofpdf.Fpdf, word flowWord, room float64) (head, tail flowWord) {
+	runes := []rune(word.text())
+	p := 1
+	for p < len(runes) && pdf.GetStringWidth(string(runes[:p+1])) <= room {
+		p++
+	}
+	return word.splitAt(p)
+}
+
+// writeFlowedLine writes one line of words from the left margin, widening
+// the spaces between them so the line fills avail when justify is set.
+func writeFlowedLine(pdf *gofpdf.Fpdf, lineHeight float64, line []flowWord, avail float64, justify bool, links *pdfLinks) {
+	margin := pdf.GetCellMargin()
+	left, _, _, _ := pdf.GetMargins()
+	space := pdf.GetStringWidth(" ")
+	if justify && len(line) > 1 {
+		total := 0.0
+		for _, word := range line {
+			total += pdf.GetStringWidth(word.text())
+		}
+		space = (avail - total) / float64(len(line)-1)
+	}
+	x := left + margin
+	for i, word := range line {
+		if i > 0 {
+			x += space
+		}
+		for _, run := range word {
+			w := pdf.GetStringWidth(run.Text)
+			// Cells pad their text by the cell margin, so start each one that far left
+			pdf.SetX(x - margin)
+			if run.Linked {
+				pdf.SetTextColor(0, 0, 238)
+				links.cell(pdf, w+2*margin, lineHeight, run.Text, "L", run.LinkID, run.LinkStr)
+				pdf.SetTextColor(0, 0, 0)
+			} else {
+				pdf.Cell(w+2*margin, lineHeight, run.Text)
+			}
+			x += w
+		}
+	}
+	pdf.Ln(lineHeight)
+}
+
+// splitWord splits word at the last hyphenation point whose head, ending
+// in a hyphen, passes fits. It returns an empty head when there is none.
+func splitWord(word string, fits func(head string) bool) (head, tail string) {
+	runes := []rune(word)
+	points := hyphenPoints(runes)
+	for i := len(points) - 1; i >= 0; i-- {
+		p := points[i]
+		head = string(runes[:p])
+		if runes[p-1] != '-' {
+			head += "-"
+		}
+		if fits(head) {
+			return head, string(runes[p:])
+		}
+	}
+	return "", ""
+}
+
+// hyphenPoints returns the positions in word where it may be broken: after
+// a hyphen it already has, or where Liang's algorithm finds a break using
+// the US English patterns and exceptions of TeX's hyphen.tex. As in TeX, at
+// least two letters stay before a break and three after it; words with
+// digits or other symbols are left whole.
+func hyphenPoints(word []rune) []int {
+	start, end := 0, len(word)
+	for start < end && unicode.IsPunct(word[start]) {
+		start++
+	}
+	for end > start && unicode.IsPunct(word[end-1]) {
+		end--
+	}
+
+	var points []int
+	part := start // start of the current hyphen-separated part
+	for i := start; i <= end; i++ {
+		if i < end && word[i] != '-' {
+			if !unicode.IsLetter(word[i]) {
+				return nil
+			}
+			continue
+		}
+		for _, p := range liangPoints(word[part:i]) {
+			points = append(points, part+p)
+		}
+		if i < end && i > start && i < end-1 {
+			points = append(points, i+1)
+		}
+		part = i + 1
+	}
+	return points
+}
+
+// leftHyphenMin and rightHyphenMin are the fewest letters left before and
+// after a hyphen, TeX's defaults for English.
+const (
+	leftHyphenMin  = 2
+	rightHyphenMin = 3
+)
+
+// hyphenTeX is Donald Knuth's hyphen.tex, the US English hyphenation
+// tables of plain TeX, as CTAN distributes it in tex/generic/hyphen. Its
+// licence allows copying it only unmodified, so it is embedded as it is
+// and parsed when first needed.
+//
+//go:embed hyphen.tex
+var hyphenTeX string
+
+var (
+	hyphenOnce       sync.Once
+	hyphenPatterns   map[string][]byte // letters -> break values between and around them
+	hyphenExceptions map[string][]int  // word -> break positions
+	hyphenMaxPattern int               // letters in the longest pattern
+)
+
+// loadHyphenation parses the \patterns and \hyphenation lists of hyphen.tex.
+func loadHyphenation() {
+	hyphenPatterns = make(map[string][]byte)
+	hyphenExceptions = make(map[string][]int)
+	list := ""
+	for _, line := range strings.Split(hyphenTeX, "\n") {
+		line, _, _ = strings.Cut(line, "%")
+		for _, field := range strings.Fields(line) {
+			switch {
+			case strings.HasPrefix(field, "\\"):
+				list, _, _ = strings.Cut(field[1:], "{")
+			case field == "}":
+				list = ""
+			case list == "patterns":
+				var letters strings.Builder
+				values := []byte{0}
+				for _, r := range field {
+					if r >= '0' && r <= '9' {
+						values[len(values)-1] = byte(r - '0')
+					} else {
+						letters.WriteRune(r)
+						values = append(values, 0)
+					}
+				}
+				hyphenPatterns[letters.String()] = values
+				hyphenMaxPattern = max(hyphenMaxPattern, letters.Len())
+			case list == "hyphenation":
+				var points []int
+				for i, part := range strings.Split(field, "-") {
+					if i > 0 {
+						points = append(points, points[len(points)-1]+len(part))
+					} else {
+						points = append(points, len(part))
+					}
+				}
+				hyphenExceptions[strings.ReplaceAll(field, "-", "")] = points[:len(points)-1]
+			}
+		}
+	}
+}
+
+// liangPoints returns the positions where Liang's algorithm breaks letters,
+// a run of letters without hyphens.
+func liangPoints(letters []rune) []int {
+	n := len(letters)
+	if n < leftHyphenMin+rightHyphenMin {
+		return nil
+	}
+	hyphenOnce.Do(loadHyphenation)
+	lower := []rune(strings.ToLower(string(letters)))
+	if points, ok := hyphenExceptions[string(lower)]; ok {
+		return points
+	}
+
+	// values[i] rates a break before lower[i-1]; odd values allow one
+	word := append(append([]rune{'.'}, lower...), '.')
+	values := make([]byte, len(word)+1)
+	for i := range word {
+		for j := i + 1; j <= len(word) && j-i <= hyphenMaxPattern; j++ {
+			for k, v := range hyphenPatterns[string(word[i:j])] {
+				values[i+k] = max(values[i+k], v)
+			}
+		}
+	}
+	var points []int
+	for p := leftHyphenMin; p <= n-rightHyphenMin; p++ {
+		if values[p+1]%2 == 1 {
+			points = append(points, p)
+		}
+	}
+	return points
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// longWords is a paragraph of words long enough to leave wide gaps unless hyphenated.
+var longWords = strings.Repeat("Documentation about internationalization and telecommunications infrastructure "+
+	"describes characteristically incomprehensible configurations, responsibilities and "+
+	"interoperability considerations for administrators ", 4)
+
+func TestJustifiedHyphenatedTextFits(t *testing.T) {
+	pages := []Page{{Title: "Words", URL: "https://example.com/words", Content: strings.TrimSpace(longWords)}}
+	opts := testPDFOptions()
+	opts.Justify = true
+	opts.Hyphenate = true
+	pdf := renderPDF(t, pages, opts)
+
+	// Measure each body line as set, before justification stretches it
+	measure := gofpdf.New("P", "mm", "A4", "")
+	measure.SetFont("Arial", "", 12)
+	avail := 190 - 2*measure.GetCellMargin()
+	var lines, hyphenated int
+	for _, runs := range pdf.Pages {
+		for _, run := range runs {
+			if run.Font != "Helvetica" || run.Size != 12 {
+				continue
+			}
+			lines++
+			if w := measure.GetStringWidth(run.Text); w > avail+0.01 {
+				t.Errorf("line is %.1fmm wide, over the %.1fmm content width: %q", w, avail, run.Text)
+			}
+			if run.X < 10*pointsPerMM-0.01 {
+				t.Errorf("line starts at x=%.1fpt, left of the margin: %q", run.X, run.Text)
+			}
+			if strings.HasSuffix(run.Text, "-") {
+				hyphenated++
+			}
+		}
+	}
+	if lines < 5 || hyphenated == 0 {
+		t.Errorf("%d body lines, %d ending in a hyphen; want a hyphenated multi-line paragraph:\n%s", lines, hyphenated, pdf.AllText())
+	}
+	// Justified lines are stretched with word spacing
+	justified := false
+	for _, obj := range pdf.Objects {
+		justified = justified || bytes.Contains(obj, []byte(" Tw"))
+	}
+	if !justified {
+		t.Error("-justify set no word spacing")
+	}
+}
+
+func TestJustifiedHyphenatedLinkedTextFits(t *testing.T) {
+	pages := []Page{
+		{
+			Title:   "Words",
+			URL:     "https://example.com/words",
+			Content: strings.TrimSpace(longWords),
+			Links: []Link{
+				{Text: "telecommunications infrastructure", URL: "https://example.com/other"},
+				{Text: "incomprehensible", URL: "https://elsewhere.example/terms"},
+			},
+		},
+		{Title: "Other", URL: "https://example.com/other", Content: "Elsewhere."},
+	}
+	opts := testPDFOptions()
+	opts.Justify = true
+	opts.Hyphenate = true
+	pdf := renderPDF(t, pages, opts)
+
+	// Linked paragraphs are set a word at a time, so gather each line's words by height
+	measure := gofpdf.New("P", "mm", "A4", "")
+	measure.SetFont("Arial", "", 12)
+	margin := measure.GetCellMargin()
+	right := 200 - margin
+	var heights []float64
+	lines := map[float64][]pdfRun{}
+	for _, run := range pdf.Pages[1] {
+		if run.Font != "Helvetica" || run.Size != 12 {
+			continue
+		}
+		if lines[run.Y] == nil {
+			heights = append(heights, run.Y)
+		}
+		lines[run.Y] = append(lines[run.Y], run)
+	}
+	if len(heights) < 5 {
+		t.Fatalf("%d body lines, want a multi-line paragraph:\n%s", len(heights), pdf.Text(1))
+	}
+	hyphenated := false
+	for i, y := range heights {
+		line := lines[y]
+		first, last := line[0], line[len(line)-1]
+		text := make([]string, len(line))
+		for j, run := range line {
+			text[j] = run.Text
+		}
+		if first.X < (10+margin)*pointsPerMM-0.01 {
+			t.Errorf("line starts at x=%.1fpt, left of the margin: %q", first.X, text)
+		}
+		end := last.X/pointsPerMM + measure.GetStringWidth(last.Text)
+		if end > right+0.01 {
+			t.Errorf("line ends at %.2fmm, past the %.2fmm margin: %q", end, right, text)
+		}
+		// Every line but the paragraph's last is spread to the right margin
+		if i < len(heights)-1 && end < right-0.05 {
+			t.Errorf("justified line ends at %.2fmm, short of the %.2fmm margin: %q", end, right, text)
+		}
+		hyphenated = hyphenated || strings.HasSuffix(last.Text, "-")
+	}
+	if !hyphenated {
+		t.Errorf("no line ends in a hyphen:\n%s", pdf.Text(1))
+	}
+
+	// The links survive layout: two TOC entries, one for each word of the
+	// internal link, and the external one
+	if n := bytes.Count(pdf.Raw, []byte("/Subtype /Link")); n != 5 {
+		t.Errorf("%d link annotations, want 5", n)
+	}
+	if !bytes.Contains(pdf.Raw, []byte("/URI (https://elsewhere.example/terms)")) {
+		t.Error("the external link is missing")
+	}
+}
+
+func TestHyphenPoints(t *testing.T) {
+	for word, want := range map[string]string{
+		"hyphenation":    "hy-phen-ation",
+		"Documentation,": "Doc-u-men-ta-tion,",
+		"configurations": "con-fig-u-ra-tions",
+		"responsibility": "re-spon-si-bil-ity",
+		"algorithm":      "al-go-rithm",
+		"computer":       "com-puter",
+		"associate":      "as-so-ciate", // from the exception list
+		"table":          "ta-ble",
+		"project":        "project",
+		"every":          "ev-ery",
+		"the":            "the",
+		"well-known":     "well-known",
+		"read-only":      "read-only",
+		"IPv6":           "IPv6",
+	} {
+		runes := []rune(word)
+		var b strings.Builder
+		last := 0
+		for _, p := range hyphenPoints(runes) {
+			b.WriteString(string(runes[last:p]))
+			if runes[p-1] != '-' {
+				b.WriteString("-")
+			}
+			last = p
+		}
+		b.WriteString(string(runes[last:]))
+		if got := b.String(); got != want {
+			t.Errorf("%s hyphenated as %s, want %s", word, got, want)
+		}
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Register decoders for the formats found on the web
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Image is an image referenced from a page's content.
+type Image struct {
+	URL string `json:"url"`
+	Alt string `json:"alt,omitempty"`
+}
+
+// srcsetCandidate is one entry of a srcset attribute. Width is set for
+// "480w" descriptors and Density for "2x" ones.
+type srcsetCandidate struct {
+	URL     string
+	Width   int
+	Density float64
+}
+
+// parseSrcset splits a srcset attribute into its candidates. An entry
+// without a descriptor counts as 1x.
+func parseSrcset(srcset string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	for _, entry := range strings.Split(srcset, ",") {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			continue
+		}
+		c := srcsetCandidate{URL: fields[0], Density: 1}
+		if len(fields) > 1 {
+			descriptor := fields[1]
+			if w, ok := strings.CutSuffix(descriptor, "w"); ok {
+				c.Width, _ = strconv.Atoi(w)
+				c.Density = 0
+			} else if x, ok := strings.CutSuffix(descriptor, "x"); ok {
+				c.Density, _ = strconv.ParseFloat(x, 64)
+			}
+		}
+		candidates = append(candidates, c)
+	}
+	return candidates
+}
+
+// pickSrcset chooses the candidate to embed. With width descriptors it is
+// the narrowest one at least preferredWidth pixels wide, or the widest when
+// preferredWidth is 0 or nothing is wide enough; otherwise it is the one
+// with the highest pixel density.
+func pickSrcset(candidates []srcsetCandidate, preferredWidth int) (string, bool) {
+	var best *srcsetCandidate
+	for i := range candidates {
+		c := &candidates[i]
+		if c.Width == 0 {
+			continue
+		}
+		switch {
+		case best == nil:
+			best = c
+		case preferredWidth > 0 && c.Width >= preferredWidth && (best.Width < preferredWidth || c.Width < best.Width):
+			best = c
+		case (preferredWidth == 0 || best.Width < preferredWidth) && c.Width > best.Width:
+			best = c
+		}
+	}
+	if best == nil {
+		for i := range candidates {
+			if best == nil || candidates[i].Density > best.Density {
+				best = &candidates[i]
+			}
+		}
+	}
+	if best == nil {
+		return "", false
+	}
+	return best.URL, true
+}
+
+// embeddableSourceTypes are the <source type> values that can be decoded
+// for embedding; sources without a type are assumed to be embeddable.
+var embeddableSourceTypes = map[string]bool{"": true, "image/jpeg": true, "image/png": true, "image/gif": true}
+
+// imageSource returns the URL of the image to embed for an <img>: the best
+// srcset candidate of the enclosing <picture>'s first usable <source>, or
+// of the image itself, falling back to its src.
+func imageSource(img *goquery.Selection, preferredWidth int) string {
+	if picture := img.Parent(); goquery.NodeName(picture) == "picture" {
+		var picked string
+		picture.Find("source[srcset]").EachWithBreak(func(_ int, source *goquery.Selection) bool {
+			if !embeddableSourceTypes[strings.ToLower(source.AttrOr("type", ""))] {
+				return true
+			}
+			picked, _ = pickSrcset(parseSrcset(source.AttrOr("srcset", "")), preferredWidth)
+			return picked == ""
+		})
+		if picked != "" {
+			return picked
+		}
+	}
+	if picked, ok := pickSrcset(parseSrcset(img.AttrOr("srcset", "")), preferredWidth); ok {
+		return picked
+	}
+	return img.AttrOr("src", "")
+}
+
+// cssPixelMM is the size of a CSS pixel (1/96 inch) in millimetres, used
+// to give images their natural on-screen size.
+const cssPixelMM = 25.4 / 96
+
+// maxImageBytes bounds the size of a single downloaded image.
+const maxImageBytes = 20 << 20
+
+// defaultImageClient downloads images when no crawl client is given.
+var defaultImageClient = &http.Client{Timeout: 30 * time.Second}
+
+// imageData is a downloaded image ready to be registered with gofpdf.
+type imageData struct {
+	Data   []byte
+	Type   string // "JPG" or "PNG"
+	Width  int    // pixels
+	Height int    // pixels
+}
+
+// fetchImage downloads an image and converts it into a form gofpdf can
+// embed. JPEGs are passed through; everything else is re-encoded as an
+// 8-bit PNG, since gofpdf rejects interlaced and 16-bit PNGs.
+func fetchImage(client *http.Client, imageURL string) (*imageData, error) {
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	// Read one byte past the limit to tell a larger image from one that fits
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(raw) > maxImageBytes {
+		return nil, fmt.Errorf("larger than %d MB", maxImageBytes>>20)
+	}
+	return decodeImage(raw)
+}
+
+func decodeImage(raw []byte) (*imageData, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	if format == "jpeg" {
+		return &imageData{Data: raw, Type: "JPG", Width: cfg.Width, Height: cfg.Height}, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	rgba := image.NewNRGBA(img.Bounds())
+	draw.Draw(rgba, rgba.Bounds(), img, img.Bounds().Min, draw.Src)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, rgba); err != nil {
+		return nil, err
+	}
+	return &imageData{Data: buf.Bytes(), Type: "PNG", Width: cfg.Width, Height: cfg.Height}, nil
+}
+
+// imageCache holds downloaded images, or the error that prevented the
+// download, keyed by URL.
+type imageCache struct {
+	client *http.Client // the crawl's client, so images share its settings
+	mu     sync.Mutex
+	images map[string]*imageData
+	errs   map[string]error
+}
+
+// prefetchImages downloads every image referenced by the pages with
+// client, running at most workers downloads at a time. A nil client uses
+// defaultImageClient.
+func prefetchImages(client *http.Client, pages []Page, workers int) *imageCache {
+	if client == nil {
+		client = defaultImageClient
+	}
+	cache := &imageCache{
+		client: client,
+		images: make(map[string]*imageData),
+		errs:   make(map[string]error),
+	}
+
+	seen := make(map[string]bool)
+	urls := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < max(workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for u := range urls {
+				data, err := fetchImage(cache.client, u)
+				cache.mu.Lock()
+				if err != nil {
+					cache.errs[u] = err
+				} else {
+					cache.images[u] = data
+				}
+				cache.mu.Unlock()
+			}
+		}()
+	}
+	for _, page := range pages {
+		for _, img := range page.Images {
+			if !seen[img.URL] {
+				seen[img.URL] = true
+				urls <- img.URL
+			}
+		}
+	}
+	close(urls)
+	wg.Wait()
+	return cache
+}
+
+func (c *imageCache) get(imageURL string) (*imageData, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if data, ok := c.images[imageURL]; ok {
+		return data, nil
+	}
+	if err, ok := c.errs[imageURL]; ok {
+		return nil, err
+	}
+	return nil, fmt.Errorf("image was not downloaded")
+}
+
+// parseImageMaxWidth parses an -image-max-width value, either millimetres
+// ("120") or a percentage of the content width ("80%"), into millimetres.
+func parseImageMaxWidth(value string, available float64) (float64, error) {
+	value = strings.TrimSpace(value)
+	if pct, ok := strings.CutSuffix(value, "%"); ok {
+		n, err := strconv.ParseFloat(pct, 64)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid image max width %q", value)
+		}
+		return min(available*n/100, available), nil
+	}
+	n, err := strconv.ParseFloat(strings.TrimSuffix(value, "mm"), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid image max width %q", value)
+	}
+	return min(n, available), nil
+}
+
+// fitImage scales an image's natural size down proportionally so it fits
+// within maxW by maxH. Images that already fit keep their natural size.
+func fitImage(w, h, maxW, maxH float64) (float64, float64) {
+	scale := 1.0
+	if w > maxW {
+		scale = maxW / w
+	}
+	if h*scale > maxH {
+		scale = maxH / h
+	}
+	return w * scale, h * scale
+}
+
+// renderImage embeds a downloaded image at the current position, centred
+// and scaled to fit maxWidth and the printable page height. Images that
+// could not be fetched or decoded are skipped with a message.
+func renderImage(pdf *gofpdf.Fpdf, cache *imageCache, img Image, maxWidth float64) {
+	data, err := cache.get(img.URL)
+	if err != nil {
+		fmt.Printf("Skipping image %s: %v\n", img.URL, err)
+		return
+	}
+
+	// Images used more than once are only registered the first time
+	if pdf.GetImageInfo(img.URL) == nil {
+		info := pdf.RegisterImageOptionsReader(img.URL, gofpdf.ImageOptions{ImageType: data.Type}, bytes.NewReader(data.Data))
+		if !pdf.Ok() || info == nil {
+			fmt.Printf("Skipping image %s: %v\n", img.URL, pdf.Error())
+			pdf.ClearError()
+			return
+		}
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+	left, top, _, _ := pdf.GetMargins()
+	_, bottom := pdf.GetAutoPageBreak()
+	w, h := fitImage(float64(data.Width)*cssPixelMM, float64(data.Height)*cssPixelMM, maxWidth, pageHeight-top-bottom)
+
+	x := left + (contentWidth(pdf)-w)/2
+	pdf.ImageOptions(img.URL, x, -1, w, h, true, gofpdf.ImageOptions{ImageType: data.Type}, 0, "")
+	pdf.Ln(5)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pdfImagePattern matches gofpdf's image placement: width, height, x and y in points.
+var pdfImagePattern = regexp.MustCompile(`q ([\d.]+) 0 0 ([\d.]+) ([\d.]+) ([\d.-]+) cm /I\w+ Do Q`)
+
+const pointsPerMM = 72 / 25.4
+
+// sizedImageServer serves a blank PNG of W by H pixels at /WxH.png.
+func sizedImageServer(t testing.TB) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var width, height int
+		if _, err := fmt.Sscanf(r.URL.Path, "/%dx%d.png", &width, &height); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		png.Encode(w, image.NewGray(image.Rect(0, 0, width, height)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// imageSizes returns the rendered width and height, in millimetres, of
+// each image placed on the pages of f.
+func (f *pdfFile) imageSizes() [][2]float64 {
+	var sizes [][2]float64
+	for _, obj := range f.Objects {
+		for _, m := range pdfImagePattern.FindAllSubmatch(obj, -1) {
+			w, _ := strconv.ParseFloat(string(m[1]), 64)
+			h, _ := strconv.ParseFloat(string(m[2]), 64)
+			sizes = append(sizes, [2]float64{w / pointsPerMM, h / pointsPerMM})
+		}
+	}
+	return sizes
+}
+
+func TestImageMaxWidth(t *testing.T) {
+	srv := sizedImageServer(t)
+	const (
+		contentW = 190.0 // A4 less the 10mm side margins
+		contentH = 267.0 // less the top margin and the 20mm page break margin
+	)
+	for _, tc := range []struct {
+		image    string
+		maxWidth string
+		w, h     float64 // expected size in mm
+	}{
+		{"1500x750", "100%", contentW, contentW / 2}, // landscape, scaled to the width
+		{"1500x750", "50%", contentW / 2, contentW / 4},
+		{"1500x750", "120", 120, 60},
+		{"400x4000", "100%", contentH / 10, contentH},           // portrait, scaled to the page height
+		{"200x100", "100%", 200 * cssPixelMM, 100 * cssPixelMM}, // small, natural size
+	} {
+		page := Page{
+			Title:   "Images",
+			URL:     "https://example.com/images",
+			Images:  []Image{{URL: srv.URL + "/" + tc.image + ".png", Alt: "figure"}},
+			Content: "Before.\n\n[Image 1]\n\nAfter.",
+		}
+		opts := testPDFOptions()
+		opts.ImageMaxWidth = tc.maxWidth
+		sizes := renderPDF(t, []Page{page}, opts).imageSizes()
+		if len(sizes) != 1 {
+			t.Fatalf("%s at %s: %d images drawn, want 1", tc.image, tc.maxWidth, len(sizes))
+		}
+		w, h := sizes[0][0], sizes[0][1]
+		if w > contentW+0.01 {
+			t.Errorf("%s at %s: drawn %.1fmm wide, wider than the %.0fmm content area", tc.image, tc.maxWidth, w, contentW)
+		}
+		if w < tc.w-0.1 || w > tc.w+0.1 || h < tc.h-0.1 || h > tc.h+0.1 {
+			t.Errorf("%s at %s: drawn %.1f by %.1fmm, want %.1f by %.1fmm", tc.image, tc.maxWidth, w, h, tc.w, tc.h)
+		}
+	}
+}
+
+func TestPrefetchImagesBoundsConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	fetched := make(map[string]int)
+	sized := sizedImageServer(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		fetched[r.URL.Path]++
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		sized.Config.Handler.ServeHTTP(w, r)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	page := Page{Title: "Gallery", URL: "https://example.com/gallery"}
+	var content []string
+	for i := 0; i < 8; i++ {
+		page.Images = append(page.Images, Image{URL: fmt.Sprintf("%s/%dx%d.png", srv.URL, 20+i, 10), Alt: "figure"})
+		content = append(content, fmt.Sprintf("[Image %d]", i+1))
+	}
+	// The same image used twice is downloaded once
+	page.Images = append(page.Images, page.Images[0])
+	content = append(content, "[Image 9]")
+	page.Content = strings.Join(content, "\n\n")
+
+	const workers = 3
+	cache := prefetchImages(nil, []Page{page}, workers)
+	if peak > workers {
+		t.Errorf("%d downloads ran at once, want at most %d", peak, workers)
+	}
+	if peak < 2 {
+		t.Errorf("downloads ran one at a time, want up to %d at once", workers)
+	}
+	if len(fetched) != 8 {
+		t.Errorf("downloaded %d images, want 8", len(fetched))
+	}
+	for path, n := range fetched {
+		if n != 1 {
+			t.Errorf("%s downloaded %d times, want once", path, n)
+		}
+	}
+
+	// Rendering reads the cache rather than the network
+	srv.Close()
+	opts := testPDFOptions()
+	opts.Images = cache
+	sizes := renderPDF(t, []Page{page}, opts).imageSizes()
+	if len(sizes) != 9 {
+		t.Fatalf("%d images drawn, want 9", len(sizes))
+	}
+	for i, size := range sizes {
+		if size[1] < 10*cssPixelMM-0.1 || size[1] > 10*cssPixelMM+0.1 {
+			t.Errorf("image %d drawn %.1fmm tall, want its natural %.1fmm", i, size[1], 10*cssPixelMM)
+		}
+	}
+}
+
+func TestPictureSrcset(t *testing.T) {
+	html := htmlPage("Figures", `<figure><picture>
+		<source type="image/webp" srcset="img/photo.webp 1600w">
+		<source srcset="img/small.jpg 400w, img/medium.jpg 800w, /assets/large.jpg 1600w">
+		<img src="img/fallback.jpg" alt="A photo"></picture><figcaption>A photo</figcaption></figure>
+		<p><img src="plain.png" srcset="plain.png 1x, plain@2x.png 2x" alt="Plain"></p>`)
+	for _, tc := range []struct {
+		width int
+		want  []string
+	}{
+		{0, []string{"/assets/large.jpg", "/plain@2x.png"}},
+		{700, []string{"/img/medium.jpg", "/plain@2x.png"}},
+		{400, []string{"/img/small.jpg", "/plain@2x.png"}},
+		{2000, []string{"/assets/large.jpg", "/plain@2x.png"}},
+	} {
+		var base string
+		p := scrapeOne(t, html, func(o *CrawlOptions) {
+			o.Extract.ImageWidth = tc.width
+			base = strings.TrimSuffix(o.URL, "/page")
+		})
+		var got []string
+		for _, img := range p.Images {
+			got = append(got, strings.TrimPrefix(img.URL, base))
+		}
+		if strings.Join(got, " ") != strings.Join(tc.want, " ") {
+			t.Errorf("-image-width %d: picked %v, want %v", tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestOversizedImageSkipped(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(make([]byte, maxImageBytes+1))
+	}))
+	t.Cleanup(srv.Close)
+	if _, err := fetchImage(srv.Client(), srv.URL+"/huge.png"); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("fetchImage of an image past the limit = %v, want it skipped as too large", err)
+	}
+}
+
+func TestRepeatedImageEmbeddedOnce(t *testing.T) {
+	srv := sizedImageServer(t)
+	page := scrapeOne(t, htmlPage("Images", `<p>Before.</p><img src="`+srv.URL+`/300x200.png" alt="logo"><p>Between.</p>
+		<img src="`+srv.URL+`/300x200.png" alt="logo again"><img src="`+srv.URL+`/100x100.png" alt="icon"><p>After.</p>`), nil)
+	pdf := renderPDF(t, []Page{page}, testPDFOptions())
+	if n := len(pdf.imageSizes()); n != 3 {
+		t.Errorf("%d images drawn, want 3", n)
+	}
+	if embedded := bytes.Count(pdf.Raw, []byte("/Subtype /Image")); embedded != 2 {
+		t.Errorf("%d image objects embedded, want one per distinct image, 2", embedded)
+	}
+}
+
+func TestImageModeAlt(t *testing.T) {
+	html := htmlPage("Design", `<p>Before.</p><img src="/arch.png" alt="Architecture diagram"><p>Between.</p>
+		<img src="/spacer.png" alt=""><figure><img src="/flow.png"><figcaption>Request flow</figcaption></figure><p>After.</p>`)
+	prose := func(p Page) string {
+		return strings.Join(strings.Split(strings.TrimSpace(p.Content), "\n\n"), " ")
+	}
+
+	page := scrapeOne(t, html, func(opts *CrawlOptions) { opts.Extract.ImageMode = "alt" })
+	want := "Before. [Image: Architecture diagram] Between. [Image: Request flow] After."
+	if got := prose(page); got != want {
+		t.Errorf("-image-mode alt: content %q, want %q", got, want)
+	}
+	if len(page.Images) != 0 {
+		t.Errorf("-image-mode alt recorded images %+v", page.Images)
+	}
+	pdfOpts := testPDFOptions()
+	if text := renderPDF(t, []Page{page}, pdfOpts).AllText(); !strings.Contains(text, "[Image: Architecture diagram]") {
+		t.Errorf("-image-mode alt: PDF lacks the placeholder:\n%s", text)
+	}
+
+	page = scrapeOne(t, html, func(opts *CrawlOptions) { opts.Extract.ImageMode = "skip" })
+	if got := prose(page); got != "Before. Between. After." || len(page.Images) != 0 {
+		t.Errorf("-image-mode skip: content %q with images %+v, want neither", got, page.Images)
+	}
+
+	page = scrapeOne(t, html, nil)
+	if got := prose(page); got != "Before. [Image 1] Between. [Image 2] [Image 3] After." || len(page.Images) != 3 {
+		t.Errorf("-image-mode embed: content %q with %d images, want markers for all 3", got, len(page.Images))
+	}
+}
+
+// TestImageClientPerCrawl checks that a crawl's settings reach the images
+// downloaded with its client but not those of other downloads.
+func TestImageClientPerCrawl(t *testing.T) {
+	var mu sync.Mutex
+	agents := make(map[string]string) // image path -> User-Agent
+	images := imageHandler(8)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".png") {
+			mu.Lock()
+			agents[r.URL.Path] = r.UserAgent()
+			mu.Unlock()
+			images.ServeHTTP(w, r)
+			return
+		}
+		w.Write([]byte(htmlPage("Home", `<p>Start here.</p>`)))
+	}))
+	defer srv.Close()
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.UserAgentPerDomain = true
+	client, err := newCrawlClient(opts, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Crawl(opts, WithHTTPClient(client)); err != nil {
+		t.Fatal(err)
+	}
+
+	page := func(name string) []Page {
+		return []Page{{Images: []Image{{URL: srv.URL + "/" + name + ".png"}}}}
+	}
+	prefetchImages(client, page("crawl"), 1)
+	prefetchImages(nil, page("default"), 1)
+	if !slices.Contains(userAgents, agents["/crawl.png"]) {
+		t.Errorf("image fetched with the crawl's client sent User-Agent %q, want one from the built-in list", agents["/crawl.png"])
+	}
+	if slices.Contains(userAgents, agents["/default.png"]) {
+		t.Errorf("image fetched without the crawl's client sent its User-Agent %q", agents["/default.png"])
+	}
+}
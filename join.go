@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf16"
+
+	"github.com/phpdave11/gofpdi"
+)
+
+// joinBatchPages is how many pages of a chunk gofpdi imports at a time.
+// It holds every page it imports until they are all written, and a chunk
+// such as a long table of contents can have many.
+const joinBatchPages = 50
+
+// ptPerMM converts the millimetres gofpdf lays pages out in to PDF points.
+const ptPerMM = 72 / 25.4
+
+// pdfWriter writes a PDF file an object at a time, holding only the
+// offset of each object for the cross-reference table.
+type pdfWriter struct {
+	w       *bufio.Writer
+	n       int   // bytes written so far
+	offsets []int // offsets[i] is where object i+1 starts, 0 until written
+	err     error
+}
+
+// reserve allocates the number of an object to be written later.
+func (pw *pdfWriter) reserve() int {
+	pw.offsets = append(pw.offsets, 0)
+	return len(pw.offsets)
+}
+
+func (pw *pdfWriter) write(s string) {
+	if pw.err != nil {
+		return
+	}
+	var n int
+	n, pw.err = pw.w.WriteString(s)
+	pw.n += n
+}
+
+// object writes object num with body, which ends with endobj when
+// endsWithEndobj is set, as the objects gofpdi imports do.
+func (pw *pdfWriter) object(num int, body string, endsWithEndobj bool) {
+	pw.offsets[num-1] = pw.n
+	pw.write(fmt.Sprintf("%d 0 obj\n", num))
+	pw.write(body)
+	if !endsWithEndobj {
+		pw.write("\nendobj\n")
+	}
+}
+
+// joinPDFChunks writes the pages of the chunks, in order, to a new PDF at
+// path. gofpdi reads each chunk and imports its pages as form XObjects,
+// which are written out before it reads the next pages, so only a few
+// pages are held in memory at a time. The imported pages lose their links and
+// the chunk's outline, so those are added again from what the chunk
+// recorded, with links between chunks pointed at their chapters, and
+// dests become the document's named destinations.
+func joinPDFChunks(chunks []pdfChunk, path string, info pdfInfo, dests []namedDest) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	pw := &pdfWriter{w: bufio.NewWriter(f)}
+	pw.write("%PDF-1.4\n")
+
+	// gofpdi panics on a PDF it cannot read
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("joining PDF chunks: %v", r)
+		}
+	}()
+
+	// Page objects are numbered up front, so links can point ahead
+	pagesObj := pw.reserve()
+	var pageObjs []int
+	for _, chunk := range chunks {
+		for n := 0; n < chunk.Pages; n++ {
+			pageObjs = append(pageObjs, pw.reserve())
+		}
+	}
+
+	// Chapter and heading positions across the whole document; one set
+	// more than once ends up at its last position
+	chapterDests := make(map[string]namedDest)
+	var bookmarks []placedBookmark
+	offset := 0
+	for _, chunk := range chunks {
+		for _, d := range chunk.Links.dests {
+			d.Page += offset
+			chapterDests[d.Name] = d
+		}
+		for _, b := range chunk.Links.bookmarks {
+			b.Page += offset
+			bookmarks = append(bookmarks, b)
+		}
+		offset += chunk.Pages
+	}
+
+	// destArray returns a destination at y mm down the given 1-based page;
+	// gofpdf made every page the same size
+	var pageHeight float64
+	destArray := func(page int, y float64) string {
+		return fmt.Sprintf("[%d 0 R /XYZ 0 %.2f null]", pageObjs[page-1], pageHeight-y*ptPerMM)
+	}
+
+	offset = 0
+	for _, chunk := range chunks {
+		for first := 0; first < chunk.Pages; first += joinBatchPages {
+			last := min(first+joinBatchPages, chunk.Pages)
+			importer := gofpdi.NewImporter()
+			importer.SetSourceFile(chunk.Path)
+			tpls := make([]int, last-first)
+			for i := range tpls {
+				tpls[i] = importer.ImportPage(first+i+1, "/MediaBox")
+			}
+			tplObjs := importer.PutFormXobjectsUnordered()
+
+			// Imported objects refer to each other by hash until numbered
+			objs := importer.GetImportedObjectsUnordered()
+			hashes := make([]string, 0, len(objs))
+			for hash := range objs {
+				hashes = append(hashes, hash)
+			}
+			sort.Strings(hashes)
+			nums := make(map[string]int, len(hashes))
+			for _, hash := range hashes {
+				nums[hash] = pw.reserve()
+			}
+			refs := importer.GetImportedObjHashPos()
+			for _, hash := range hashes {
+				body := objs[hash]
+				for pos, ref := range refs[hash] {
+					copy(body[pos:pos+40], fmt.Sprintf("%40d", nums[ref]))
+				}
+				pw.object(nums[hash], string(body), true)
+			}
+
+			sizes := importer.GetPageSizes()
+			for i, tpl := range tpls {
+				n := first + i + 1
+				box := sizes[n]["/MediaBox"]
+				pageWidth := box["w"]
+				pageHeight = box["h"]
+				name, scaleX, scaleY, tx, ty := importer.UseTemplate(tpl, 0, 0, pageWidth, pageHeight)
+				content := fmt.Sprintf("q %.4f 0 0 %.4f %.4f %.4f cm %s Do Q", scaleX, scaleY, tx, ty+pageHeight, name)
+				contentObj := pw.reserve()
+				pw.object(contentObj, fmt.Sprintf("<</Length %d>>\nstream\n%s\nendstream", len(content), content), false)
+
+				var annots []string
+				for _, l := range chunk.Links.placed {
+					if l.Page != n {
+						continue
+					}
+					rect := fmt.Sprintf("/Rect [%.2f %.2f %.2f %.2f]", l.X*ptPerMM, pageHeight-l.Y*ptPerMM, (l.X+l.W)*ptPerMM, pageHeight-(l.Y+l.H)*ptPerMM)
+					if l.URL != "" {
+						annots = append(annots, fmt.Sprintf("<</Type /Annot /Subtype /Link %s /Border [0 0 0] /A <</S /URI /URI %s>>>>", rect, pdfTextString(l.URL)))
+					} else if d, ok := chapterDests[l.Dest]; ok {
+						annots = append(annots, fmt.Sprintf("<</Type /Annot /Subtype /Link %s /Border [0 0 0] /Dest %s>>", rect, destArray(d.Page, d.Y)))
+					}
+				}
+				page := fmt.Sprintf("<</Type /Page\n/Parent %d 0 R\n/MediaBox [0 0 %.2f %.2f]\n/Resources <</XObject <<%s %d 0 R>>>>\n/Contents %d 0 R",
+					pagesObj, pageWidth, pageHeight, name, nums[tplObjs[name]], contentObj)
+				if len(annots) > 0 {
+					page += "\n/Annots [" + strings.Join(annots, " ") + "]"
+				}
+				pw.object(pageObjs[offset+n-1], page+">>", false)
+			}
+		}
+		offset += chunk.Pages
+	}
+
+	kids := make([]string, len(pageObjs))
+	for i, num := range pageObjs {
+		kids[i] = fmt.Sprintf("%d 0 R", num)
+	}
+	pw.object(pagesObj, fmt.Sprintf("<</Type /Pages\n/Kids [%s]\n/Count %d\n>>", strings.Join(kids, " "), len(pageObjs)), false)
+
+	catalog := fmt.Sprintf("<<\n/Type /Catalog\n/Pages %d 0 R", pagesObj)
+	if len(bookmarks) > 0 {
+		catalog += fmt.Sprintf("\n/Outlines %d 0 R\n/PageMode /UseOutlines", writeOutline(pw, bookmarks, destArray))
+	}
+	if len(dests) > 0 {
+		// Names in a destinations dictionary are sorted, as a name tree's are
+		sort.Slice(dests, func(i, j int) bool { return dests[i].Name < dests[j].Name })
+		var dict strings.Builder
+		dict.WriteString("<<\n")
+		for _, d := range dests {
+			fmt.Fprintf(&dict, "/%s %s\n", pdfName(d.Name), destArray(d.Page, d.Y))
+		}
+		dict.WriteString(">>")
+		destsObj := pw.reserve()
+		pw.object(destsObj, dict.String(), false)
+		catalog += fmt.Sprintf("\n/Dests %d 0 R", destsObj)
+	}
+	catalogObj := pw.reserve()
+	pw.object(catalogObj, catalog+"\n>>", false)
+
+	created := info.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	infoDict := fmt.Sprintf("<<\n/Title %s\n/Author %s\n/Creator %s\n/Keywords %s\n/CreationDate %s\n/ModDate %[5]s",
+		pdfTextString(info.Title), pdfTextString(info.Author), pdfTextString(info.Creator), pdfTextString(info.Keywords), pdfTextString("D:"+created.Format("20060102150405")))
+	if info.Subject != "" {
+		infoDict += "\n/Subject " + pdfTextString(info.Subject)
+	}
+	infoObj := pw.reserve()
+	pw.object(infoObj, infoDict+"\n>>", false)
+
+	xref := pw.n
+	pw.write(fmt.Sprintf("xref\n0 %d\n0000000000 65535 f \n", len(pw.offsets)+1))
+	for _, offset := range pw.offsets {
+		pw.write(fmt.Sprintf("%010d 00000 n \n", offset))
+	}
+	pw.write(fmt.Sprintf("trailer\n<<\n/Size %d\n/Root %d 0 R\n/Info %d 0 R\n>>\nstartxref\n%d\n%%%%EOF\n", len(pw.offsets)+1, catalogObj, infoObj, xref))
+	if pw.err != nil {
+		return pw.err
+	}
+	if err := pw.w.Flush(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeOutline writes the document outline for bookmarks, whose levels
+// step down at most one at a time, and returns the number of its root.
+func writeOutline(pw *pdfWriter, bookmarks []placedBookmark, destArray func(page int, y float64) string) int {
+	root := pw.reserve()
+	nums := make([]int, len(bookmarks))
+	for i := range bookmarks {
+		nums[i] = pw.reserve()
+	}
+
+	// Link each entry to its parent and to its siblings and children
+	parent := make([]int, len(bookmarks))
+	prev, next := make([]int, len(bookmarks)), make([]int, len(bookmarks))
+	first, last := make([]int, len(bookmarks)), make([]int, len(bookmarks))
+	latest := make(map[int]int) // level -> the last entry seen at it
+	level := 0
+	for i, b := range bookmarks {
+		parent[i] = root
+		if b.Level > 0 {
+			p := latest[b.Level-1]
+			parent[i] = nums[p]
+			last[p] = nums[i]
+			if b.Level > level {
+				first[p] = nums[i]
+			}
+		}
+		if b.Level <= level && i > 0 {
+			p := latest[b.Level]
+			next[p] = nums[i]
+			prev[i] = nums[p]
+		}
+		latest[b.Level] = i
+		level = b.Level
+	}
+
+	for i, b := range bookmarks {
+		entry := fmt.Sprintf("<</Title %s\n/Parent %d 0 R", pdfTextString(b.Text), parent[i])
+		for _, ref := range []struct {
+			key string
+			num int
+		}{{"Prev", prev[i]}, {"Next", next[i]}, {"First", first[i]}, {"Last", last[i]}} {
+			if ref.num != 0 {
+				entry += fmt.Sprintf("\n/%s %d 0 R", ref.key, ref.num)
+			}
+		}
+		pw.object(nums[i], entry+"\n/Dest "+destArray(b.Page, b.Y)+"\n/Count 0>>", false)
+	}
+	pw.object(root, fmt.Sprintf("<</Type /Outlines /First %d 0 R\n/Last %d 0 R>>", nums[0], nums[latest[0]]), false)
+	return root
+}
+
+// pdfTextString encodes s as a PDF literal string, in UTF-16 with a byte
+// order mark unless it is ASCII, as gofpdf writes UTF-8 text.
+func pdfTextString(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			var b strings.Builder
+			b.WriteString("\xFE\xFF")
+			for _, u := range utf16.Encode([]rune(s)) {
+				b.WriteByte(byte(u >> 8))
+				b.WriteByte(byte(u))
+			}
+			s = b.String()
+			break
+		}
+	}
+	r := strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", `\r`)
+	return "(" + r.Replace(s) + ")"
+}
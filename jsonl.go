@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+)
+
+// jsonlWriter streams pages to a JSON Lines file, one object per line,
+// flushing after each page so consumers can read the file while the
+// crawl is still running. Page content is written without its heading,
+// code block, image and note markers.
+type jsonlWriter struct {
+	file *textFile
+	buf  *bufio.Writer
+	enc  *json.Encoder
+}
+
+func newJSONLWriter(path string, bom bool) (*jsonlWriter, error) {
+	f, err := createTextFile(path, bom)
+	if err != nil {
+		return nil, err
+	}
+	buf := bufio.NewWriter(f)
+	return &jsonlWriter{file: f, buf: buf, enc: json.NewEncoder(buf)}, nil
+}
+
+func (w *jsonlWriter) write(p Page) error {
+	p.Content = p.unmarkedContent()
+	if err := w.enc.Encode(p); err != nil {
+		return err
+	}
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	return w.file.Flush()
+}
+
+func (w *jsonlWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.file.Close()
+		return err
+	}
+	return w.file.Close()
+}
+
+// writeJSON saves the pages as a single indented JSON array. As in JSON
+// Lines output, the content leaves out the markers of headings, code
+// blocks, images and notes, which have fields of their own.
+func writeJSON(pages []Page, path string, bom bool) error {
+	f, err := createTextFile(path, bom)
+	if err != nil {
+		return err
+	}
+	unmarked := make([]Page, len(pages))
+	for i, p := range pages {
+		p.Content = p.unmarkedContent()
+		unmarked[i] = p
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(unmarked); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONLStreamsPages(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a>`),
+		"/a": htmlPage("A", `<p>Page "A"<br>spans lines.</p><h2>Usage</h2><p>Run it.</p><pre>go run .</pre>`),
+		"/b": htmlPage("B", `<p>Page B.</p>`),
+	})
+	path := filepath.Join(t.TempDir(), "out.jsonl")
+	stream, err := newJSONLWriter(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := func() [][]byte {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	}
+	pages, err := Crawl(testCrawlOptions(srv.URL+"/"), WithOnPageScraped(func(p Page, pr CrawlProgress) {
+		if err := stream.write(p); err != nil {
+			t.Error(err)
+		}
+		// Each page is on disk as soon as it is scraped
+		if n := len(lines()); n != pr.Pages {
+			t.Errorf("file has %d lines after %d pages", n, pr.Pages)
+		}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := lines()
+	if len(got) != len(pages) || len(pages) != 3 {
+		t.Fatalf("file has %d lines for %d pages, want 3 for 3", len(got), len(pages))
+	}
+	for i, line := range got {
+		var p Page
+		if err := json.Unmarshal(line, &p); err != nil {
+			t.Errorf("line %d is not valid JSON: %v\n%s", i+1, err, line)
+			continue
+		}
+		if p.URL != pages[i].URL || p.Content != pages[i].unmarkedContent() {
+			t.Errorf("line %d holds %s with content %q, want %s with %q", i+1, p.URL, p.Content, pages[i].URL, pages[i].unmarkedContent())
+		}
+	}
+}
+
+func TestJSONOmitsMarkers(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p><h2>Usage</h2><p>Run it.</p><pre>go run .</pre><p>Done.</p>`),
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "out.json", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	var pages []Page
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "out.json")), &pages); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("got %d pages, want 1", len(pages))
+	}
+	p := pages[0]
+	if p.Content != "Start here.\n\nRun it.\n\nDone." {
+		t.Errorf("content = %q, want the paragraphs without markers", p.Content)
+	}
+	// The title and the h2, and the code block, keep fields of their own
+	if len(p.Headings) != 2 || len(p.Code) != 1 {
+		t.Errorf("got %d headings and %d code blocks, want 2 and 1", len(p.Headings), len(p.Code))
+	}
+}
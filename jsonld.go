@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// structuredData is the article metadata found in a page's JSON-LD blocks.
+type structuredData struct {
+	Headline      string
+	Author        string
+	DatePublished string
+	DateModified  string
+	Description   string
+}
+
+// extractJSONLD reads the first article-like object from the page's
+// <script type="application/ld+json"> blocks. Blocks may hold a single
+// object, an array of them or an @graph; ones that fail to parse are ignored.
+func extractJSONLD(page *colly.HTMLElement) structuredData {
+	var found structuredData
+	page.ForEachWithBreak(`script[type="application/ld+json"]`, func(_ int, el *colly.HTMLElement) bool {
+		var doc any
+		if err := json.Unmarshal([]byte(el.Text), &doc); err != nil {
+			return true
+		}
+		for _, node := range jsonLDNodes(doc) {
+			headline := jsonLDString(node["headline"])
+			if headline == "" && isArticleType(node["@type"]) {
+				headline = jsonLDString(node["name"])
+			}
+			if headline == "" {
+				continue
+			}
+			found = structuredData{
+				Headline:      headline,
+				Author:        jsonLDString(node["author"]),
+				DatePublished: jsonLDString(node["datePublished"]),
+				DateModified:  jsonLDString(node["dateModified"]),
+				Description:   jsonLDString(node["description"]),
+			}
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+// jsonLDNodes flattens a JSON-LD document into its objects.
+func jsonLDNodes(doc any) []map[string]any {
+	switch v := doc.(type) {
+	case []any:
+		var nodes []map[string]any
+		for _, item := range v {
+			nodes = append(nodes, jsonLDNodes(item)...)
+		}
+		return nodes
+	case map[string]any:
+		if graph, ok := v["@graph"]; ok {
+			return append([]map[string]any{v}, jsonLDNodes(graph)...)
+		}
+		return []map[string]any{v}
+	}
+	return nil
+}
+
+// jsonLDString returns a property as text: strings as is, objects such as
+// a Person by their name, and lists joined with commas.
+func jsonLDString(value any) string {
+	switch v := value.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case map[string]any:
+		return jsonLDString(v["name"])
+	case []any:
+		var parts []string
+		for _, item := range v {
+			if s := jsonLDString(item); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		return strings.Join(parts, ", ")
+	}
+	return ""
+}
+
+// isArticleType reports whether a JSON-LD @type names an article or a blog post.
+func isArticleType(value any) bool {
+	t := jsonLDString(value)
+	return strings.Contains(t, "Article") || strings.Contains(t, "Posting")
+}
+
+// fill copies the structured data into whatever the page's HTML left
+// empty, so explicit markup always wins.
+func (d structuredData) fill(p *Page) {
+	if p.Title == untitledPage && d.Headline != "" {
+		p.Title = d.Headline
+	}
+	m := &p.Metadata
+	for _, field := range []struct {
+		dst *string
+		src string
+	}{
+		{&m.Author, d.Author},
+		{&m.Date, d.DatePublished},
+		{&m.Modified, d.DateModified},
+		{&m.Description, d.Description},
+	} {
+		if *field.dst == "" {
+			*field.dst = field.src
+		}
+	}
+}
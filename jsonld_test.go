@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestJSONLDFillsMissingMetadata(t *testing.T) {
+	jsonLD := `<script type="application/ld+json">{"@context": "https://schema.org", "@graph": [
+		{"@type": "WebSite", "name": "Example Docs"},
+		{"@type": "BlogPosting", "headline": "Release Notes for 2.0", "author": {"@type": "Person", "name": "Sam Lee"},
+		 "datePublished": "2024-03-01", "description": "What changed."}
+	]}</script><script type="application/ld+json">{ not json</script>`
+
+	// With no heading or <title>, JSON-LD is the only reliable title source
+	page := scrapeOne(t, `<html><head>`+jsonLD+`</head><body><article><p>Everything new.</p></article></body></html>`, nil)
+	if page.Title != "Release Notes for 2.0" {
+		t.Errorf("page titled %q, want the JSON-LD headline", page.Title)
+	}
+	if m := page.Metadata; m.Author != "Sam Lee" || m.Date != "2024-03-01" || m.Description != "What changed." {
+		t.Errorf("metadata %+v, want the JSON-LD author, date and description", m)
+	}
+
+	// Explicit markup wins over JSON-LD
+	page = scrapeOne(t, `<html><head><meta name="author" content="Alex Kim">`+jsonLD+`</head>
+		<body><article><h1>Version 2.0</h1><p>Everything new.</p></article></body></html>`, nil)
+	if page.Title != "Version 2.0" {
+		t.Errorf("page titled %q, want its <h1>", page.Title)
+	}
+	if page.Metadata.Author != "Alex Kim" || page.Metadata.Date != "2024-03-01" {
+		t.Errorf("metadata %+v, want the <meta> author and the JSON-LD date", page.Metadata)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// stopWords are common English words that make poor keywords.
+var stopWords = map[string]bool{
+	"about": true, "after": true, "also": true, "because": true, "been": true,
+	"before": true, "being": true, "between": true, "both": true, "could": true,
+	"does": true, "each": true, "from": true, "have": true, "here": true,
+	"into": true, "just": true, "like": true, "more": true, "most": true,
+	"much": true, "must": true, "only": true, "other": true, "over": true,
+	"same": true, "should": true, "some": true, "such": true, "than": true,
+	"that": true, "their": true, "them": true, "then": true, "there": true,
+	"these": true, "they": true, "this": true, "those": true, "through": true,
+	"under": true, "until": true, "very": true, "want": true, "were": true,
+	"what": true, "when": true, "where": true, "which": true, "while": true,
+	"will": true, "with": true, "would": true, "your": true, "heading": true,
+	"block": true, "image": true, "code": true,
+}
+
+// topKeywords returns the n most frequent meaningful words across the
+// pages' titles and content, most frequent first. Words shorter than four
+// letters and stop words are ignored.
+func topKeywords(pages []Page, n int) []string {
+	counts := make(map[string]int)
+	for _, page := range pages {
+		words := strings.FieldsFunc(strings.ToLower(page.Title+" "+page.Content), func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+		for _, word := range words {
+			if len([]rune(word)) >= 4 && !stopWords[word] {
+				counts[word]++
+			}
+		}
+	}
+
+	words := make([]string, 0, len(counts))
+	for word := range counts {
+		words = append(words, word)
+	}
+	sort.Slice(words, func(i, j int) bool {
+		if counts[words[i]] != counts[words[j]] {
+			return counts[words[i]] > counts[words[j]]
+		}
+		return words[i] < words[j]
+	})
+	if len(words) > n {
+		words = words[:n]
+	}
+	return words
+}
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/abadojack/whatlanggo"
+)
+
+// detectLanguage returns the ISO 639-1 code of the language the text is
+// most likely written in, or the ISO 639-3 code for languages without
+// one. declared, typically the <html lang> attribute, is returned instead
+// when the detector is not confident, as with short or mixed-language
+// text and languages it does not know.
+func detectLanguage(text, declared string) string {
+	info := whatlanggo.Detect(text)
+	if !info.IsReliable() {
+		// Reduce tags like "en-US" to the primary language
+		primary, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(declared)), "-")
+		return primary
+	}
+	if code := info.Lang.Iso6391(); code != "" {
+		return code
+	}
+	return info.Lang.Iso6393()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Getting started", `<p>This is the guide for new users. It explains how to install the tool and how to use it with the rest of your project.</p><a href="/fr">Français</a>`),
+		// The declared language is wrong, as copied templates often leave it
+		"/fr": `<html lang="en"><head><title>Démarrage</title></head><body><article><h1>Démarrage</h1>
+			<p>Voici le guide pour les nouveaux utilisateurs. Il explique comment installer la bibliothèque et comment l'utiliser dans un projet avec les autres outils.</p></article></body></html>`,
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Extract.DetectLanguage = true
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("crawl returned %d pages, want 2", len(pages))
+	}
+	for i, want := range []string{"en", "fr"} {
+		if pages[i].Language != want {
+			t.Errorf("%s detected as %q, want %q", pages[i].URL, pages[i].Language, want)
+		}
+	}
+
+	data, err := json.Marshal(pages[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"language":"fr"`) {
+		t.Errorf("JSON %s lacks the language", data)
+	}
+	pdfOpts := testPDFOptions()
+	pdfOpts.ShowMetadata = true
+	if text := renderPDF(t, pages[1:], pdfOpts).AllText(); !strings.Contains(text, "Language: fr") {
+		t.Errorf("-show-metadata PDF lacks the language:\n%s", text)
+	}
+
+	opts.Extract.DetectLanguage = false
+	if pages, _ = Crawl(opts); pages[0].Language != "" {
+		t.Errorf("language %q recorded without -detect-language", pages[0].Language)
+	}
+}
+
+func TestDetectLanguageFallsBackToDeclared(t *testing.T) {
+	for _, tc := range []struct {
+		name, text, declared, want string
+	}{
+		{"russian", "Это руководство для новых пользователей. Оно объясняет, как установить инструмент и как использовать его в проекте.", "en", "ru"},
+		// Too short to judge
+		{"short", "Hallo!", "de-AT", "de"},
+		{"short undeclared", "Run go build.", "", ""},
+		// Several languages in one sentence
+		{"mixed", "Install the Werkzeug und die Bibliothek avec les outils pour le projet.", "en", "en"},
+		// Welsh is not a language the detector knows
+		{"unknown", "Mae'r canllaw hwn ar gyfer defnyddwyr newydd. Mae'n esbonio sut i osod yr offeryn a sut i'w ddefnyddio gyda gweddill eich prosiect.", "cy", "cy"},
+		{"unknown undeclared", "Mae'r canllaw hwn ar gyfer defnyddwyr newydd. Mae'n esbonio sut i osod yr offeryn a sut i'w ddefnyddio gyda gweddill eich prosiect.", "", ""},
+	} {
+		if got := detectLanguage(tc.text, tc.declared); got != tc.want {
+			t.Errorf("%s: detectLanguage = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// Link is a hyperlink found in a page's prose, with URL resolved to absolute form.
+type Link struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// resolveAnchor finds the chapter a link points to and, when its fragment
+// matches a heading ID on that page, the heading index. heading is -1 when
+// the link targets the chapter as a whole. URLs are compared normalized,
+// with trailing slashes stripped, so a link matches its page however
+// the crawl was told to normalize them.
+func resolveAnchor(pages []Page, rawURL string) (chapter, heading int, ok bool) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return 0, 0, false
+	}
+	fragment := target.Fragment
+	base := normalizeURL(rawURL, "strip")
+
+	for i, page := range pages {
+		if normalizeURL(page.URL, "strip") != base {
+			continue
+		}
+		if fragment != "" {
+			for j, h := range page.Headings {
+				if h.ID == fragment {
+					return i, j, true
+				}
+			}
+		}
+		return i, -1, true
+	}
+	return 0, 0, false
+}
+
+// chunkDestScheme prefixes the URIs that link to chapters rendered into
+// another chunk of a chunked PDF; joinPDFChunks links them to the chapter
+// when it joins the chunks.
+const chunkDestScheme = "pdf-scraper-dest:"
+
+// chapterDest names the destination of chapter i, or of its heading j
+// when j is not negative, in a chunked PDF.
+func chapterDest(i, j int) string {
+	if j < 0 {
+		return fmt.Sprintf("pdf-scraper.chapter.%d", i+1)
+	}
+	return fmt.Sprintf("pdf-scraper.chapter.%d.%d", i+1, j+1)
+}
+
+// pdfLinks holds the internal PDF link IDs for the chapters from first up
+// to last and their headings. Other chapters are in another chunk of a
+// chunked PDF and are linked to by destination name instead.
+type pdfLinks struct {
+	chapters    []int
+	headings    [][]int
+	first, last int
+	// names holds the destination name of each internal link ID
+	names map[int]string
+	// dests records where each linked chapter and heading was placed
+	dests []namedDest
+	// placed and bookmarks record every link drawn and outline entry
+	// added, which a chunk's pages lose when they are joined
+	placed    []placedLink
+	bookmarks []placedBookmark
+	// recordOnly records links without drawing them, for a chunk whose
+	// links are drawn when it is joined
+	recordOnly bool
+}
+
+// placedLink is a link drawn on a page: its area, in mm from the top left
+// corner, and either the destination name of a chapter or a URL.
+type placedLink struct {
+	Page       int
+	X, Y, W, H float64
+	Dest       string
+	URL        string
+}
+
+// placedBookmark is an outline entry pointing at a position on a page.
+type placedBookmark struct {
+	Text  string
+	Level int
+	Page  int
+	Y     float64
+}
+
+func newPDFLinks(pdf *gofpdf.Fpdf, pages []Page, first, last int) *pdfLinks {
+	links := &pdfLinks{
+		chapters: make([]int, len(pages)),
+		headings: make([][]int, len(pages)),
+		first:    first,
+		last:     last,
+		names:    make(map[int]string),
+	}
+	for i := first; i < last; i++ {
+		links.chapters[i] = pdf.AddLink()
+		links.names[links.chapters[i]] = chapterDest(i, -1)
+		links.headings[i] = make([]int, len(pages[i].Headings))
+		for j := range pages[i].Headings {
+			links.headings[i][j] = pdf.AddLink()
+			links.names[links.headings[i][j]] = chapterDest(i, j)
+		}
+	}
+	return links
+}
+
+// target returns the link to chapter i, or to its heading j when j is not
+// negative: an internal link ID, or a chunk destination URI when the
+// chapter is not in this document.
+func (l *pdfLinks) target(i, j int) (int, string) {
+	if i < l.first || i >= l.last {
+		return 0, chunkDestScheme + chapterDest(i, j)
+	}
+	if j < 0 {
+		return l.chapters[i], ""
+	}
+	return l.headings[i][j], ""
+}
+
+// set points the link to chapter i, or to its heading j, at the current position.
+func (l *pdfLinks) set(pdf *gofpdf.Fpdf, i, j int) {
+	link, _ := l.target(i, j)
+	pdf.SetLink(link, -1, -1)
+	l.dests = append(l.dests, namedDest{Name: chapterDest(i, j), Page: pdf.PageNo(), Y: pdf.GetY()})
+}
+
+// bookmark adds an outline entry at the current position.
+func (l *pdfLinks) bookmark(pdf *gofpdf.Fpdf, text string, level int) {
+	pdf.Bookmark(text, level, -1)
+	l.bookmarks = append(l.bookmarks, placedBookmark{Text: text, Level: level, Page: pdf.PageNo(), Y: pdf.GetY()})
+}
+
+// cell writes a one-line cell linked to link, or to linkStr when that is
+// set, as CellFormat does without moving to the next line. A width of 0
+// extends the cell to the right margin.
+func (l *pdfLinks) cell(pdf *gofpdf.Fpdf, w, h float64, text, align string, link int, linkStr string) {
+	if w == 0 {
+		pageWidth, _ := pdf.GetPageSize()
+		_, _, right, _ := pdf.GetMargins()
+		w = pageWidth - right - pdf.GetX()
+	}
+	if l.recordOnly {
+		pdf.CellFormat(w, h, text, "", 0, align, false, 0, "")
+	} else {
+		pdf.CellFormat(w, h, text, "", 0, align, false, link, linkStr)
+	}
+	// The cell may have moved to the top of a new page, but never wraps
+	l.record(pdf, pdf.GetX()-w, pdf.GetY(), w, h, link, linkStr)
+}
+
+// write writes text inline, as Write flows it, linked to link or linkStr.
+// It writes a word at a time, each word ending up on a single line, so
+// that the area of each can be recorded.
+func (l *pdfLinks) write(pdf *gofpdf.Fpdf, h float64, text string, link int, linkStr string) {
+	for i, word := range strings.Split(text, " ") {
+		if i > 0 {
+			pdf.Write(h, " ")
+		}
+		if word == "" {
+			continue
+		}
+		switch {
+		case l.recordOnly:
+			pdf.Write(h, word)
+		case linkStr != "":
+			pdf.WriteLinkString(h, word, linkStr)
+		default:
+			pdf.WriteLinkID(h, word, link)
+		}
+		w := pdf.GetStringWidth(word)
+		l.record(pdf, pdf.GetX()-w, pdf.GetY(), w, h, link, linkStr)
+	}
+}
+
+// record notes a link drawn on the current page.
+func (l *pdfLinks) record(pdf *gofpdf.Fpdf, x, y, w, h float64, link int, linkStr string) {
+	placed := placedLink{Page: pdf.PageNo(), X: x, Y: y, W: w, H: h}
+	switch {
+	case strings.HasPrefix(linkStr, chunkDestScheme):
+		placed.Dest = strings.TrimPrefix(linkStr, chunkDestScheme)
+	case linkStr != "":
+		placed.URL = linkStr
+	default:
+		placed.Dest = l.names[link]
+	}
+	l.placed = append(l.placed, placed)
+}
+
+// lookup returns the link for a URL that points into the document, as
+// target does.
+func (l *pdfLinks) lookup(pages []Page, rawURL string) (int, string, bool) {
+	chapter, heading, ok := resolveAnchor(pages, rawURL)
+	if !ok {
+		return 0, "", false
+	}
+	link, linkStr := l.target(chapter, heading)
+	return link, linkStr, true
+}
+
+// textRun is a span of a paragraph written in one style: plain text, or the
+// text of a link with its target.
+type textRun struct {
+	Text    string
+	Linked  bool
+	LinkID  int    // internal link, when LinkStr is empty
+	LinkStr string // destination name or URL
+}
+
+// linkRuns splits a paragraph into plain and linked runs, turning the text
+// of each of the page's links into a linked run. Links are consumed in
+// document order starting at *next, which is advanced past those found in
+// this paragraph.
+func linkRuns(para string, pageLinks []Link, next *int, pages []Page, links *pdfLinks) []textRun {
+	var runs []textRun
+	rest := para
+	for *next < len(pageLinks) {
+		link := pageLinks[*next]
+		idx := strings.Index(rest, link.Text)
+		if idx < 0 {
+			break
+		}
+		if idx > 0 {
+			runs = append(runs, textRun{Text: rest[:idx]})
+		}
+		run := textRun{Text: link.Text, Linked: true, LinkStr: link.URL}
+		if linkID, dest, ok := links.lookup(pages, link.URL); ok {
+			run.LinkID, run.LinkStr = linkID, dest
+		}
+		runs = append(runs, run)
+		rest = rest[idx+len(link.Text):]
+		*next++
+	}
+	if rest != "" {
+		runs = append(runs, textRun{Text: rest})
+	}
+	return runs
+}
+
+// writeLinkedParagraph writes a paragraph's runs inline, as Write flows
+// text, with linked runs clickable.
+func writeLinkedParagraph(pdf *gofpdf.Fpdf, lineHeight float64, runs []textRun, links *pdfLinks) {
+	for _, run := range runs {
+		if !run.Linked {
+			pdf.Write(lineHeight, run.Text)
+			continue
+		}
+		pdf.SetTextColor(0, 0, 238)
+		links.write(pdf, lineHeight, run.Text, run.LinkID, run.LinkStr)
+		pdf.SetTextColor(0, 0, 0)
+	}
+	pdf.Ln(lineHeight)
+}
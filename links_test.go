@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestFragmentLinkResolvesToHeading(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":     htmlPage("Home", `<p>See <a href="/page#install">installing</a> first.</p><a href="/page">Page</a>`),
+		"/page": htmlPage("Page", `<p>Intro.</p><h2>Usage</h2><p>Run it.</p><h2 id="install">Installing</h2><p>Get it.</p>`),
+	})
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /page" {
+		t.Fatalf("crawl returned pages %s, want / /page", got)
+	}
+
+	chapter, heading, ok := resolveAnchor(pages, srv.URL+"/page#install")
+	if !ok || chapter != 1 || heading < 0 || pages[1].Headings[heading].ID != "install" {
+		t.Fatalf("resolveAnchor = %d, %d, %v, want the heading with id install on /page", chapter, heading, ok)
+	}
+	if _, heading, _ := resolveAnchor(pages, srv.URL+"/page#missing"); heading != -1 {
+		t.Errorf("an unknown fragment resolved to heading %d, want the chapter", heading)
+	}
+
+	// The link becomes an internal link, not one to the site
+	pdf := renderPDF(t, pages, testPDFOptions())
+	if bytes.Contains(pdf.Raw, []byte("/URI ("+srv.URL+"/page#install)")) {
+		t.Error("the fragment link points at the site, want an internal link")
+	}
+	if !bytes.Contains(pdf.Raw, []byte("/Dest [")) {
+		t.Error("the PDF has no internal links")
+	}
+}
+
+func TestResolveAnchorNormalizesURLs(t *testing.T) {
+	pages := []Page{
+		{URL: "https://example.com/"},
+		{URL: "https://example.com/docs/", Headings: []Heading{{Level: 2, Text: "Setup", ID: "setup"}}},
+		{URL: "https://example.com/guide"},
+	}
+	for _, tc := range []struct {
+		link             string
+		chapter, heading int
+	}{
+		{"https://EXAMPLE.com", 0, -1},
+		{"https://example.com/index.html", 0, -1},
+		{"https://example.com/docs/index.html#setup", 1, 0},
+		{"https://example.com/docs#setup", 1, 0},
+		{"https://example.com/guide/", 2, -1},
+	} {
+		chapter, heading, ok := resolveAnchor(pages, tc.link)
+		if !ok || chapter != tc.chapter || heading != tc.heading {
+			t.Errorf("resolveAnchor(%q) = %d, %d, %v, want %d, %d, true", tc.link, chapter, heading, ok, tc.chapter, tc.heading)
+		}
+	}
+	if _, _, ok := resolveAnchor(pages, "https://example.com/other"); ok {
+		t.Error("a link to a page not in the document resolved")
+	}
+}
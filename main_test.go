@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain runs the command itself when runMain re-executes the test binary.
+func TestMain(m *testing.M) {
+	if os.Getenv("PDF_SCRAPER_RUN_MAIN") == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runMain runs the command with args in a new temporary directory and
+// returns that directory, its combined output and its exit status.
+func runMain(t testing.TB, args ...string) (dir, output string, status int) {
+	t.Helper()
+	dir = t.TempDir()
+	exe, err := filepath.Abs(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Crawl the test servers without the polite default delay
+	cmd := exec.Command(exe, append([]string{"-delay", "0"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "PDF_SCRAPER_RUN_MAIN=1")
+	out, err := cmd.CombinedOutput()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		status = exitErr.ExitCode()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return dir, string(out), status
+}
+
+func TestFormatFromOutputExtension(t *testing.T) {
+	srv := testSite(t, map[string]string{"/": htmlPage("Home", `<p>Start here.</p>`)})
+
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "x.md", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "x.md"))
+	if err != nil {
+		t.Fatalf("no Markdown written: %v\n%s", err, out)
+	}
+	if !bytes.HasPrefix(data, []byte("# ")) || !strings.Contains(string(data), "Start here.") {
+		t.Errorf("x.md is not the Markdown of the page:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x.md.pdf")); err == nil {
+		t.Error("a PDF was written as well")
+	}
+
+	// An explicit -format wins over the extension
+	dir, out, status = runMain(t, "-url", srv.URL+"/", "-output", "x.md", "-format", "json", "-deterministic")
+	if status != 0 {
+		t.Fatalf("-format json: exit status %d:\n%s", status, out)
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "x.md")); err != nil || !bytes.HasPrefix(data, []byte("[")) {
+		t.Errorf("-format json -output x.md did not write JSON to x.md: %v\n%s", err, data)
+	}
+}
+
+func TestFormatForPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"x.md":            "markdown",
+		"x.markdown":      "markdown",
+		"docs/pages.json": "json",
+		"pages.jsonl":     "jsonl",
+		"pages.ndjson":    "jsonl",
+		"site.HTML":       "html",
+		"rows.csv":        "csv",
+		"pages.json.gz":   "json",
+		"book.pdf":        "pdf",
+		"book.epub":       "pdf",
+		"book":            "pdf",
+		"out/":            "markdown",
+	} {
+		if got := formatForPath(path); got != want {
+			t.Errorf("formatForPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestRequestTimeoutDefaultFitsTimeout(t *testing.T) {
+	srv := testSite(t, map[string]string{"/": htmlPage("Home", `<p>Start here.</p>`)})
+
+	// The default -request-timeout of 30 shrinks to a shorter -timeout
+	_, out, status := runMain(t, "-url", srv.URL+"/", "-output", "x.md", "-timeout", "10")
+	if status != 0 {
+		t.Fatalf("-timeout 10 alone: exit status %d:\n%s", status, out)
+	}
+
+	// An explicit -request-timeout over -timeout is still rejected
+	_, out, status = runMain(t, "-url", srv.URL+"/", "-output", "x.md", "-timeout", "10", "-request-timeout", "20")
+	if status == 0 || !strings.Contains(out, "Invalid -request-timeout 20") {
+		t.Errorf("-request-timeout 20 -timeout 10: exit status %d, want a validation error:\n%s", status, out)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// crawlManifest records what a run did, for auditing and reproducing it:
+// the options used, every page captured and every request that failed. It
+// is safe for concurrent use by colly's callbacks.
+type crawlManifest struct {
+	mu       sync.Mutex
+	started  time.Time
+	statuses map[string]int // final URL -> HTTP status
+	errors   []manifestError
+}
+
+// Manifest is the JSON document written with -manifest.
+type Manifest struct {
+	StartURL  string            `json:"start_url"`
+	StartedAt string            `json:"started_at"`
+	Options   map[string]string `json:"options"`
+	Pages     []manifestPage    `json:"pages"`
+	Errors    []manifestError   `json:"errors"`
+	Stats     StatsSummary      `json:"stats"`
+}
+
+type manifestPage struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Depth    int    `json:"depth"`
+	Status   int    `json:"status"`
+	Checksum string `json:"checksum"`
+}
+
+type manifestError struct {
+	URL    string `json:"url"`
+	Status int    `json:"status,omitempty"`
+	Error  string `json:"error"`
+	err    error
+}
+
+func newCrawlManifest(started time.Time) *crawlManifest {
+	return &crawlManifest{started: started, statuses: make(map[string]int)}
+}
+
+func (m *crawlManifest) recordStatus(u string, status int) {
+	m.mu.Lock()
+	m.statuses[u] = status
+	m.mu.Unlock()
+}
+
+func (m *crawlManifest) recordError(u string, status int, err error) {
+	m.mu.Lock()
+	m.errors = append(m.errors, manifestError{URL: u, Status: status, Error: err.Error(), err: err})
+	m.mu.Unlock()
+}
+
+// secretOptions are the flags whose values may hold credentials, or
+// the secrets themselves, and are never written to a manifest.
+var secretOptions = map[string]bool{"client-key": true, "content-filter-cmd": true, "redact": true}
+
+// manifestOption returns the value of the named flag as a manifest records
+// it: secret-bearing values are redacted and URLs lose their user info,
+// such as a proxy's user name and password.
+func manifestOption(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretOptions[name] {
+		return redactedText
+	}
+	switch name {
+	case "url", "proxy":
+		// -proxy may chain several URLs, separated by commas
+		urls := strings.Split(value, ",")
+		for i, raw := range urls {
+			if u, err := url.Parse(strings.TrimSpace(raw)); err == nil && u.User != nil {
+				u.User = nil
+				urls[i] = u.String()
+			}
+		}
+		return strings.Join(urls, ",")
+	}
+	return value
+}
+
+// failures returns the last error of each URL whose final request
+// failed. A URL that succeeded on a retry has not failed.
+func (m *crawlManifest) failures() map[string]manifestError {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	failed := make(map[string]manifestError)
+	for _, e := range m.errors {
+		if _, ok := m.statuses[e.URL]; !ok {
+			failed[e.URL] = e
+		}
+	}
+	return failed
+}
+
+// build assembles the manifest for the captured pages, recording options
+// as the run's options.
+func (m *crawlManifest) build(startURL string, options map[string]string, pages []Page, stats StatsSummary) Manifest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	manifest := Manifest{
+		StartURL:  startURL,
+		StartedAt: m.started.UTC().Format(time.RFC3339),
+		Options:   make(map[string]string),
+		Pages:     make([]manifestPage, 0, len(pages)),
+		Errors:    []manifestError{},
+		Stats:     stats,
+	}
+	// Only each URL's final failure is an error: earlier attempts that a
+	// retry recovered from, or that a later attempt superseded, are not
+	final := make(map[string]int)
+	for i, e := range m.errors {
+		if _, ok := m.statuses[e.URL]; !ok {
+			final[e.URL] = i
+		}
+	}
+	for i, e := range m.errors {
+		if last, ok := final[e.URL]; ok && last == i {
+			manifest.Errors = append(manifest.Errors, e)
+		}
+	}
+	for name, value := range options {
+		manifest.Options[name] = value
+	}
+	for _, p := range pages {
+		// Split pages share the status of the document they came from
+		pageURL := p.URL
+		if u, err := url.Parse(p.URL); err == nil {
+			u.Fragment = ""
+			pageURL = u.String()
+		}
+		manifest.Pages = append(manifest.Pages, manifestPage{URL: p.URL, Title: p.Title, Depth: p.Depth, Status: m.statuses[pageURL], Checksum: p.Checksum})
+	}
+	return manifest
+}
+
+// WriteJSON saves the manifest as JSON to the given file.
+func (m Manifest) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a> <a href="/missing">Missing</a>`),
+		"/a": htmlPage("Page A", `<p>Page A.</p>`),
+		"/b": htmlPage("Page B", `<p>Page B.</p>`),
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "pages.json", "-manifest", "manifest.json", "-deterministic", "-retries", "0", "-depth", "2")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	var pages []Page
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "pages.json")), &pages); err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "manifest.json")), &manifest); err != nil {
+		t.Fatalf("manifest is not JSON: %v\n%s", err, out)
+	}
+
+	if manifest.StartURL != srv.URL+"/" || manifest.StartedAt == "" {
+		t.Errorf("manifest starts at %q on %q, want %s/ and a timestamp", manifest.StartURL, manifest.StartedAt, srv.URL)
+	}
+	if got := manifest.Options["depth"]; got != "2" {
+		t.Errorf("manifest records -depth %q, want 2", got)
+	}
+	if len(manifest.Pages) != len(pages) || len(pages) != 3 {
+		t.Fatalf("manifest lists %d pages for the %d captured, want 3:\n%+v", len(manifest.Pages), len(pages), manifest.Pages)
+	}
+	for i, p := range pages {
+		want := manifestPage{URL: p.URL, Title: p.Title, Depth: p.Depth, Status: 200, Checksum: p.Checksum}
+		if manifest.Pages[i] != want || p.Checksum == "" {
+			t.Errorf("manifest page %d is %+v, want %+v", i, manifest.Pages[i], want)
+		}
+	}
+	if len(manifest.Errors) != 1 || manifest.Errors[0].URL != srv.URL+"/missing" || manifest.Errors[0].Status != 404 {
+		t.Errorf("manifest errors %+v, want the 404 for /missing", manifest.Errors)
+	}
+}
+
+func TestManifestOptionsFromCaller(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p>`),
+	})
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Manifest = path
+	opts.ManifestOptions = map[string]string{"run": "nightly"}
+	if _, err := Crawl(opts); err != nil {
+		t.Fatal(err)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(readOutput(t, path), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	// The test binary's own flags are not the crawl's options
+	if len(manifest.Options) != 1 || manifest.Options["run"] != "nightly" {
+		t.Errorf("manifest records options %v, want only run=nightly", manifest.Options)
+	}
+}
+
+func TestManifestErrorsSkipRecoveredURLs(t *testing.T) {
+	var mu sync.Mutex
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		hits++
+		first := hits == 1
+		mu.Unlock()
+		if first {
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(htmlPage("Home", `<p>Finally.</p><a href="/missing">Missing</a>`)))
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Retries = 2
+	opts.Manifest = path
+	Crawl(opts)
+	var manifest Manifest
+	if err := json.Unmarshal(readOutput(t, path), &manifest); err != nil {
+		t.Fatal(err)
+	}
+	// The 429 the retry recovered from is not an error; the 404 is
+	if len(manifest.Errors) != 1 || manifest.Errors[0].URL != srv.URL+"/missing" {
+		t.Errorf("manifest errors %+v, want only the 404 for /missing", manifest.Errors)
+	}
+}
+
+func TestManifestRedactsSecrets(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p>`),
+	})
+	// The test server doubles as the HTTP proxy, serving absolute-URL requests by path
+	proxy := strings.Replace(srv.URL, "http://", "http://scraper:s3cret@", 1)
+
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "pages.json", "-manifest", "manifest.json",
+		"-proxy", proxy, "-content-filter-cmd", "cat", "-redact", "hunter2")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	data := readOutput(t, filepath.Join(dir, "manifest.json"))
+	for _, secret := range []string{"s3cret", "scraper", "hunter2"} {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("manifest contains %q:\n%s", secret, data)
+		}
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	if got := manifest.Options["proxy"]; got != srv.URL {
+		t.Errorf("manifest records -proxy %q, want %s without its user info", got, srv.URL)
+	}
+}
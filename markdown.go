@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// markdownOptions controls how scraped pages are laid out as Markdown.
+type markdownOptions struct {
+	TOCDepth int
+	// TOCTitle heads the table of contents; TOCPosition places it at the
+	// "start" or "end" of the document, or "none" to leave it out.
+	TOCTitle    string
+	TOCPosition string
+	// MaxTOCEntries caps the sections listed per chapter; 0 lists all.
+	MaxTOCEntries int
+	Numbering     string
+	NoSource      bool
+	BOM           bool
+}
+
+// writeMarkdown renders the pages as one Markdown document: a table of
+// contents followed by a top-level section per page.
+func writeMarkdown(pages []Page, path string, opts markdownOptions) error {
+	f, err := createTextFile(path, opts.BOM)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+
+	// Table of contents, linking to the anchors Markdown renderers
+	// generate for headings. Anchors are numbered in document order, so
+	// the TOC heading only claims its slug when it comes first.
+	var toc strings.Builder
+	fmt.Fprintf(&toc, "# %s\n\n", opts.TOCTitle)
+	slugs := slugger{}
+	if opts.TOCPosition == "start" {
+		slugs.unique(slugify(opts.TOCTitle))
+	}
+	indents := tocIndents(pages)
+	for i, page := range pages {
+		title := numberedTitle(page.Title, opts.Numbering, i+1)
+		fmt.Fprintf(&toc, "%s- [%s](#%s)\n", indents[i], title, slugs.unique(slugify(title)))
+		headingSlugs := markdownHeadingSlugs(page, slugs)
+		listed, more := page.tocSections(opts.TOCDepth, opts.MaxTOCEntries)
+		for n, j := range listed {
+			fmt.Fprintf(&toc, "%s  - [%s](#%s)\n", indents[i], numberedTitle(page.Headings[j].Text, opts.Numbering, i+1, n+1), headingSlugs[j])
+		}
+		if more > 0 {
+			fmt.Fprintf(&toc, "%s  - %s\n", indents[i], tocRollup(more))
+		}
+	}
+	toc.WriteString("\n")
+
+	if opts.TOCPosition == "start" {
+		io.WriteString(w, toc.String())
+	}
+	for i, page := range pages {
+		writeMarkdownChapter(w, page, numberedTitle(page.Title, opts.Numbering, i+1), opts)
+	}
+	if opts.TOCPosition == "end" {
+		io.WriteString(w, toc.String())
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writeMarkdownDir writes each page to its own Markdown file in dir, named
+// after its position and title, plus an index.md linking to all of them.
+func writeMarkdownDir(pages []Page, dir string, opts markdownOptions) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	var index strings.Builder
+	fmt.Fprintf(&index, "# %s\n\n", opts.TOCTitle)
+	digits := len(strconv.Itoa(len(pages)))
+	indents := tocIndents(pages)
+	for i, page := range pages {
+		name := fmt.Sprintf("%0*d", digits, i+1)
+		if slug := slugify(page.Title); slug != "" {
+			name += "-" + slug
+		}
+		name += ".md"
+		title := numberedTitle(page.Title, opts.Numbering, i+1)
+		fmt.Fprintf(&index, "%s- [%s](%s)\n", indents[i], title, name)
+		slugs := slugger{}
+		slugs.unique(slugify(title))
+		headingSlugs := markdownHeadingSlugs(page, slugs)
+		listed, more := page.tocSections(opts.TOCDepth, opts.MaxTOCEntries)
+		for n, j := range listed {
+			fmt.Fprintf(&index, "%s  - [%s](%s#%s)\n", indents[i], numberedTitle(page.Headings[j].Text, opts.Numbering, i+1, n+1), name, headingSlugs[j])
+		}
+		if more > 0 {
+			fmt.Fprintf(&index, "%s  - %s\n", indents[i], tocRollup(more))
+		}
+
+		f, err := createTextFile(filepath.Join(dir, name), opts.BOM)
+		if err != nil {
+			return err
+		}
+		w := bufio.NewWriter(f)
+		writeMarkdownChapter(w, page, title, opts)
+		if err := w.Flush(); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+
+	f, err := createTextFile(filepath.Join(dir, "index.md"), opts.BOM)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, index.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// markdownHeadingSlugs returns the anchors a Markdown renderer gives the
+// page's headings, taken from slugs in document order. Only h2 and deeper
+// headings are written out, so h1 entries are left empty.
+func markdownHeadingSlugs(page Page, slugs slugger) []string {
+	headingSlugs := make([]string, len(page.Headings))
+	for j, heading := range page.Headings {
+		if heading.Level >= 2 {
+			headingSlugs[j] = slugs.unique(slugify(heading.Text))
+		}
+	}
+	return headingSlugs
+}
+
+// tocIndents returns the list indentation of each page's table of contents
+// entry, two spaces per level of crawl depth, so pages found deeper in the
+// site nest under the ones before them. An entry is never nested more than
+// one level below the previous one, which would break the Markdown list.
+func tocIndents(pages []Page) []string {
+	indents := make([]string, len(pages))
+	level := -1
+	for i, page := range pages {
+		level = min(page.Depth, level+1)
+		indents[i] = strings.Repeat("  ", level)
+	}
+	return indents
+}
+
+// writeMarkdownChapter writes one page as a top-level section.
+func writeMarkdownChapter(w *bufio.Writer, page Page, title string, opts markdownOptions) {
+	fmt.Fprintf(w, "# %s\n\n", title)
+	if !opts.NoSource {
+		fmt.Fprintf(w, "*Source: <%s>*\n\n", page.URL)
+	}
+	writeMarkdownContent(w, page)
+}
+
+// writeMarkdownContent writes a page's paragraphs, expanding the heading,
+// code block, image and note markers in its content.
+func writeMarkdownContent(w *bufio.Writer, page Page) {
+	for _, para := range strings.Split(page.Content, "\n\n") {
+		if strings.TrimSpace(para) == "" {
+			continue
+		}
+
+		var n int
+		switch {
+		case strings.HasPrefix(para, "[Heading "):
+			fmt.Sscanf(para, "[Heading %d]", &n)
+			if n > 0 && n <= len(page.Headings) {
+				heading := page.Headings[n-1]
+				fmt.Fprintf(w, "%s %s\n\n", strings.Repeat("#", heading.Level), strings.TrimSpace(heading.Text))
+			}
+		case strings.HasPrefix(para, "[Code Block "):
+			fmt.Sscanf(para, "[Code Block %d]", &n)
+			if n > 0 && n <= len(page.Code) {
+				if caption := page.codeCaption(n - 1); caption != "" {
+					fmt.Fprintf(w, "**%s**\n\n", caption)
+				}
+				fmt.Fprintf(w, "```\n%s\n```\n\n", strings.TrimRight(page.Code[n-1], "\n"))
+			}
+		case strings.HasPrefix(para, "[Image "):
+			fmt.Sscanf(para, "[Image %d]", &n)
+			if n > 0 && n <= len(page.Images) {
+				img := page.Images[n-1]
+				fmt.Fprintf(w, "![%s](%s)\n\n", img.Alt, img.URL)
+			}
+		case strings.HasPrefix(para, "[Note "):
+			fmt.Sscanf(para, "[Note %d]", &n)
+			if n > 0 && n <= len(page.Notes) {
+				note := page.Notes[n-1]
+				fmt.Fprintf(w, "> **%s**\n>\n", note.Label)
+				for _, line := range strings.Split(note.Text, "\n") {
+					if item, ok := strings.CutPrefix(line, "• "); ok {
+						line = "- " + item
+					}
+					fmt.Fprintf(w, "> %s\n", line)
+				}
+				fmt.Fprint(w, "\n")
+			}
+		default:
+			// List items keep one per line; breaks within prose become
+			// Markdown hard line breaks
+			lines := strings.Split(strings.TrimSpace(para), "\n")
+			for j, line := range lines {
+				if item, ok := strings.CutPrefix(line, "• "); ok {
+					lines[j] = "- " + item
+				} else if j < len(lines)-1 {
+					lines[j] = line + "  "
+				}
+			}
+			fmt.Fprintf(w, "%s\n\n", strings.Join(lines, "\n"))
+		}
+	}
+}
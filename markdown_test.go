@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var markdownLinkPattern = regexp.MustCompile(`\]\(([^)#]+)(#[^)]*)?\)`)
+
+func TestMarkdownDirIndex(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/b">B</a>`),
+		"/a": htmlPage("Install Guide", `<h2>Steps</h2><p>Page A.</p>`),
+		"/b": htmlPage("Reference", `<p>Page B.</p>`),
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "site/docs/", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	docs := filepath.Join(dir, "site", "docs")
+	index, err := os.ReadFile(filepath.Join(docs, "index.md"))
+	if err != nil {
+		t.Fatalf("no index written: %v\n%s", err, out)
+	}
+
+	linked := make(map[string]bool)
+	for _, m := range markdownLinkPattern.FindAllStringSubmatch(string(index), -1) {
+		linked[m[1]] = true
+	}
+	entries, err := os.ReadDir(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.Name() != "index.md" {
+			files = append(files, e.Name())
+		}
+	}
+	if got := strings.Join(files, " "); got != "1-home.md 2-install-guide.md 3-reference.md" {
+		t.Errorf("wrote files %s, want one per page", got)
+	}
+	for _, name := range files {
+		if !linked[name] {
+			t.Errorf("index does not link to %s:\n%s", name, index)
+		}
+		delete(linked, name)
+	}
+	for name := range linked {
+		t.Errorf("index links to %s, which was not written", name)
+	}
+	if !strings.Contains(string(index), "(2-install-guide.md#steps)") {
+		t.Errorf("index lacks the link to the Steps section:\n%s", index)
+	}
+}
+
+func TestMarkdownTOCIndentsByDepth(t *testing.T) {
+	pages := []Page{
+		{Title: "Home", URL: "https://example.com/", Content: "Start here.", Depth: 0},
+		{Title: "Guide", URL: "https://example.com/guide", Content: "Read this.", Depth: 1},
+		{Title: "Install", URL: "https://example.com/guide/install", Content: "Run it.", Depth: 2},
+		{Title: "About", URL: "https://example.com/about", Content: "Who we are.", Depth: 0},
+	}
+	opts := markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "none"}
+	dir := t.TempDir()
+	if err := writeMarkdown(pages, filepath.Join(dir, "out.md"), opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMarkdownDir(pages, filepath.Join(dir, "docs"), opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range []string{"out.md", "docs/index.md"} {
+		md := string(readOutput(t, filepath.Join(dir, path)))
+		indents := map[string]int{}
+		for _, line := range strings.Split(md, "\n") {
+			if entry := strings.TrimLeft(line, " "); strings.HasPrefix(entry, "- [") {
+				title, _, _ := strings.Cut(strings.TrimPrefix(entry, "- ["), "]")
+				indents[title] = len(line) - len(entry)
+			}
+		}
+		want := map[string]int{"Home": 0, "Guide": 2, "Install": 4, "About": 0}
+		for title, n := range want {
+			if got, ok := indents[title]; !ok || got != n {
+				t.Errorf("%s: %s entry indented by %d spaces, want %d:\n%s", path, title, got, n, md)
+			}
+		}
+	}
+
+	// A page never nests more than one level below the entry before it
+	jump := []Page{{Title: "Home", Depth: 0}, {Title: "Deep", Depth: 3}}
+	if got := tocIndents(jump); got[1] != "  " {
+		t.Errorf("depth 3 after depth 0 indented by %q, want one level", got[1])
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// mathRendererSelector matches the visual output of MathJax, which sits
+// beside the source it was typeset from.
+const mathRendererSelector = ".MathJax_Preview, .MathJax, .MathJax_Display, .MathJax_CHTML, .MathJax_SVG, .MathJax_SVG_Display"
+
+// preserveMath replaces the math in a document with its LaTeX source, so
+// it survives text extraction instead of collapsing into a run of symbols.
+// Inline math becomes \(...\) text; display math becomes a code block, or
+// \[...\] text when it sits inside a paragraph or list item. KaTeX and
+// MathJax output is read from the TeX source they keep; plain MathML
+// without a TeX annotation is converted to approximate LaTeX.
+func preserveMath(doc *goquery.Selection) {
+	doc.Find(mathRendererSelector).Remove()
+
+	// KaTeX keeps the source in an annotation of its hidden MathML copy
+	doc.Find(".katex-display, .katex").Each(func(_ int, s *goquery.Selection) {
+		if s.Parents().Filter(".katex-display, .katex").Length() > 0 {
+			return
+		}
+		display := s.HasClass("katex-display")
+		replaceMath(s, mathSource(s.Find("math").First()), display)
+	})
+
+	// MathJax 2 leaves the source in script elements
+	doc.Find(`script[type^="math/tex"]`).Each(func(_ int, s *goquery.Selection) {
+		display := strings.Contains(s.AttrOr("type", ""), "mode=display")
+		replaceMath(s, strings.TrimSpace(s.Text()), display)
+	})
+
+	// MathJax 3 keeps an assistive MathML copy
+	doc.Find("mjx-container").Each(func(_ int, s *goquery.Selection) {
+		replaceMath(s, mathSource(s.Find("math").First()), s.AttrOr("display", "") == "true")
+	})
+
+	doc.Find("math").Each(func(_ int, s *goquery.Selection) {
+		replaceMath(s, mathSource(s), s.AttrOr("display", "") == "block")
+	})
+}
+
+// replaceMath swaps a math element for its source.
+func replaceMath(s *goquery.Selection, source string, display bool) {
+	if source == "" {
+		s.Remove()
+		return
+	}
+	if !display {
+		s.ReplaceWithNodes(&html.Node{Type: html.TextNode, Data: `\(` + source + `\)`})
+		return
+	}
+	if s.Closest("p, li, h1, h2, h3, h4, h5, h6").Length() > 0 {
+		s.ReplaceWithNodes(&html.Node{Type: html.TextNode, Data: `\[` + source + `\]`})
+		return
+	}
+	pre := &html.Node{Type: html.ElementNode, DataAtom: atom.Pre, Data: "pre"}
+	pre.AppendChild(&html.Node{Type: html.TextNode, Data: source})
+	s.ReplaceWithNodes(pre)
+}
+
+// mathSource returns the TeX annotation of a MathML element, or LaTeX
+// converted from its markup when it has none.
+func mathSource(math *goquery.Selection) string {
+	if math.Length() == 0 {
+		return ""
+	}
+	if tex := math.Find(`annotation[encoding="application/x-tex"]`).First(); tex.Length() > 0 {
+		return strings.TrimSpace(tex.Text())
+	}
+	return strings.TrimSpace(mathMLToLaTeX(math.Nodes[0]))
+}
+
+// mathMLToLaTeX approximates presentation MathML as LaTeX, covering
+// fractions, scripts and roots and otherwise keeping the content in order.
+func mathMLToLaTeX(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return strings.TrimSpace(n.Data)
+	}
+	var args []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode || strings.TrimSpace(c.Data) != "" {
+			args = append(args, mathMLToLaTeX(c))
+		}
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	switch n.Data {
+	case "annotation", "annotation-xml":
+		return ""
+	case "semantics":
+		return arg(0)
+	case "mfrac":
+		return `\frac{` + arg(0) + "}{" + arg(1) + "}"
+	case "msup":
+		return arg(0) + "^{" + arg(1) + "}"
+	case "msub":
+		return arg(0) + "_{" + arg(1) + "}"
+	case "msubsup":
+		return arg(0) + "_{" + arg(1) + "}^{" + arg(2) + "}"
+	case "msqrt":
+		return `\sqrt{` + strings.Join(args, "") + "}"
+	case "mroot":
+		return `\sqrt[` + arg(1) + "]{" + arg(0) + "}"
+	case "mo":
+		if text := strings.Join(args, ""); text == "=" || text == "+" || text == "-" || text == "−" {
+			return " " + text + " "
+		}
+	}
+	return strings.Join(args, "")
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMathSourcePreserved(t *testing.T) {
+	page := scrapeOne(t, htmlPage("Algebra", `<p>The square \(x^2\) grows fast.</p>
+		<p>As MathML: <math><msup><mi>y</mi><mn>3</mn></msup></math> too.</p>
+		<p>KaTeX: <span class="katex"><span class="katex-mathml"><math><semantics><mrow><mi>z</mi></mrow>
+			<annotation encoding="application/x-tex">\sqrt{z}</annotation></semantics></math></span>
+			<span class="katex-html" aria-hidden="true">√z</span></span> done.</p>
+		<script type="math/tex; mode=display">E = mc^2</script>`), nil)
+
+	for _, want := range []string{`The square \(x^2\) grows fast.`, `As MathML: \(y^`, `KaTeX: \(\sqrt{z}\) done.`} {
+		if !strings.Contains(page.Content, want) {
+			t.Errorf("content lacks %q:\n%s", want, page.Content)
+		}
+	}
+	if strings.Contains(page.Content, "√z") {
+		t.Errorf("content kept the rendered KaTeX:\n%s", page.Content)
+	}
+	if len(page.Code) != 1 || page.Code[0] != "E = mc^2" {
+		t.Errorf("display math gave code blocks %q, want its source", page.Code)
+	}
+
+	pdf := renderPDF(t, []Page{page}, testPDFOptions()).AllText()
+	if !strings.Contains(pdf, `\(x^2\)`) {
+		t.Errorf("PDF lacks the math source:\n%s", pdf)
+	}
+	path := filepath.Join(t.TempDir(), "out.md")
+	if err := writeMarkdown([]Page{page}, path, markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start"}); err != nil {
+		t.Fatal(err)
+	}
+	if md := string(readOutput(t, path)); !strings.Contains(md, `\(x^2\)`) || !strings.Contains(md, "mc^2") {
+		t.Errorf("Markdown lacks the math source:\n%s", md)
+	}
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"regexp"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+)
+
+var (
+	mdHeading  = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*\s*$`)
+	mdFence    = regexp.MustCompile("^(```+|~~~+)\\s*(.*)$")
+	mdListItem = regexp.MustCompile(`^\s*(?:[-*+]|\d+[.)])\s+(.*)$`)
+	mdImage    = regexp.MustCompile(`^!\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)$`)
+	mdLink     = regexp.MustCompile(`!?\[([^\]]*)\]\(\s*<?([^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	mdEmphasis = regexp.MustCompile("(\\*\\*|__|`)")
+)
+
+// isMarkdownResponse reports whether the server sent raw Markdown rather than HTML.
+func isMarkdownResponse(r *colly.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	return err == nil && (mediaType == "text/markdown" || mediaType == "text/x-markdown")
+}
+
+// extractMarkdown turns a Markdown document into a Page with the same
+// heading, code block and image markers that HTML extraction produces.
+// Only the block structure used by documentation is understood: ATX
+// headings, fenced code, lists, images and paragraphs.
+func extractMarkdown(r *colly.Response, opts extractOptions) Page {
+	var p Page
+	var content strings.Builder
+	var paragraph []string
+	var code []string
+	fence := ""
+	inList := false
+
+	flush := func() {
+		if inList {
+			content.WriteString("\n")
+			inList = false
+		}
+		if len(paragraph) > 0 {
+			content.WriteString(markdownInline(strings.Join(paragraph, " "), r, &p) + "\n\n")
+			paragraph = nil
+		}
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(r.Body), "\r\n", "\n"), "\n")
+	lines, frontTitle := skipFrontMatter(lines)
+	for _, line := range lines {
+		if fence != "" {
+			if strings.HasPrefix(strings.TrimSpace(line), fence) {
+				p.Code = append(p.Code, cleanCode(strings.Join(code, "\n"), opts.CodeTabWidth, opts.TrimCode))
+				content.WriteString("[Code Block " + fmt.Sprintf("%d", len(p.Code)) + "]\n\n")
+				fence, code = "", nil
+			} else {
+				code = append(code, line)
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if m := mdFence.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			fence = m[1]
+			p.CodeCaptions = append(p.CodeCaptions, fenceCaption(m[2]))
+			continue
+		}
+		if m := mdHeading.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			level := len(m[1])
+			if level > opts.MaxHeadingDepth {
+				continue
+			}
+			text := markdownInline(m[2], r, nil)
+			if opts.ExcludeEmptyHeadings && strings.TrimSpace(text) == "" {
+				continue
+			}
+			p.Headings = append(p.Headings, Heading{Level: level, Text: text, ID: slugify(text)})
+			if level == 1 && p.Title == "" {
+				p.Title = text
+			}
+			// h1 is the chapter title, so only deeper headings are rendered inline
+			if level >= 2 {
+				content.WriteString("[Heading " + fmt.Sprintf("%d", len(p.Headings)) + "]\n\n")
+			}
+			continue
+		}
+		if m := mdListItem.FindStringSubmatch(line); m != nil {
+			if !inList {
+				flush()
+			}
+			content.WriteString("• " + markdownInline(m[1], r, &p) + "\n")
+			inList = true
+			continue
+		}
+		if m := mdImage.FindStringSubmatch(trimmed); m != nil {
+			flush()
+			switch opts.ImageMode {
+			case "skip":
+			case "alt":
+				if m[1] != "" {
+					content.WriteString("[Image: " + m[1] + "]\n\n")
+				}
+			default:
+				src := r.Request.AbsoluteURL(m[2])
+				if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+					p.Images = append(p.Images, Image{URL: src, Alt: m[1]})
+					content.WriteString("[Image " + fmt.Sprintf("%d", len(p.Images)) + "]\n\n")
+				}
+			}
+			continue
+		}
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if inList {
+			flush()
+		}
+		paragraph = append(paragraph, trimmed)
+	}
+	flush()
+	// An unterminated fence runs to the end of the document
+	if fence != "" {
+		p.Code = append(p.Code, cleanCode(strings.Join(code, "\n"), opts.CodeTabWidth, opts.TrimCode))
+		content.WriteString("[Code Block " + fmt.Sprintf("%d", len(p.Code)) + "]\n\n")
+	}
+
+	// Only keep captions when at least one block has one
+	if strings.Join(p.CodeCaptions, "") == "" {
+		p.CodeCaptions = nil
+	}
+	p.Content = content.String()
+	if opts.CollapseBlankLines {
+		p.Content = collapseBlankLines(p.Content)
+	}
+	p.DocTitle = frontTitle
+	if p.Title == "" {
+		p.Title = frontTitle
+	}
+	if p.Title == "" && !opts.NoURLTitle {
+		p.Title = titleFromURL(r.Request.URL)
+	}
+	if p.Title == "" {
+		p.Title = untitledPage
+	}
+	return p
+}
+
+// skipFrontMatter drops a leading YAML front matter block, returning its
+// title if it has one.
+func skipFrontMatter(lines []string) ([]string, string) {
+	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
+		return lines, ""
+	}
+	title := ""
+	for i, line := range lines[1:] {
+		if strings.TrimSpace(line) == "---" {
+			return lines[i+2:], title
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && strings.TrimSpace(key) == "title" {
+			title = strings.Trim(strings.TrimSpace(value), `"'`)
+		}
+	}
+	return lines, ""
+}
+
+// fenceCaption returns the filename from a fence's info string, such as
+// "go title=main.go" or "go:main.go". A bare language name is not a caption.
+func fenceCaption(info string) string {
+	for _, field := range strings.Fields(info) {
+		if name, ok := strings.CutPrefix(field, "title="); ok {
+			return strings.Trim(name, `"'`)
+		}
+	}
+	if fields := strings.Fields(info); len(fields) > 0 {
+		if _, name, ok := strings.Cut(fields[0], ":"); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// markdownInline reduces inline Markdown to plain text: links keep their
+// text and are recorded in p when it is non-nil, and emphasis and code
+// spans lose their markers.
+func markdownInline(text string, r *colly.Response, p *Page) string {
+	text = mdLink.ReplaceAllStringFunc(text, func(match string) string {
+		m := mdLink.FindStringSubmatch(match)
+		if strings.HasPrefix(match, "!") {
+			return m[1]
+		}
+		if p != nil && strings.TrimSpace(m[1]) != "" {
+			if linkURL, err := r.Request.URL.Parse(m[2]); err == nil {
+				p.Links = append(p.Links, Link{Text: m[1], URL: linkURL.String()})
+			}
+		}
+		return m[1]
+	})
+	return mdEmphasis.ReplaceAllString(text, "")
+}
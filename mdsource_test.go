@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMarkdownResponse(t *testing.T) {
+	docs := map[string]string{
+		"/guide.md": "# Getting Started\n\nInstall the **tool** first, then read [the reference](/ref.md).\n\n" +
+			"## Install\n\n- Download it\n- Unpack it\n\n```go title=main.go\npackage main\n\n\tfunc main() {}\n```\n\n" +
+			"## Run ##\n\n~~~\ngo run .\n~~~\n",
+		"/ref.md": "# Reference\n\nEvery flag.\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Write([]byte(doc))
+	}))
+	t.Cleanup(srv.Close)
+
+	pages, err := Crawl(testCrawlOptions(srv.URL + "/guide.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/guide.md /ref.md" {
+		t.Fatalf("crawled %s, want the Markdown page and the one it links to", got)
+	}
+	page := pages[0]
+	if page.Title != "Getting Started" {
+		t.Errorf("page titled %q, want its # heading", page.Title)
+	}
+	var headings []string
+	for _, h := range page.Headings {
+		headings = append(headings, strings.Repeat("#", h.Level)+" "+h.Text)
+	}
+	if got := strings.Join(headings, ", "); got != "# Getting Started, ## Install, ## Run" {
+		t.Errorf("headings %s, want # Getting Started, ## Install, ## Run", got)
+	}
+	if len(page.Code) != 2 || page.Code[0] != "package main\n\n    func main() {}" || page.Code[1] != "go run ." {
+		t.Errorf("code blocks %q, want both fences", page.Code)
+	}
+	if got := page.codeCaption(0); got != "main.go" {
+		t.Errorf("first fence captioned %q, want main.go", got)
+	}
+	want := "Install the tool first, then read the reference.\n\n[Heading 2]\n\n• Download it\n• Unpack it\n\n[Code Block 1]\n\n[Heading 3]\n\n[Code Block 2]"
+	if got := strings.TrimSpace(page.Content); got != want {
+		t.Errorf("content\n%q\nwant\n%q", got, want)
+	}
+}
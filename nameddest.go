@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// namedDest is a position in the document exposed as a PDF named destination.
+type namedDest struct {
+	Name string
+	Page int     // 1-based page number
+	Y    float64 // mm from the top of the page
+}
+
+var (
+	startXrefPattern = regexp.MustCompile(`startxref\s+(\d+)\s+%%EOF\s*$`)
+	trailerPattern   = regexp.MustCompile(`(?s)trailer\s*<<(.*?)>>`)
+	rootPattern      = regexp.MustCompile(`/Root (\d+) 0 R`)
+	infoPattern      = regexp.MustCompile(`/Info (\d+) 0 R`)
+	sizePattern      = regexp.MustCompile(`/Size (\d+)`)
+	kidsPattern      = regexp.MustCompile(`(?s)\n1 0 obj\s*<</Type /Pages\s*/Kids \[(.*?)\]`)
+	kidRefPattern    = regexp.MustCompile(`(\d+) 0 R`)
+)
+
+// addNamedDests registers dests in the catalog of the PDF at path so that
+// viewers can open links such as "output.pdf#install". gofpdf has no API for
+// named destinations, so they are added as an incremental update: a new
+// catalog object and a /Dests dictionary appended after the original file,
+// followed by a cross-reference section that points back to the original.
+func addNamedDests(path string, dests []namedDest, pageHeight float64) error {
+	if len(dests) == 0 {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	m := startXrefPattern.FindSubmatch(data)
+	if m == nil {
+		return fmt.Errorf("no startxref in %s", path)
+	}
+	prevXref, _ := strconv.Atoi(string(m[1]))
+	trailer := trailerPattern.FindSubmatch(data[prevXref:])
+	if trailer == nil {
+		return fmt.Errorf("no trailer in %s", path)
+	}
+	root := rootPattern.FindSubmatch(trailer[1])
+	size := sizePattern.FindSubmatch(trailer[1])
+	if root == nil || size == nil {
+		return fmt.Errorf("incomplete trailer in %s", path)
+	}
+	rootObj, _ := strconv.Atoi(string(root[1]))
+	nextObj, _ := strconv.Atoi(string(size[1]))
+
+	// The catalog dictionary is copied into the new catalog object
+	start := bytes.LastIndex(data[:prevXref], []byte(fmt.Sprintf("\n%d 0 obj", rootObj)))
+	if start < 0 {
+		return fmt.Errorf("no catalog object in %s", path)
+	}
+	catalog := string(data[start:prevXref])
+	open, end := strings.Index(catalog, "<<"), strings.LastIndex(catalog, ">>")
+	if open < 0 || end < open {
+		return fmt.Errorf("malformed catalog object in %s", path)
+	}
+	catalogDict := strings.TrimSpace(catalog[open+2 : end])
+
+	kids := kidsPattern.FindSubmatch(data)
+	if kids == nil {
+		return fmt.Errorf("no page tree in %s", path)
+	}
+	var pageObjs []string
+	for _, ref := range kidRefPattern.FindAllSubmatch(kids[1], -1) {
+		pageObjs = append(pageObjs, string(ref[1]))
+	}
+
+	// Destinations are sorted by name, as the PDF spec expects for name trees
+	sort.Slice(dests, func(i, j int) bool { return dests[i].Name < dests[j].Name })
+	var destsDict strings.Builder
+	destsDict.WriteString("<<\n")
+	for _, d := range dests {
+		if d.Page < 1 || d.Page > len(pageObjs) {
+			continue
+		}
+		y := (pageHeight - d.Y) * 72 / 25.4
+		fmt.Fprintf(&destsDict, "/%s [%s 0 R /XYZ 0 %.2f null]\n", pdfName(d.Name), pageObjs[d.Page-1], y)
+	}
+	destsDict.WriteString(">>")
+
+	var update bytes.Buffer
+	update.Write(data)
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		update.WriteString("\n")
+	}
+	destsOffset := update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n%s\nendobj\n", nextObj, destsDict.String())
+	catalogOffset := update.Len()
+	fmt.Fprintf(&update, "%d 0 obj\n<<\n%s\n/Dests %d 0 R\n>>\nendobj\n", rootObj, catalogDict, nextObj)
+
+	xrefOffset := update.Len()
+	fmt.Fprintf(&update, "xref\n0 1\n0000000000 65535 f \n%d 1\n%010d 00000 n \n%d 1\n%010d 00000 n \n",
+		rootObj, catalogOffset, nextObj, destsOffset)
+	update.WriteString("trailer\n<<\n")
+	fmt.Fprintf(&update, "/Size %d\n/Root %d 0 R\n", nextObj+1, rootObj)
+	if info := infoPattern.FindSubmatch(trailer[1]); info != nil {
+		fmt.Fprintf(&update, "/Info %s 0 R\n", info[1])
+	}
+	fmt.Fprintf(&update, "/Prev %d\n>>\nstartxref\n%d\n%%%%EOF\n", prevXref, xrefOffset)
+
+	return os.WriteFile(path, update.Bytes(), 0644)
+}
+
+// pdfName escapes a string for use as a PDF name object.
+func pdfName(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || strings.IndexByte("#()<>[]{}/%", c) >= 0 {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
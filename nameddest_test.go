@@ -0,0 +1,63 @@
+package main
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var pdfDestPattern = regexp.MustCompile(`/(\S+) \[(\d+) 0 R /XYZ 0 [\d.]+ null\]`)
+
+// namedDests returns the page index each named destination in f points to.
+func (f *pdfFile) namedDests() map[string]int {
+	dests := make(map[string]int)
+	for _, obj := range f.Objects {
+		if n := f.ref(obj, "/Dests"); n > 0 {
+			for _, m := range pdfDestPattern.FindAllSubmatch(f.Objects[n], -1) {
+				dests[string(m[1])] = slices.Index(f.PageObj, atoi(m[2]))
+			}
+		}
+	}
+	return dests
+}
+
+func TestNamedDestinations(t *testing.T) {
+	pages := []Page{
+		{
+			Title:    "Guide",
+			URL:      "https://example.com/guide",
+			Headings: []Heading{{Level: 2, Text: "Installing", ID: "install"}, {Level: 2, Text: "Getting Started"}},
+			Content:  "[Heading 1]\n\nGet it.\n\n[Heading 2]\n\nRun it.",
+		},
+		{
+			Title:    "Reference",
+			URL:      "https://example.com/reference",
+			Headings: []Heading{{Level: 2, Text: "Install"}, {Level: 2, Text: "Flags (all)"}},
+			Content:  "[Heading 1]\n\nAgain.\n\n[Heading 2]\n\nEvery flag.",
+		},
+	}
+	opts := testPDFOptions()
+	pdf := renderPDF(t, pages, opts)
+	dests := pdf.namedDests()
+
+	for slug, heading := range map[string]string{
+		"install":         "Installing", // the earlier heading keeps a shared slug
+		"getting-started": "Getting Started",
+		"flags-all":       "Flags (all)",
+	} {
+		page, ok := dests[slug]
+		if !ok {
+			t.Errorf("no named destination %q among %v", slug, dests)
+			continue
+		}
+		if page < 0 || !strings.Contains(pdf.Text(page), heading) {
+			t.Errorf("destination %q points to page %d, want the one with %q", slug, page, heading)
+		}
+	}
+
+	opts.NamedDests = false
+	if dests := renderPDF(t, pages, opts).namedDests(); len(dests) != 0 {
+		t.Errorf("named destinations %v written without -named-dests", dests)
+	}
+}
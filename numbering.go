@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// chapterLabel formats chapter number n (1-based) in the given numbering
+// style: "decimal" (1, 2), "roman" (I, II), "alpha" (A, B, ... Z, AA) or
+// "none", which gives an empty label.
+func chapterLabel(n int, style string) string {
+	switch style {
+	case "roman":
+		return romanNumeral(n)
+	case "alpha":
+		var label []byte
+		for ; n > 0; n = (n - 1) / 26 {
+			label = append([]byte{byte('A' + (n-1)%26)}, label...)
+		}
+		return string(label)
+	case "none":
+		return ""
+	default:
+		return strconv.Itoa(n)
+	}
+}
+
+func romanNumeral(n int) string {
+	numerals := []struct {
+		value  int
+		symbol string
+	}{
+		{1000, "M"}, {900, "CM"}, {500, "D"}, {400, "CD"}, {100, "C"}, {90, "XC"},
+		{50, "L"}, {40, "XL"}, {10, "X"}, {9, "IX"}, {5, "V"}, {4, "IV"}, {1, "I"},
+	}
+	var b strings.Builder
+	for _, numeral := range numerals {
+		for ; n >= numeral.value; n -= numeral.value {
+			b.WriteString(numeral.symbol)
+		}
+	}
+	return b.String()
+}
+
+// numberedTitle prefixes title with its chapter label, e.g. "II. Install",
+// or returns it unchanged when numbering is "none". Subsections number
+// after their chapter, e.g. "II.3. Configure".
+func numberedTitle(title, style string, chapter int, sections ...int) string {
+	label := chapterLabel(chapter, style)
+	if label == "" {
+		return title
+	}
+	for _, section := range sections {
+		label += "." + strconv.Itoa(section)
+	}
+	return label + ". " + title
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestChapterLabel(t *testing.T) {
+	for _, tc := range []struct {
+		n     int
+		style string
+		want  string
+	}{
+		{1, "decimal", "1"},
+		{1, "roman", "I"},
+		{4, "roman", "IV"},
+		{14, "roman", "XIV"},
+		{1994, "roman", "MCMXCIV"},
+		{1, "alpha", "A"},
+		{26, "alpha", "Z"},
+		{27, "alpha", "AA"},
+		{3, "none", ""},
+	} {
+		if got := chapterLabel(tc.n, tc.style); got != tc.want {
+			t.Errorf("chapterLabel(%d, %q) = %q, want %q", tc.n, tc.style, got, tc.want)
+		}
+	}
+}
+
+func TestRomanNumbering(t *testing.T) {
+	opts := testPDFOptions()
+	opts.Numbering = "roman"
+	pdf := renderPDF(t, syntheticPages(3, ""), opts)
+
+	toc := pdf.Text(0)
+	if !strings.Contains(toc, "II.2. Usage") {
+		t.Errorf("table of contents lacks the section II.2. Usage:\n%s", toc)
+	}
+	for _, title := range []string{"I. Page 0", "II. Page 1", "III. Page 2"} {
+		if !strings.Contains(toc, title) {
+			t.Errorf("table of contents lacks %q:\n%s", title, toc)
+		}
+		// Bookmarks carry the same numbering
+		if !bytes.Contains(pdf.Raw, []byte("/Title ("+title+")")) {
+			t.Errorf("no bookmark titled %q", title)
+		}
+	}
+	if page := pdf.find("Page 1 explains"); page < 0 || !strings.Contains(pdf.Text(page), "II. Page 1") {
+		t.Errorf("chapter title of Page 1 is not numbered II.")
+	}
+	if strings.Contains(pdf.AllText(), "1. Page 0") {
+		t.Error("PDF still has decimal chapter numbers")
+	}
+}
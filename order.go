@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// codeAppendixTitle heads the code blocks gathered by -content-order code-appendix.
+const codeAppendixTitle = "Code Listings"
+
+// reorderContent rearranges a page's content paragraphs. "code-appendix"
+// moves every code block to the end of the page under a Code Listings
+// heading; "prose-first" keeps each section's text and lists ahead of its
+// code blocks and images. Any other order, including "dom", leaves the
+// content as extracted.
+func reorderContent(p *Page, order string) {
+	var paragraphs []string
+	for _, para := range strings.Split(p.Content, "\n\n") {
+		if strings.TrimSpace(para) != "" {
+			paragraphs = append(paragraphs, para)
+		}
+	}
+
+	var out []string
+	switch order {
+	case "code-appendix":
+		var code []string
+		for _, para := range paragraphs {
+			if strings.HasPrefix(para, "[Code Block ") {
+				code = append(code, para)
+			} else {
+				out = append(out, para)
+			}
+		}
+		if len(code) == 0 {
+			return
+		}
+		p.Headings = append(p.Headings, Heading{Level: 2, Text: codeAppendixTitle})
+		out = append(out, fmt.Sprintf("[Heading %d]", len(p.Headings)))
+		out = append(out, code...)
+	case "prose-first":
+		var media []string
+		flush := func() {
+			out = append(out, media...)
+			media = nil
+		}
+		for _, para := range paragraphs {
+			switch {
+			case strings.HasPrefix(para, "[Heading "):
+				flush()
+				out = append(out, para)
+			case strings.HasPrefix(para, "[Code Block "), strings.HasPrefix(para, "[Image "):
+				media = append(media, para)
+			default:
+				out = append(out, para)
+			}
+		}
+		flush()
+	default:
+		return
+	}
+
+	var content strings.Builder
+	for _, para := range out {
+		content.WriteString(para + "\n\n")
+	}
+	p.Content = content.String()
+}
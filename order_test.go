@@ -0,0 +1,51 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestContentOrder(t *testing.T) {
+	html := htmlPage("Guide", `<p>Intro.</p><pre>step one</pre><p>Between.</p>
+		<h2>Usage</h2><pre>step two</pre><p>After usage code.</p>
+		<h2>Flags</h2><p>Flag text.</p><pre>step three</pre>`)
+	scrape := func(order string) Page {
+		return scrapeOne(t, html, func(opts *CrawlOptions) { opts.Extract.ContentOrder = order })
+	}
+
+	// code-appendix: every code block after all of the chapter's prose
+	page := scrape("code-appendix")
+	paragraphs := strings.Split(strings.TrimSpace(page.Content), "\n\n")
+	firstCode := len(paragraphs)
+	for i, para := range paragraphs {
+		if strings.HasPrefix(para, "[Code Block ") {
+			firstCode = min(firstCode, i)
+		} else if firstCode < i {
+			t.Errorf("code-appendix: %q comes after a code block:\n%s", para, page.Content)
+		}
+	}
+	if got := strings.Join(paragraphs[firstCode:], " "); got != "[Code Block 1] [Code Block 2] [Code Block 3]" {
+		t.Errorf("code-appendix: appendix holds %s, want every block in order", got)
+	}
+	if firstCode == 0 || page.Headings[len(page.Headings)-1].Text != codeAppendixTitle ||
+		paragraphs[firstCode-1] != "[Heading 4]" {
+		t.Errorf("code-appendix: code not headed by %q:\n%s", codeAppendixTitle, page.Content)
+	}
+	pdf := renderPDF(t, []Page{page}, testPDFOptions())
+	text := pdf.AllText()
+	if last, code := strings.LastIndex(text, "Flag text."), strings.Index(text, "step one"); last < 0 || code < last {
+		t.Errorf("code-appendix: PDF shows code before the last paragraph:\n%s", text)
+	}
+
+	// prose-first: each section's text ahead of its own code
+	want := "Intro. Between. [Code Block 1] [Heading 2] After usage code. [Code Block 2] [Heading 3] Flag text. [Code Block 3]"
+	if got := strings.Join(strings.Split(strings.TrimSpace(scrape("prose-first").Content), "\n\n"), " "); got != want {
+		t.Errorf("prose-first: content\n%s\nwant\n%s", got, want)
+	}
+
+	// dom leaves the order as extracted
+	want = "Intro. [Code Block 1] Between. [Heading 2] [Code Block 2] After usage code. [Heading 3] Flag text. [Code Block 3]"
+	if got := strings.Join(strings.Split(strings.TrimSpace(scrape("dom").Content), "\n\n"), " "); got != want {
+		t.Errorf("dom: content\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// utf8BOM is the byte order mark some Windows tools need to detect UTF-8.
+const utf8BOM = "\xEF\xBB\xBF"
+
+// textFile is a text output file, gzip-compressed when its name ends in .gz.
+type textFile struct {
+	io.Writer
+	file *os.File
+	gz   *gzip.Writer
+}
+
+// createTextFile creates a UTF-8 text output file, starting it with a byte
+// order mark when bom is set. Paths ending in .gz are written compressed.
+func createTextFile(path string, bom bool) (*textFile, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	t := &textFile{Writer: f, file: f}
+	if isGzipPath(path) {
+		t.gz = gzip.NewWriter(f)
+		t.Writer = t.gz
+	}
+	if bom {
+		if _, err := io.WriteString(t, utf8BOM); err != nil {
+			t.Close()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Flush pushes compressed data written so far through to the file, so
+// readers can decompress it while writing continues.
+func (t *textFile) Flush() error {
+	if t.gz != nil {
+		return t.gz.Flush()
+	}
+	return nil
+}
+
+func (t *textFile) Close() error {
+	if t.gz != nil {
+		if err := t.gz.Close(); err != nil {
+			t.file.Close()
+			return err
+		}
+	}
+	return t.file.Close()
+}
+
+// isGzipPath reports whether an output path asks for gzip compression.
+func isGzipPath(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".gz")
+}
+
+// formatExtensions maps each output format to its default file extension.
+var formatExtensions = map[string]string{
+	"pdf":      ".pdf",
+	"jsonl":    ".jsonl",
+	"json":     ".json",
+	"markdown": ".md",
+	"html":     ".html",
+	"csv":      ".csv",
+}
+
+// formatOrder is the order formats are written in when several are asked
+// for. PDF comes last so that a chunked PDF, which otherwise downloads
+// each chunk's images as it renders it, reuses any images -inline-images
+// has already downloaded for HTML.
+var formatOrder = []string{"jsonl", "json", "markdown", "html", "csv", "pdf"}
+
+// parseFormats reads a comma-separated -format value such as "pdf,md,json"
+// into known format names in formatOrder, accepting md as short for markdown.
+func parseFormats(value string) ([]string, error) {
+	wanted := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "md" {
+			name = "markdown"
+		}
+		if _, ok := formatExtensions[name]; !ok {
+			return nil, fmt.Errorf("invalid -format value %q: expected pdf, jsonl, json, markdown, html or csv, or several separated by commas", value)
+		}
+		wanted[name] = true
+	}
+	var formats []string
+	for _, name := range formatOrder {
+		if wanted[name] {
+			formats = append(formats, name)
+		}
+	}
+	return formats, nil
+}
+
+// outputPaths names one file per format from the -output base name, e.g.
+// docs/site.pdf with pdf and json gives docs/site.pdf and docs/site.json.
+// A .gz suffix carries over to the text formats.
+func outputPaths(output string, formats []string) map[string]string {
+	gz := isGzipPath(output)
+	base := output
+	if gz {
+		base = strings.TrimSuffix(base, filepath.Ext(base))
+	}
+	for _, ext := range []string{".ndjson", ".markdown", ".htm"} {
+		if strings.EqualFold(filepath.Ext(base), ext) {
+			base = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	}
+	for _, ext := range formatExtensions {
+		if strings.EqualFold(filepath.Ext(base), ext) {
+			base = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	}
+	paths := make(map[string]string)
+	for _, format := range formats {
+		paths[format] = base + formatExtensions[format]
+		if gz && format != "pdf" {
+			paths[format] += ".gz"
+		}
+	}
+	return paths
+}
+
+// isDirOutput reports whether an -output value names a directory, either
+// with a trailing slash or because it already exists as one.
+func isDirOutput(path string) bool {
+	if strings.HasSuffix(path, "/") || strings.HasSuffix(path, string(filepath.Separator)) {
+		return true
+	}
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// formatForPath infers the output format from a file name's extension,
+// falling back to pdf for unknown extensions. Directories get per-page
+// Markdown files, and a .gz suffix is looked through, as in pages.json.gz.
+func formatForPath(path string) string {
+	if isDirOutput(path) {
+		return "markdown"
+	}
+	if isGzipPath(path) {
+		path = strings.TrimSuffix(path, filepath.Ext(path))
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl", ".ndjson":
+		return "jsonl"
+	case ".json":
+		return "json"
+	case ".md", ".markdown":
+		return "markdown"
+	case ".html", ".htm":
+		return "html"
+	case ".csv":
+		return "csv"
+	default:
+		return "pdf"
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBOM(t *testing.T) {
+	pages := []Page{{Title: "Café menu", URL: "https://example.com/café", Content: "Crème brûlée — 5 €"}}
+	writers := map[string]func(path string, bom bool) error{
+		"out.md": func(path string, bom bool) error {
+			return writeMarkdown(pages, path, markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "decimal", BOM: bom})
+		},
+		"out.html": func(path string, bom bool) error {
+			return writeHTML(pages, path, htmlOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "decimal", BOM: bom})
+		},
+		"out.json": func(path string, bom bool) error { return writeJSON(pages, path, bom) },
+		"out.csv":  func(path string, bom bool) error { return writeCSV(pages, path, bom) },
+		"out.jsonl": func(path string, bom bool) error {
+			w, err := newJSONLWriter(path, bom)
+			if err != nil {
+				return err
+			}
+			if err := w.write(pages[0]); err != nil {
+				return err
+			}
+			return w.Close()
+		},
+	}
+	for name, write := range writers {
+		for _, bom := range []bool{false, true} {
+			for _, path := range []string{name, name + ".gz"} {
+				path = filepath.Join(t.TempDir(), path)
+				if err := write(path, bom); err != nil {
+					t.Fatalf("%s: %v", path, err)
+				}
+				data := readOutput(t, path)
+				if got := bytes.HasPrefix(data, []byte(utf8BOM)); got != bom {
+					t.Errorf("%s with -bom=%v: starts with a BOM: %v", filepath.Base(path), bom, got)
+				}
+				if !utf8.Valid(data) || !bytes.Contains(data, []byte("Crème brûlée — 5 €")) {
+					t.Errorf("%s with -bom=%v: text is not written as UTF-8", filepath.Base(path), bom)
+				}
+			}
+		}
+	}
+}
+
+// readOutput reads an output file, decompressing it when it is gzipped.
+func readOutput(t testing.TB, path string) []byte {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if isGzipPath(path) {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gz
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestNoSource(t *testing.T) {
+	pages := []Page{{Title: "Guide", URL: "https://example.com/guide", Content: "Read this."}}
+	for _, noSource := range []bool{false, true} {
+		dir := t.TempDir()
+		pdfOpts := testPDFOptions()
+		pdfOpts.NoSource = noSource
+		pdfText := renderPDF(t, pages, pdfOpts).AllText()
+		mdPath, htmlPath := filepath.Join(dir, "out.md"), filepath.Join(dir, "out.html")
+		if err := writeMarkdown(pages, mdPath, markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "decimal", NoSource: noSource}); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeHTML(pages, htmlPath, htmlOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "decimal", NoSource: noSource}); err != nil {
+			t.Fatal(err)
+		}
+		for format, text := range map[string]string{
+			"pdf":      pdfText,
+			"markdown": string(readOutput(t, mdPath)),
+			"html":     string(readOutput(t, htmlPath)),
+		} {
+			if got := strings.Contains(text, "Source:"); got == noSource {
+				t.Errorf("%s with -no-source=%v: shows the source line: %v\n%s", format, noSource, got, text)
+			}
+			if !strings.Contains(text, "Read this.") {
+				t.Errorf("%s with -no-source=%v: content missing", format, noSource)
+			}
+		}
+	}
+}
+
+func TestGzipOutput(t *testing.T) {
+	pages := []Page{
+		{Title: "Guide", URL: "https://example.com/guide", Content: "Read this.", Code: []string{"go run ."}},
+		{Title: "Reference", URL: "https://example.com/ref", Content: "Look things up.", Depth: 1},
+	}
+	path := filepath.Join(t.TempDir(), "pages.json.gz")
+	if err := writeJSON(pages, path, false); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(raw, []byte{0x1f, 0x8b}) {
+		t.Fatalf("%s is not gzipped: starts %q", filepath.Base(path), raw[:min(len(raw), 8)])
+	}
+	var got []Page
+	if err := json.Unmarshal(readOutput(t, path), &got); err != nil {
+		t.Fatalf("%s does not decompress to JSON: %v", filepath.Base(path), err)
+	}
+	if !reflect.DeepEqual(got, pages) {
+		t.Errorf("%s holds\n%+v\nwant\n%+v", filepath.Base(path), got, pages)
+	}
+
+	// The format is picked from the extension before .gz
+	srv := testSite(t, map[string]string{"/": htmlPage("Home", `<p>Start here.</p>`)})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "pages.json.gz", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	got = nil
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "pages.json.gz")), &got); err != nil {
+		t.Fatalf("-output pages.json.gz does not decompress to JSON: %v\n%s", err, out)
+	}
+	if len(got) != 1 || got[0].Title != "Home" || !strings.Contains(got[0].Content, "Start here.") {
+		t.Errorf("-output pages.json.gz holds %+v, want the Home page", got)
+	}
+}
+
+func TestMultipleFormats(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a>`),
+		"/a": htmlPage("Install Guide", `<h2>Steps</h2><p>Page A.</p><pre>make</pre>`),
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-format", "pdf,json", "-output", "docs/site.pdf", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	var pages []Page
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "docs", "site.json")), &pages); err != nil {
+		t.Fatalf("site.json: %v\n%s", err, out)
+	}
+	pdf := readPDF(t, filepath.Join(dir, "docs", "site.pdf"))
+	if len(pages) != 2 {
+		t.Fatalf("site.json holds %d pages, want 2", len(pages))
+	}
+	text := pdf.AllText()
+	for i, page := range pages {
+		if !strings.Contains(text, numberedTitle(page.Title, "decimal", i+1)) || !strings.Contains(text, page.URL) {
+			t.Errorf("PDF lacks chapter %d, %q from %s, in site.json", i+1, page.Title, page.URL)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(dir, "docs")); len(entries) != 2 {
+		t.Errorf("wrote %d files, want site.pdf and site.json", len(entries))
+	}
+
+	paths := outputPaths("out/pages.json.gz", []string{"pdf", "markdown", "json"})
+	for format, want := range map[string]string{"pdf": "out/pages.pdf", "markdown": "out/pages.md.gz", "json": "out/pages.json.gz"} {
+		if paths[format] != want {
+			t.Errorf("%s output for -output out/pages.json.gz is %s, want %s", format, paths[format], want)
+		}
+	}
+}
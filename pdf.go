@@ -0,0 +1,495 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jung-kurt/gofpdf"
+)
+
+// pdfOptions controls how scraped pages are laid out in the PDF.
+type pdfOptions struct {
+	// BodyFont, HeadingFont and CodeFont are core font names or TTF files;
+	// empty keeps Arial for prose and headings and Courier for code.
+	BodyFont    string
+	HeadingFont string
+	CodeFont    string
+	// Subject and Keywords fill the document information dictionary;
+	// keywords default to the pages' most frequent words.
+	Subject  string
+	Keywords string
+	TOCDepth int
+	// TOCTitle heads the table of contents; TOCPosition places it at the
+	// "start" or "end" of the document, or "none" to leave it out.
+	TOCTitle    string
+	TOCPosition string
+	// MaxTOCEntries caps the sections listed per chapter; 0 lists all.
+	MaxTOCEntries  int
+	CodeWrapCols   int
+	CodeWrapMarker string
+	Deterministic  bool
+	ImageMaxWidth  string
+	Images         *imageCache
+	ShowMetadata   bool
+	NamedDests     bool
+	NoSource       bool
+	// Numbering is the chapter numbering style: decimal, roman, alpha or none.
+	Numbering string
+	// HeadingsTOCOnly lists headings in the TOC and bookmarks without
+	// repeating them in the chapter body.
+	HeadingsTOCOnly bool
+	// PageBreakLevel starts a new page before each heading of this level
+	// or higher (2 for h2); 0 never breaks.
+	PageBreakLevel int
+	// PageTOC adds an "On this page" list to chapters with at least this
+	// many headings; 0 disables it.
+	PageTOC int
+	// Justify sets body paragraphs flush with both margins; Hyphenate
+	// breaks words that would leave a line short.
+	Justify   bool
+	Hyphenate bool
+	// ChunkSize renders the document this many chapters at a time to keep
+	// memory bounded (see writeChunkedPDF); 0 renders it in one go. Each
+	// chunk then downloads its own images with ImageClient, ImageWorkers
+	// at a time, unless Images is set.
+	ChunkSize    int
+	ImageClient  *http.Client
+	ImageWorkers int
+	// Changes adds a "What Changed" section when set; PrevState supplies
+	// the titles of removed pages.
+	Changes   *changeReport
+	PrevState *crawlState
+}
+
+// writePDF renders the pages as chapters after a table of contents and
+// saves the document to path.
+func writePDF(pages []Page, path string, opts pdfOptions) error {
+	if opts.ChunkSize > 0 {
+		return writeChunkedPDF(pages, path, opts)
+	}
+
+	pdf, fonts, err := newPDF(pages, opts)
+	if err != nil {
+		return err
+	}
+
+	// Internal link targets for chapters and headings
+	links := newPDFLinks(pdf, pages, 0, len(pages))
+
+	if opts.TOCPosition == "start" {
+		renderTOC(pdf, fonts, pages, links, opts, nil, nil)
+	}
+
+	if opts.Changes != nil {
+		renderChanges(pdf, fonts, *opts.Changes, opts.PrevState, pages, links)
+	}
+
+	chapterPages, headingPages, dests, err := renderChapters(pdf, fonts, pages, links, opts)
+	if err != nil {
+		return err
+	}
+
+	// Every chapter's page is known by now, so this TOC can list them
+	if opts.TOCPosition == "end" {
+		renderTOC(pdf, fonts, pages, links, opts, chapterPages, headingPages)
+	}
+
+	_, pageHeight := pdf.GetPageSize()
+	if err := pdf.OutputFileAndClose(path); err != nil {
+		return err
+	}
+	if opts.NamedDests {
+		return addNamedDests(path, dests, pageHeight)
+	}
+	return nil
+}
+
+// newPDF creates an empty document with the pages' metadata and the
+// configured fonts loaded.
+func newPDF(pages []Page, opts pdfOptions) (*gofpdf.Fpdf, pdfFonts, error) {
+	// Create PDF
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	info := newPDFInfo(pages, opts)
+	pdf.SetAuthor(info.Author, false)
+	pdf.SetTitle(info.Title, false)
+	pdf.SetCreator(info.Creator, false)
+	if info.Subject != "" {
+		pdf.SetSubject(info.Subject, true)
+	}
+	pdf.SetKeywords(info.Keywords, true)
+	if opts.Deterministic {
+		// Fixed timestamps and sorted resources keep the output byte-stable across runs
+		pdf.SetCatalogSort(true)
+		pdf.SetCreationDate(info.Created)
+		pdf.SetModificationDate(info.Created)
+	}
+
+	var fonts pdfFonts
+	var err error
+	if fonts.Body, err = loadFont(pdf, opts.BodyFont, "Arial", "", "B", "I"); err != nil {
+		return nil, fonts, err
+	}
+	if fonts.Heading, err = loadFont(pdf, opts.HeadingFont, "Arial", "B"); err != nil {
+		return nil, fonts, err
+	}
+	if fonts.Code, err = loadFont(pdf, opts.CodeFont, "Courier", ""); err != nil {
+		return nil, fonts, err
+	}
+	return pdf, fonts, nil
+}
+
+// pdfInfo is the document information a PDF of the pages is given.
+type pdfInfo struct {
+	Title, Author, Creator, Subject, Keywords string
+	// Created is zero for the time the document is written
+	Created time.Time
+}
+
+func newPDFInfo(pages []Page, opts pdfOptions) pdfInfo {
+	info := pdfInfo{
+		Title:    "Go Blog Content",
+		Author:   "PDF Scraper",
+		Creator:  "PDF Scraper",
+		Subject:  opts.Subject,
+		Keywords: opts.Keywords,
+	}
+	if info.Keywords == "" {
+		info.Keywords = strings.Join(topKeywords(pages, 10), ", ")
+	}
+	if opts.Deterministic {
+		info.Created = time.Unix(0, 0).UTC()
+	}
+	return info
+}
+
+// renderChapters adds the chapters links covers, from links.first up to
+// links.last. It returns the page each chapter and heading landed on,
+// indexed like pages, and the named destinations of the heading slugs.
+func renderChapters(pdf *gofpdf.Fpdf, fonts pdfFonts, pages []Page, links *pdfLinks, opts pdfOptions) ([]int, [][]int, []namedDest, error) {
+	// Work out how many code columns fit the page when not configured
+	wrapCols := opts.CodeWrapCols
+	if wrapCols <= 0 {
+		pdf.SetFont(fonts.Code, "", 10)
+		// MultiCell keeps a cell margin on either side of the text
+		wrapCols = int((contentWidth(pdf) - 2*pdf.GetCellMargin()) / pdf.GetStringWidth("0"))
+	}
+
+	// Body paragraphs are ragged-right unless justification is asked for
+	align := "L"
+	if opts.Justify {
+		align = "J"
+	}
+
+	// Images are scaled down to fit the configured width
+	imageMaxWidth, err := parseImageMaxWidth(opts.ImageMaxWidth, contentWidth(pdf))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Named destinations by heading slug, unique within a page; when pages
+	// share a slug the first heading with it wins
+	var dests []namedDest
+	destOwner := make(map[string][2]int)
+	setDest := func(slug string, chapter, heading int) {
+		owner, taken := destOwner[slug]
+		if slug == "" || (taken && owner != [2]int{chapter, heading}) {
+			return
+		}
+		if !taken {
+			destOwner[slug] = [2]int{chapter, heading}
+			dests = append(dests, namedDest{Name: slug})
+		}
+		for k := range dests {
+			if dests[k].Name == slug {
+				dests[k].Page, dests[k].Y = pdf.PageNo(), pdf.GetY()
+			}
+		}
+	}
+
+	// Pages each chapter and heading landed on, for a TOC at the end
+	chapterPages := make([]int, len(pages))
+	headingPages := make([][]int, len(pages))
+
+	// Add content pages
+	for i := links.first; i < links.last; i++ {
+		page := pages[i]
+		pdf.AddPage()
+		chapterPages[i] = pdf.PageNo()
+		headingPages[i] = make([]int, len(page.Headings))
+		for j := range headingPages[i] {
+			headingPages[i][j] = chapterPages[i]
+		}
+
+		// Chapter title
+		chapterTitle := numberedTitle(page.Title, opts.Numbering, i+1)
+		// The outline follows the document's <title>, as a browser tab would
+		if page.DocTitle != "" {
+			links.bookmark(pdf, numberedTitle(page.DocTitle, opts.Numbering, i+1), 0)
+		} else {
+			links.bookmark(pdf, chapterTitle, 0)
+		}
+		slugs := page.headingSlugs()
+		// Headings not rendered inline link to the chapter start
+		links.set(pdf, i, -1)
+		for j := range page.Headings {
+			links.set(pdf, i, j)
+			setDest(slugs[j], i, j)
+		}
+		pdf.SetFont(fonts.Heading, "B", 20)
+		pdf.Cell(0, 10, chapterTitle)
+		pdf.Ln(15)
+
+		// URL reference
+		if !opts.NoSource {
+			pdf.SetFont(fonts.Body, "I", 10)
+			pdf.Cell(0, 10, "Source: "+page.URL)
+			pdf.Ln(15)
+		}
+
+		if opts.ShowMetadata {
+			renderMetadata(pdf, fonts, page.Metadata, page.Language)
+		}
+
+		if opts.PageTOC > 0 {
+			renderPageTOC(pdf, fonts, page, links, i, opts.PageTOC)
+		}
+
+		// Content
+		pdf.SetFont(fonts.Body, "", 12)
+
+		// Split content into paragraphs and process each
+		paragraphs := strings.Split(page.Content, "\n\n")
+		bookmarkLevel := 0
+		nextLink := 0
+		for _, para := range paragraphs {
+			if strings.TrimSpace(para) == "" {
+				continue
+			}
+
+			// Check if it's a heading reference
+			if strings.HasPrefix(para, "[Heading ") {
+				headingNum := 0
+				fmt.Sscanf(para, "[Heading %d]", &headingNum)
+				if headingNum > 0 && headingNum <= len(page.Headings) {
+					heading := page.Headings[headingNum-1]
+					// A heading already at the top of a page needs no break
+					_, top, _, _ := pdf.GetMargins()
+					breakBefore := !opts.HeadingsTOCOnly && heading.Level <= opts.PageBreakLevel && pdf.GetY() > top
+					if breakBefore {
+						pdf.AddPage()
+					}
+					// Outline levels may only step down one at a time
+					bookmarkLevel = min(heading.Level-1, bookmarkLevel+1)
+					links.bookmark(pdf, heading.Text, bookmarkLevel)
+					if opts.HeadingsTOCOnly {
+						// Keep the heading as a link target without printing it
+						headingPages[i][headingNum-1] = pdf.PageNo()
+						links.set(pdf, i, headingNum-1)
+						setDest(slugs[headingNum-1], i, headingNum-1)
+						continue
+					}
+					if !breakBefore {
+						pdf.Ln(3)
+					}
+					headingPages[i][headingNum-1] = pdf.PageNo()
+					links.set(pdf, i, headingNum-1)
+					setDest(slugs[headingNum-1], i, headingNum-1)
+					size := headingFontSize(heading.Level)
+					pdf.SetFont(fonts.Heading, "B", size)
+					pdf.MultiCell(0, size/2, heading.Text, "", "", false)
+					pdf.SetFont(fonts.Body, "", 12)
+					pdf.Ln(3)
+				}
+			} else if strings.HasPrefix(para, "[Image ") {
+				imageNum := 0
+				fmt.Sscanf(para, "[Image %d]", &imageNum)
+				if imageNum > 0 && imageNum <= len(page.Images) {
+					renderImage(pdf, opts.Images, page.Images[imageNum-1], imageMaxWidth)
+				}
+			} else if strings.HasPrefix(para, "[Code Block ") {
+				blockNum := 0
+				fmt.Sscanf(para, "[Code Block %d]", &blockNum)
+				if blockNum > 0 && blockNum <= len(page.Code) {
+					// Label the block with its filename or caption
+					if caption := page.codeCaption(blockNum - 1); caption != "" {
+						pdf.SetFont(fonts.Body, "B", 9)
+						pdf.SetFillColor(220, 220, 220)
+						pdf.MultiCell(0, 6, caption, "", "", true)
+					}
+					// Add code block with monospace font and gray background
+					pdf.SetFont(fonts.Code, "", 10)
+					pdf.SetFillColor(240, 240, 240)
+					pdf.MultiCell(0, 5, wrapCode(page.Code[blockNum-1], wrapCols, opts.CodeWrapMarker), "", "", true)
+					pdf.SetFont(fonts.Body, "", 12)
+					pdf.SetFillColor(255, 255, 255)
+					pdf.Ln(5)
+				}
+			} else if strings.HasPrefix(para, "[Note ") {
+				noteNum := 0
+				fmt.Sscanf(para, "[Note %d]", &noteNum)
+				if noteNum > 0 && noteNum <= len(page.Notes) {
+					// Callout box: a bold label over the note's text
+					note := page.Notes[noteNum-1]
+					pdf.SetFillColor(225, 235, 245)
+					pdf.SetDrawColor(150, 175, 200)
+					pdf.SetFont(fonts.Body, "B", 11)
+					pdf.MultiCell(0, 7, note.Label, "LTR", "", true)
+					pdf.SetFont(fonts.Body, "", 11)
+					pdf.MultiCell(0, 6, note.Text, "LBR", "", true)
+					pdf.SetFont(fonts.Body, "", 12)
+					pdf.SetFillColor(255, 255, 255)
+					pdf.SetDrawColor(0, 0, 0)
+					pdf.Ln(5)
+				}
+			} else {
+				// Regular paragraph
+				if nextLink < len(page.Links) {
+					runs := linkRuns(para, page.Links, &nextLink, pages, links)
+					if opts.Justify || opts.Hyphenate {
+						writeFlowedParagraph(pdf, 6, runs, contentWidth(pdf), opts.Justify, opts.Hyphenate, links)
+					} else {
+						writeLinkedParagraph(pdf, 6, runs, links)
+					}
+				} else {
+					if opts.Hyphenate {
+						para = hyphenateParagraph(pdf, para, contentWidth(pdf))
+					}
+					pdf.MultiCell(0, 6, para, "", align, false)
+				}
+				pdf.Ln(3)
+			}
+		}
+	}
+	return chapterPages, headingPages, dests, nil
+}
+
+// renderTOC adds the table of contents page, listing each chapter and its
+// sections linked to their positions. When chapterPages and headingPages
+// are given, each entry also shows the page its target is on.
+func renderTOC(pdf *gofpdf.Fpdf, fonts pdfFonts, pages []Page, links *pdfLinks, opts pdfOptions, chapterPages []int, headingPages [][]int) {
+	pdf.AddPage()
+	if chapterPages != nil {
+		links.bookmark(pdf, opts.TOCTitle, 0)
+	}
+	pdf.SetFont(fonts.Heading, "B", 24)
+	pdf.Cell(0, 10, opts.TOCTitle)
+	pdf.Ln(20)
+
+	// entry writes one line at x, with the page number right-aligned when known
+	pageWidth, _ := pdf.GetPageSize()
+	_, _, right, _ := pdf.GetMargins()
+	entry := func(x, h float64, text string, page int, link int, linkStr string) {
+		pdf.SetX(x)
+		if page == 0 {
+			links.cell(pdf, 0, h, text, "", link, linkStr)
+		} else {
+			const numberWidth = 15
+			links.cell(pdf, pageWidth-right-x-numberWidth, h, text, "", link, linkStr)
+			links.cell(pdf, numberWidth, h, strconv.Itoa(page), "R", link, linkStr)
+		}
+		pdf.Ln(h)
+	}
+
+	left, _, _, _ := pdf.GetMargins()
+	for i, page := range pages {
+		// Main chapter entry
+		pdf.SetFont(fonts.Body, "B", 12)
+		chapterNum := i + 1
+		chapterPage := 0
+		if chapterPages != nil {
+			chapterPage = chapterPages[i]
+		}
+		link, linkStr := links.target(i, -1)
+		entry(left, 10, numberedTitle(page.Title, opts.Numbering, chapterNum), chapterPage, link, linkStr)
+
+		// Sub-sections, indented
+		pdf.SetFont(fonts.Body, "", 10)
+		listed, more := page.tocSections(opts.TOCDepth, opts.MaxTOCEntries)
+		for n, j := range listed {
+			headingPage := 0
+			if headingPages != nil {
+				headingPage = headingPages[i][j]
+			}
+			link, linkStr := links.target(i, j)
+			entry(20, 8, numberedTitle(page.Headings[j].Text, opts.Numbering, chapterNum, n+1), headingPage, link, linkStr)
+		}
+		if more > 0 {
+			pdf.SetX(20)
+			pdf.SetFont(fonts.Body, "I", 10)
+			pdf.Cell(0, 8, tocRollup(more))
+			pdf.Ln(8)
+		}
+		pdf.Ln(5)
+	}
+}
+
+// contentWidth returns the width between the page margins.
+func contentWidth(pdf *gofpdf.Fpdf) float64 {
+	pageWidth, _ := pdf.GetPageSize()
+	left, _, right, _ := pdf.GetMargins()
+	return pageWidth - left - right
+}
+
+// renderMetadata draws the page's non-empty metadata fields, and its
+// detected language when known, in a shaded box.
+func renderMetadata(pdf *gofpdf.Fpdf, fonts pdfFonts, m Metadata, language string) {
+	var lines []string
+	for _, field := range []struct{ label, value string }{
+		{"Description", m.Description},
+		{"Author", m.Author},
+		{"Date", m.Date},
+		{"Canonical URL", m.Canonical},
+		{"Language", language},
+	} {
+		if field.value != "" {
+			lines = append(lines, field.label+": "+field.value)
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	pdf.SetFont(fonts.Body, "", 9)
+	pdf.SetFillColor(235, 240, 248)
+	pdf.SetDrawColor(180, 190, 210)
+	pdf.MultiCell(0, 5, strings.Join(lines, "\n"), "1", "", true)
+	pdf.SetFillColor(255, 255, 255)
+	pdf.SetDrawColor(0, 0, 0)
+	pdf.Ln(8)
+}
+
+// renderPageTOC lists the chapter's headings, linked to their positions, when
+// it has at least minHeadings of them. h1 is the chapter title and is left out.
+func renderPageTOC(pdf *gofpdf.Fpdf, fonts pdfFonts, page Page, links *pdfLinks, chapter, minHeadings int) {
+	var listed []int
+	for j, heading := range page.Headings {
+		if heading.Level >= 2 {
+			listed = append(listed, j)
+		}
+	}
+	if len(listed) < minHeadings {
+		return
+	}
+
+	left, _, _, _ := pdf.GetMargins()
+	pdf.SetFont(fonts.Body, "B", 12)
+	pdf.Cell(0, 8, "On this page")
+	pdf.Ln(8)
+	pdf.SetFont(fonts.Body, "", 10)
+	for _, j := range listed {
+		heading := page.Headings[j]
+		pdf.SetX(left + float64(heading.Level-2)*5) // Indent deeper headings
+		links.cell(pdf, 0, 6, heading.Text, "", links.headings[chapter][j], "")
+		pdf.Ln(6)
+	}
+	pdf.Ln(6)
+}
+
+// headingFontSize returns the font size for an inline heading, shrinking
+// with each level from 16pt for h2 down to the 12pt body size.
+func headingFontSize(level int) float64 {
+	return float64(max(18-level, 12))
+}
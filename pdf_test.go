@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+var (
+	pdfHeaderPattern   = regexp.MustCompile(`(?m)^(\d+) 0 obj\n`)
+	pdfLengthPattern   = regexp.MustCompile(`/Length (\d+)`)
+	pdfKidPattern      = regexp.MustCompile(`(\d+) 0 R`)
+	pdfFontPattern     = regexp.MustCompile(`/(F\w+) (\d+) 0 R`)
+	pdfBaseFontPattern = regexp.MustCompile(`/BaseFont /(\S+)`)
+	pdfTokenPattern    = regexp.MustCompile(`/(F\w+) ([\d.]+) Tf|([\d.-]+) ([\d.-]+) Td|\(((?:\\.|[^\\)])*)\)\s*Tj`)
+)
+
+// pdfRun is a piece of text shown on a PDF page.
+type pdfRun struct {
+	Font string // base font name, such as Helvetica-Bold
+	Size float64
+	X, Y float64 // from the bottom left of the page
+	Text string
+}
+
+// pdfFile is a PDF written by gofpdf, read back for tests.
+type pdfFile struct {
+	Raw     []byte
+	Objects map[int][]byte // dictionary, or decompressed stream data for streams
+	Pages   [][]pdfRun
+	PageObj []int // object number of each page
+}
+
+// readPDF reads the PDF at path and the text runs on each of its pages,
+// in the order they are drawn. It understands the files gofpdf writes with
+// its core fonts, including those the scraper later appends to.
+func readPDF(t testing.TB, path string) *pdfFile {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &pdfFile{Raw: data, Objects: make(map[int][]byte)}
+	// Objects appended later replace earlier ones with the same number
+	for _, loc := range pdfHeaderPattern.FindAllSubmatchIndex(data, -1) {
+		num, _ := strconv.Atoi(string(data[loc[2]:loc[3]]))
+		obj := data[loc[1]:]
+		if end := bytes.Index(obj, []byte("endobj")); end >= 0 {
+			obj = obj[:end]
+		}
+		if i := bytes.Index(obj, []byte(">>\nstream\n")); i >= 0 && bytes.HasPrefix(obj, []byte("<<")) {
+			n, _ := strconv.Atoi(string(pdfLengthPattern.FindSubmatch(obj[:i])[1]))
+			stream := data[loc[1]+i+len(">>\nstream\n"):][:n]
+			if bytes.Contains(obj[:i], []byte("/FlateDecode")) {
+				r, err := zlib.NewReader(bytes.NewReader(stream))
+				if err != nil {
+					t.Fatalf("object %d: %v", num, err)
+				}
+				if stream, err = io.ReadAll(r); err != nil {
+					t.Fatalf("object %d: %v", num, err)
+				}
+			}
+			f.Objects[num] = stream
+			continue
+		}
+		f.Objects[num] = obj
+	}
+
+	kids := f.Objects[1][bytes.Index(f.Objects[1], []byte("/Kids")):]
+	kids = kids[:bytes.IndexByte(kids, ']')]
+	for _, kid := range pdfKidPattern.FindAllSubmatch(kids, -1) {
+		f.PageObj = append(f.PageObj, atoi(kid[1]))
+		page := f.Objects[atoi(kid[1])]
+		fonts := make(map[string]string)
+		resources := f.Objects[f.ref(page, "/Resources")]
+		for _, font := range pdfFontPattern.FindAllSubmatch(resources, -1) {
+			if m := pdfBaseFontPattern.FindSubmatch(f.Objects[atoi(font[2])]); m != nil {
+				fonts[string(font[1])] = string(m[1])
+			}
+		}
+
+		var runs []pdfRun
+		var run pdfRun
+		for _, tok := range pdfTokenPattern.FindAllSubmatch(f.Objects[f.ref(page, "/Contents")], -1) {
+			switch {
+			case tok[1] != nil:
+				run.Font = fonts[string(tok[1])]
+				run.Size, _ = strconv.ParseFloat(string(tok[2]), 64)
+			case tok[3] != nil:
+				run.X, _ = strconv.ParseFloat(string(tok[3]), 64)
+				run.Y, _ = strconv.ParseFloat(string(tok[4]), 64)
+			default:
+				run.Text = pdfUnescape(string(tok[5]))
+				runs = append(runs, run)
+			}
+		}
+		f.Pages = append(f.Pages, runs)
+	}
+	return f
+}
+
+// ref returns the object number obj refers to after key.
+func (f *pdfFile) ref(obj []byte, key string) int {
+	m := regexp.MustCompile(regexp.QuoteMeta(key) + ` (\d+) 0 R`).FindSubmatch(obj)
+	if m == nil {
+		return 0
+	}
+	return atoi(m[1])
+}
+
+// Text returns the text of page i, one run per line.
+func (f *pdfFile) Text(i int) string {
+	var lines []string
+	for _, run := range f.Pages[i] {
+		lines = append(lines, run.Text)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// AllText returns the text of every page, one run per line.
+func (f *pdfFile) AllText() string {
+	var pages []string
+	for i := range f.Pages {
+		pages = append(pages, f.Text(i))
+	}
+	return strings.Join(pages, "\n")
+}
+
+// find returns the index of the first page showing text, or -1.
+func (f *pdfFile) find(text string) int {
+	for i := range f.Pages {
+		if strings.Contains(f.Text(i), text) {
+			return i
+		}
+	}
+	return -1
+}
+
+// info returns the value of key in the document information dictionary,
+// decoding the UTF-16 gofpdf writes for UTF-8 text.
+func (f *pdfFile) info(key string) string {
+	m := regexp.MustCompile(`/` + key + ` \(((?:\\.|[^\\)])*)\)`).FindSubmatch(f.Raw)
+	if m == nil {
+		return ""
+	}
+	return pdfString(m[1])
+}
+
+// pdfOutlinePattern matches the title of a bookmark in the document outline.
+var pdfOutlinePattern = regexp.MustCompile(`/Title \(((?:\\.|[^\\)])*)\)\s*/Parent`)
+
+// bookmarks returns the titles of the document's bookmarks.
+func (f *pdfFile) bookmarks() []string {
+	var titles []string
+	for _, m := range pdfOutlinePattern.FindAllSubmatch(f.Raw, -1) {
+		titles = append(titles, pdfString(m[1]))
+	}
+	return titles
+}
+
+// pdfString decodes a literal string, which gofpdf writes as UTF-16 for
+// UTF-8 text.
+func pdfString(literal []byte) string {
+	value := pdfUnescape(string(literal))
+	utf16BE, ok := strings.CutPrefix(value, "\xFE\xFF")
+	if !ok {
+		return value
+	}
+	units := make([]uint16, len(utf16BE)/2)
+	for i := range units {
+		units[i] = uint16(utf16BE[2*i])<<8 | uint16(utf16BE[2*i+1])
+	}
+	return string(utf16.Decode(units))
+}
+
+func atoi(b []byte) int {
+	n, _ := strconv.Atoi(string(b))
+	return n
+}
+
+func pdfUnescape(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\(`, `(`, `\)`, `)`, `\r`, "\r").Replace(s)
+}
+
+// renderPDF writes pages to a PDF with opts and reads it back.
+func renderPDF(t testing.TB, pages []Page, opts pdfOptions) *pdfFile {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "out.pdf")
+	if opts.Images == nil {
+		opts.Images = prefetchImages(nil, pages, 1)
+	}
+	if err := writePDF(pages, path, opts); err != nil {
+		t.Fatal(err)
+	}
+	return readPDF(t, path)
+}
+
+func TestTOCDepth(t *testing.T) {
+	pages := syntheticPages(2, "")
+	for _, tc := range []struct {
+		depth int
+		want  []string // section lines expected in the table of contents
+		not   []string
+	}{
+		{0, nil, []string{"Overview", "Usage", "Options"}},
+		{1, []string{"1.1. Overview", "2.2. Usage"}, []string{"Options"}},
+		{2, []string{"1.1. Overview", "1.3. Options", "2.3. Options"}, nil},
+	} {
+		opts := testPDFOptions()
+		opts.TOCDepth = tc.depth
+		toc := renderPDF(t, pages, opts).Text(0)
+		for _, chapter := range []string{"Table of Contents", "1. Page 0", "2. Page 1"} {
+			if !strings.Contains(toc, chapter) {
+				t.Errorf("-toc-depth %d: table of contents lacks %q:\n%s", tc.depth, chapter, toc)
+			}
+		}
+		for _, line := range tc.want {
+			if !strings.Contains(toc, line) {
+				t.Errorf("-toc-depth %d: table of contents lacks %q:\n%s", tc.depth, line, toc)
+			}
+		}
+		for _, line := range tc.not {
+			if strings.Contains(toc, line) {
+				t.Errorf("-toc-depth %d: table of contents lists %q:\n%s", tc.depth, line, toc)
+			}
+		}
+	}
+}
+
+func TestShowMetadata(t *testing.T) {
+	p := scrapeOne(t, `<html><head><title>Guide</title>
+		<meta name="description" content="How to get started.">
+		<meta name="author" content="Ada Lovelace"></head>
+		<body><article><h1>Guide</h1><p>Read this first.</p></article></body></html>`, nil)
+
+	opts := testPDFOptions()
+	opts.ShowMetadata = true
+	text := renderPDF(t, []Page{p}, opts).AllText()
+	for _, line := range []string{"Description: How to get started.", "Author: Ada Lovelace"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("-show-metadata: PDF lacks %q:\n%s", line, text)
+		}
+	}
+	for _, label := range []string{"Date:", "Canonical URL:"} {
+		if strings.Contains(text, label) {
+			t.Errorf("-show-metadata: PDF shows the empty %q field:\n%s", label, text)
+		}
+	}
+
+	if text := renderPDF(t, []Page{p}, testPDFOptions()).AllText(); strings.Contains(text, "Author:") {
+		t.Errorf("PDF shows metadata without -show-metadata:\n%s", text)
+	}
+}
+
+func TestHeadingsTOCOnly(t *testing.T) {
+	pages := []Page{{
+		Title:    "Guide",
+		URL:      "https://example.com/guide",
+		Headings: []Heading{{Level: 2, Text: "Installation Steps"}, {Level: 2, Text: "First Run"}},
+		Content:  "[Heading 1]\n\nGet it.\n\n[Heading 2]\n\nRun it.",
+	}}
+	opts := testPDFOptions()
+	opts.HeadingsTOCOnly = true
+	pdf := renderPDF(t, pages, opts)
+
+	toc, chapter := pdf.Text(0), pdf.find("Get it.")
+	if chapter <= 0 {
+		t.Fatalf("chapter body not found after the table of contents:\n%s", pdf.AllText())
+	}
+	for _, heading := range []string{"Installation Steps", "First Run"} {
+		if !strings.Contains(toc, heading) {
+			t.Errorf("table of contents lacks %q:\n%s", heading, toc)
+		}
+		if body := pdf.Text(chapter); strings.Contains(body, heading) {
+			t.Errorf("chapter body repeats %q:\n%s", heading, body)
+		}
+	}
+	if !strings.Contains(pdf.Text(chapter), "Run it.") {
+		t.Errorf("chapter body lost the section text:\n%s", pdf.Text(chapter))
+	}
+
+	opts.HeadingsTOCOnly = false
+	pdf = renderPDF(t, pages, opts)
+	if body := pdf.Text(pdf.find("Get it.")); !strings.Contains(body, "Installation Steps") {
+		t.Errorf("without -headings-toc-only the chapter body lacks the heading:\n%s", body)
+	}
+}
+
+func TestPageTOC(t *testing.T) {
+	long := Page{Title: "Long", URL: "https://example.com/long"}
+	var content []string
+	for i, name := range []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo"} {
+		long.Headings = append(long.Headings, Heading{Level: 2, Text: name})
+		content = append(content, fmt.Sprintf("[Heading %d]", i+1), "Text under "+name+".")
+	}
+	long.Content = strings.Join(content, "\n\n")
+	short := Page{Title: "Short", URL: "https://example.com/short", Headings: []Heading{{Level: 2, Text: "Only"}}, Content: "[Heading 1]\n\nShort text."}
+
+	opts := testPDFOptions()
+	opts.TOCPosition = "none"
+	opts.PageTOC = 3
+	pdf := renderPDF(t, []Page{long, short}, opts)
+
+	longText, shortText := pdf.Text(pdf.find("Text under Alpha.")), pdf.Text(pdf.find("Short text."))
+	if !strings.Contains(longText, "On this page") {
+		t.Fatalf("page with five headings has no page TOC:\n%s", longText)
+	}
+	toc := longText[strings.Index(longText, "On this page"):strings.Index(longText, "Text under Alpha.")]
+	for _, name := range []string{"Alpha", "Bravo", "Charlie", "Delta", "Echo"} {
+		if !strings.Contains(toc, name) {
+			t.Errorf("page TOC lacks %q:\n%s", name, toc)
+		}
+	}
+	if strings.Contains(shortText, "On this page") {
+		t.Errorf("page with one heading has a page TOC:\n%s", shortText)
+	}
+	// Each entry links to its heading
+	opts.PageTOC = 0
+	without := renderPDF(t, []Page{long, short}, opts)
+	if got := bytes.Count(pdf.Raw, []byte("/Dest [")) - bytes.Count(without.Raw, []byte("/Dest [")); got != 5 {
+		t.Errorf("page TOC added %d internal links, want 5", got)
+	}
+}
+
+func TestSubjectAndKeywords(t *testing.T) {
+	pages := syntheticPages(2, "")
+	opts := testPDFOptions()
+	opts.Subject = "Système docs"
+	opts.Keywords = "scraping, pdf"
+	pdf := renderPDF(t, pages, opts)
+	if got := pdf.info("Subject"); got != opts.Subject {
+		t.Errorf("subject %q, want %q", got, opts.Subject)
+	}
+	if got := pdf.info("Keywords"); got != opts.Keywords {
+		t.Errorf("keywords %q, want %q", got, opts.Keywords)
+	}
+
+	// Without -keywords the most frequent words are used
+	opts.Keywords = ""
+	keywords := renderPDF(t, pages, opts).info("Keywords")
+	if !strings.Contains(keywords, "page") || !strings.Contains(keywords, "detail") {
+		t.Errorf("keywords %q, want the words the pages repeat", keywords)
+	}
+	for _, stopWord := range []string{"the", "of"} {
+		if slices.Contains(strings.Split(keywords, ", "), stopWord) {
+			t.Errorf("keywords %q include the stop word %q", keywords, stopWord)
+		}
+	}
+}
+
+func TestMaxTOCEntries(t *testing.T) {
+	page := Page{Title: "Reference", URL: "https://example.com/reference"}
+	var content []string
+	for i := 1; i <= 50; i++ {
+		page.Headings = append(page.Headings, Heading{Level: 2, Text: fmt.Sprintf("Option %d", i)})
+		content = append(content, fmt.Sprintf("[Heading %d]\n\nAbout option %d.", i, i))
+	}
+	page.Content = strings.Join(content, "\n\n")
+	pages := []Page{page}
+
+	opts := testPDFOptions()
+	opts.MaxTOCEntries = 10
+	pdf := renderPDF(t, pages, opts)
+	toc := pdf.Text(0)
+	for i := 1; i <= 50; i++ {
+		if listed := strings.Contains(toc, fmt.Sprintf("1.%d. Option %d\n", i, i)); listed != (i <= 10) {
+			t.Errorf("-max-toc-entries 10: Option %d listed in the PDF TOC: %v", i, listed)
+		}
+	}
+	if strings.Count(toc, "... and 40 more sections") != 1 {
+		t.Errorf("-max-toc-entries 10: PDF TOC lacks the rollup line:\n%s", toc)
+	}
+	// Every section is still in the chapter itself
+	if text := pdf.AllText(); !strings.Contains(text, "Option 50") || !strings.Contains(text, "About option 50.") {
+		t.Error("-max-toc-entries dropped sections from the chapter")
+	}
+
+	path := filepath.Join(t.TempDir(), "out.md")
+	if err := writeMarkdown(pages, path, markdownOptions{TOCDepth: 2, TOCTitle: "Contents", TOCPosition: "start", Numbering: "decimal", MaxTOCEntries: 10}); err != nil {
+		t.Fatal(err)
+	}
+	md := string(readOutput(t, path))
+	tocPart, _, _ := strings.Cut(md, "\n# 1. Reference")
+	if n := strings.Count(tocPart, "  - [1."); n != 10 {
+		t.Errorf("-max-toc-entries 10: Markdown TOC lists %d sections:\n%s", n, tocPart)
+	}
+	if !strings.Contains(tocPart, "  - ... and 40 more sections\n") {
+		t.Errorf("-max-toc-entries 10: Markdown TOC lacks the rollup line:\n%s", tocPart)
+	}
+
+	if _, more := page.tocSections(2, 49); tocRollup(more) != "... and 1 more section" {
+		t.Errorf("rollup for one section is %q", tocRollup(more))
+	}
+}
+
+func TestTOCAtEnd(t *testing.T) {
+	pages := syntheticPages(3, "")
+	opts := testPDFOptions()
+	opts.TOCTitle = "Contents"
+	opts.TOCPosition = "end"
+	pdf := renderPDF(t, pages, opts)
+
+	last := len(pdf.Pages) - 1
+	if len(pdf.Pages[last]) == 0 || pdf.Pages[last][0].Text != "Contents" {
+		t.Fatalf("last page does not start with the Contents title:\n%s", pdf.Text(last))
+	}
+	if pdf.find("Contents") != last {
+		t.Errorf("Contents appears before the chapters, on page %d", pdf.find("Contents")+1)
+	}
+	runs := pdf.Pages[last]
+	for i, page := range pages {
+		title := numberedTitle(page.Title, "decimal", i+1)
+		want := strconv.Itoa(pdf.find(title) + 1)
+		j := slices.IndexFunc(runs, func(r pdfRun) bool { return r.Text == title })
+		if j < 0 || j+1 >= len(runs) || runs[j+1].Text != want {
+			t.Errorf("TOC entry for %q not followed by its page number %s:\n%s", title, want, pdf.Text(last))
+		}
+	}
+	if got := pdf.bookmarks(); len(got) == 0 || !slices.Contains(got, "Contents") {
+		t.Errorf("bookmarks %q lack the Contents page", got)
+	}
+
+	opts.TOCPosition = "none"
+	if text := renderPDF(t, pages, opts).AllText(); strings.Contains(text, "Contents") {
+		t.Errorf("-toc-position none still renders a TOC:\n%s", text)
+	}
+}
+
+func TestDocTitleBookmarks(t *testing.T) {
+	page := scrapeOne(t, `<html><head><title>Install · Acme   Docs</title></head><body><article>
+		<h1>Installing Acme</h1><p>Get it.</p></article></body></html>`, nil)
+	if page.Title != "Installing Acme" || page.DocTitle != "Install · Acme Docs" {
+		t.Fatalf("captured title %q and document title %q, want the <h1> and the <title>", page.Title, page.DocTitle)
+	}
+	untitled := Page{Title: "Reference", URL: "https://example.com/ref", Content: "Look things up."}
+
+	pdf := renderPDF(t, []Page{page, untitled}, testPDFOptions())
+	if got, want := pdf.bookmarks(), []string{"1. Install · Acme Docs", "2. Reference"}; !slices.Equal(got, want) {
+		t.Errorf("bookmarks %q, want %q", got, want)
+	}
+	text := pdf.AllText()
+	if !strings.Contains(text, "1. Installing Acme") || !strings.Contains(text, "2. Reference") {
+		t.Errorf("chapter headings do not show the <h1>:\n%s", text)
+	}
+	if strings.Contains(text, "Acme Docs") {
+		t.Errorf("document title shown on the page:\n%s", text)
+	}
+}
+
+func TestPageBreakBefore(t *testing.T) {
+	page := Page{
+		Title: "Guide",
+		URL:   "https://example.com/guide",
+		Content: "Introduction.\n\n[Heading 1]\n\nAlpha text.\n\n[Heading 2]\n\nAlpha detail text.\n\n" +
+			"[Heading 3]\n\nBeta text.\n\n[Heading 4]\n\n[Heading 5]\n\nGamma detail text.",
+		Headings: []Heading{
+			{Level: 2, Text: "Alpha"},
+			{Level: 3, Text: "Alpha detail"},
+			{Level: 2, Text: "Beta"},
+			{Level: 2, Text: "Gamma"},
+			{Level: 3, Text: "Gamma detail"},
+		},
+	}
+	opts := testPDFOptions()
+	opts.TOCPosition = "none"
+	// startsPage reports whether text is the first thing drawn on its page
+	startsPage := func(pdf *pdfFile, text string) bool {
+		i := pdf.find(text)
+		return i >= 0 && strings.Contains(pdf.Pages[i][0].Text, text)
+	}
+	for _, tc := range []struct {
+		level  int
+		breaks []string // headings that start a page
+		pages  int
+	}{
+		{0, nil, 1},
+		{2, []string{"Alpha", "Beta", "Gamma"}, 4},
+		{3, []string{"Alpha", "Alpha detail", "Beta", "Gamma", "Gamma detail"}, 6},
+	} {
+		opts.PageBreakLevel = tc.level
+		pdf := renderPDF(t, []Page{page}, opts)
+		if len(pdf.Pages) != tc.pages {
+			t.Errorf("-page-break-before h%d: got %d pages, want %d", tc.level, len(pdf.Pages), tc.pages)
+		}
+		for _, h := range page.Headings {
+			if got, want := startsPage(pdf, h.Text), slices.Contains(tc.breaks, h.Text); got != want {
+				t.Errorf("-page-break-before h%d: %q starts a page %t, want %t", tc.level, h.Text, got, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// adaptiveDelay spaces requests out by a delay that follows the server's
+// health: it backs off when responses slow down or the server answers 429
+// or 503, and creeps back towards min while responses stay quick.
+type adaptiveDelay struct {
+	min, max time.Duration
+
+	mu      sync.Mutex
+	delay   time.Duration
+	average time.Duration // moving average of response times
+	next    time.Time     // earliest start of the next request
+}
+
+// adaptiveStep is the smallest delay used once backing off from zero.
+const adaptiveStep = 250 * time.Millisecond
+
+func newAdaptiveDelay(min, max time.Duration) *adaptiveDelay {
+	if max < min {
+		max = min
+	}
+	return &adaptiveDelay{min: min, max: max, delay: min}
+}
+
+// wait blocks until the current delay has passed since the previous
+// request started, or ctx is done.
+func (a *adaptiveDelay) wait(ctx context.Context) {
+	a.mu.Lock()
+	now := time.Now()
+	start := a.next
+	if start.Before(now) {
+		start = now
+	}
+	a.next = start.Add(a.delay)
+	a.mu.Unlock()
+
+	select {
+	case <-time.After(time.Until(start)):
+	case <-ctx.Done():
+	}
+}
+
+// observe adjusts the delay after a response that took elapsed to
+// arrive, reporting the new delay and whether it grew.
+func (a *adaptiveDelay) observe(status int, elapsed time.Duration) (time.Duration, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous := a.delay
+	switch {
+	case status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable:
+		a.delay = max(a.delay*2, adaptiveStep)
+	case a.average > 0 && elapsed > a.average*3/2:
+		a.delay = max(a.delay*3/2, adaptiveStep)
+	case a.average > 0 && elapsed <= a.average:
+		a.delay = a.delay * 9 / 10
+	}
+	a.delay = min(max(a.delay, a.min), a.max)
+	if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable && elapsed > 0 {
+		if a.average == 0 {
+			a.average = elapsed
+		} else {
+			a.average = (a.average*4 + elapsed) / 5
+		}
+	}
+	if a.delay != previous {
+		a.next = a.next.Add(a.delay - previous)
+	}
+	return a.delay, a.delay > previous
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAdaptiveDelayGrowsUnderLoad(t *testing.T) {
+	// Each request is slower than the one before, as if the server were straining
+	var mu sync.Mutex
+	var starts []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		n := len(starts)
+		starts = append(starts, time.Now())
+		mu.Unlock()
+		time.Sleep(time.Duration(n*n) * 10 * time.Millisecond)
+		body := `<p>Start here.</p>`
+		for i := 1; i <= 4; i++ {
+			body += fmt.Sprintf(`<a href="/%d">%d</a> `, i, i)
+		}
+		w.Write([]byte(htmlPage("Page", body)))
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.AdaptiveRate = true
+	opts.MaxDelay = 2 * time.Second
+	opts.DedupeThreshold = 0
+	pages, out, err := crawlLogged(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 5 {
+		t.Fatalf("crawled %d pages, want 5", len(pages))
+	}
+	if !strings.Contains(out, "Slowing down to one request every") {
+		t.Errorf("delay never raised as responses slowed:\n%s", out)
+	}
+	// The gap between requests beyond the response time itself widens
+	idle := func(i int) time.Duration {
+		return starts[i+1].Sub(starts[i]) - time.Duration(i*i)*10*time.Millisecond
+	}
+	if first, last := idle(0), idle(len(starts)-2); last <= first || last < adaptiveStep {
+		t.Errorf("idle time between requests went from %s to %s, want it to grow", first, last)
+	}
+}
+
+func TestAdaptiveDelayObserve(t *testing.T) {
+	a := newAdaptiveDelay(0, time.Second)
+	a.observe(200, 100*time.Millisecond)
+	if delay, slower := a.observe(200, 300*time.Millisecond); !slower || delay != adaptiveStep {
+		t.Errorf("slow response gave delay %s (slower %v), want %s", delay, slower, adaptiveStep)
+	}
+	if delay, _ := a.observe(http.StatusTooManyRequests, 0); delay != 2*adaptiveStep {
+		t.Errorf("429 gave delay %s, want it doubled to %s", delay, 2*adaptiveStep)
+	}
+	for i := 0; i < 5; i++ {
+		a.observe(http.StatusServiceUnavailable, 0)
+	}
+	if a.delay != time.Second {
+		t.Errorf("repeated 503s gave delay %s, want the %s maximum", a.delay, time.Second)
+	}
+	for i := 0; i < 100; i++ {
+		a.observe(200, 10*time.Millisecond)
+	}
+	if a.delay >= adaptiveStep {
+		t.Errorf("quick responses left the delay at %s, want it back towards 0", a.delay)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// positiveHints and negativeHints match class and id values that
+	// suggest an element does or does not hold the main content.
+	positiveHints = regexp.MustCompile(`(?i)article|body|content|entry|main|page|post|text|blog|story`)
+	negativeHints = regexp.MustCompile(`(?i)\bad\b|ads|banner|comment|footer|menu|meta|nav|promo|related|share|sidebar|social|sponsor|widget`)
+)
+
+// minParagraphLength is the shortest paragraph that counts towards a
+// candidate's score.
+const minParagraphLength = 25
+
+// readableContent finds the main content block of a document the way
+// readability tools do: each paragraph scores its parent (and half as much
+// its grandparent) by length and comma count, class and id names nudge the
+// scores, and link-heavy blocks are penalised. The best block is returned
+// as a copy with page chrome and negatively hinted children removed, or an
+// empty selection when no block has enough text.
+func readableContent(doc *goquery.Selection) *goquery.Selection {
+	scores := make(map[*goquery.Selection]float64)
+	var nodes []*goquery.Selection
+	candidate := func(s *goquery.Selection) *goquery.Selection {
+		if s.Length() == 0 || goquery.NodeName(s) == "html" {
+			return nil
+		}
+		for _, c := range nodes {
+			if c.Nodes[0] == s.Nodes[0] {
+				return c
+			}
+		}
+		nodes = append(nodes, s)
+		scores[s] = classWeight(s)
+		return s
+	}
+
+	doc.Find("p, pre, td").Each(func(_ int, p *goquery.Selection) {
+		text := strings.TrimSpace(p.Text())
+		if len(text) < minParagraphLength {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")) + min(float64(len(text))/100, 3)
+		if parent := candidate(p.Parent()); parent != nil {
+			scores[parent] += score
+		}
+		if grandparent := candidate(p.Parent().Parent()); grandparent != nil {
+			scores[grandparent] += score / 2
+		}
+	})
+
+	var best *goquery.Selection
+	bestScore := 0.0
+	for _, c := range nodes {
+		score := scores[c] * (1 - linkDensity(c))
+		if score > bestScore {
+			best, bestScore = c, score
+		}
+	}
+	if best == nil {
+		return doc.Slice(0, 0)
+	}
+
+	content := best.Clone()
+	content.Find(boilerplateSelector).Remove()
+	content.Find("[class], [id]").Each(func(_ int, s *goquery.Selection) {
+		if classWeight(s) < 0 {
+			s.Remove()
+		}
+	})
+	return content
+}
+
+// classWeight scores an element's class and id against the content hints.
+func classWeight(s *goquery.Selection) float64 {
+	weight := 0.0
+	for _, name := range []string{s.AttrOr("class", ""), s.AttrOr("id", "")} {
+		if name == "" {
+			continue
+		}
+		if negativeHints.MatchString(name) {
+			weight -= 25
+		}
+		if positiveHints.MatchString(name) {
+			weight += 25
+		}
+	}
+	return weight
+}
+
+// linkDensity is the share of an element's text that sits inside links.
+func linkDensity(s *goquery.Selection) float64 {
+	total := len(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+	linked := 0
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linked += len(strings.TrimSpace(a.Text()))
+	})
+	return float64(linked) / float64(total)
+}
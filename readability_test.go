@@ -0,0 +1,43 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadability(t *testing.T) {
+	cluttered := `<html><head><title>Story</title></head><body>
+		<div class="menu"><a href="/">Home</a> <a href="/news">News</a> <a href="/sport">Sport</a></div>
+		<div class="banner ads"><p>Buy one, get one free, only today, at your local store, while stocks last.</p></div>
+		<div class="layout">
+			<div class="sidebar"><p>Trending: ten tricks, five lists, and one more thing you will not believe.</p></div>
+			<div class="post-body">
+				<h2>The river rose overnight</h2>
+				<p>Residents woke to find the river had risen, flooding streets near the old bridge, closing shops, and cutting power.</p>
+				<p>Officials said the water, which peaked before dawn, was expected to fall slowly over the weekend, weather permitting.</p>
+				<p>Volunteers filled sandbags through the night, and the town hall opened as a shelter, offering food, blankets and tea.</p>
+				<div class="share"><a href="/s/1">Share</a> <a href="/s/2">Tweet</a></div>
+			</div>
+		</div>
+		<div class="comments"><p>First! Great story, thanks for posting it, please write more like this soon.</p></div>
+		<footer><p>Copyright the paper, all rights reserved, no reproduction without permission.</p></footer>
+		</body></html>`
+
+	p := scrapeOne(t, cluttered, func(o *CrawlOptions) { o.Readability = true })
+	for _, text := range []string{"Residents woke", "Officials said", "Volunteers filled"} {
+		if !strings.Contains(p.Content, text) {
+			t.Errorf("-readability: content lacks %q:\n%s", text, p.Content)
+		}
+	}
+	for _, clutter := range []string{"Buy one", "Trending", "Share", "First!", "Copyright", "Sport"} {
+		if strings.Contains(p.Content, clutter) {
+			t.Errorf("-readability: content has the clutter %q:\n%s", clutter, p.Content)
+		}
+	}
+
+	// Without a block of prose the selectors are used instead
+	p = scrapeOne(t, htmlPage("Short", `<p>Tiny.</p>`), func(o *CrawlOptions) { o.Readability = true })
+	if !strings.Contains(p.Content, "Tiny.") {
+		t.Errorf("-readability fallback: content %q lacks the article text", p.Content)
+	}
+}
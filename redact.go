@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// defaultRedactPatterns match common secrets: email addresses and AWS access key IDs.
+var defaultRedactPatterns = []string{
+	`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`,
+	`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`,
+}
+
+const redactedText = "[REDACTED]"
+
+// redactor scrubs sensitive patterns from extracted text.
+type redactor struct {
+	patterns []*regexp.Regexp
+}
+
+func newRedactor(patterns []string) (*redactor, error) {
+	r := &redactor{}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redact pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+func (r *redactor) redact(text string) string {
+	for _, re := range r.patterns {
+		text = re.ReplaceAllString(text, redactedText)
+	}
+	return text
+}
+
+// apply redacts every piece of extracted text and code in the page,
+// including its metadata, breadcrumb, image alt text and link targets
+// such as mailto: addresses.
+func (r *redactor) apply(p *Page) {
+	if len(r.patterns) == 0 {
+		return
+	}
+	p.Title = r.redact(p.Title)
+	p.DocTitle = r.redact(p.DocTitle)
+	p.Content = r.redact(p.Content)
+	for i := range p.Headings {
+		p.Headings[i].Text = r.redact(p.Headings[i].Text)
+	}
+	for i := range p.Code {
+		p.Code[i] = r.redact(p.Code[i])
+	}
+	for i := range p.CodeCaptions {
+		p.CodeCaptions[i] = r.redact(p.CodeCaptions[i])
+	}
+	for i := range p.Notes {
+		p.Notes[i].Label = r.redact(p.Notes[i].Label)
+		p.Notes[i].Text = r.redact(p.Notes[i].Text)
+	}
+	for i := range p.Links {
+		p.Links[i].Text = r.redact(p.Links[i].Text)
+		p.Links[i].URL = r.redact(p.Links[i].URL)
+	}
+	for i := range p.Images {
+		p.Images[i].Alt = r.redact(p.Images[i].Alt)
+	}
+	for i := range p.Breadcrumb {
+		p.Breadcrumb[i] = r.redact(p.Breadcrumb[i])
+	}
+	m := &p.Metadata
+	for _, field := range []*string{&m.Description, &m.Author, &m.Date, &m.Modified, &m.Canonical} {
+		*field = r.redact(*field)
+	}
+}
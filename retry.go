@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+// maxRetryDelay caps the wait before a retry, whether it comes from the
+// backoff or from a server's Retry-After header, so that a server asking
+// for hours cannot stall a worker for that long.
+const maxRetryDelay = time.Minute
+
+// retryPolicy decides whether and when failed requests are retried.
+// Attempts are counted per URL because colly shares a request's context
+// with the requests it spawns.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func newRetryPolicy(maxRetries int, baseDelay time.Duration) *retryPolicy {
+	return &retryPolicy{
+		maxRetries: maxRetries,
+		baseDelay:  baseDelay,
+		attempts:   make(map[string]int),
+	}
+}
+
+// next reports whether the failed response should be retried and how long
+// to wait first. Network errors, 429 and 5xx responses are retried with
+// exponential backoff, unless the server sent a Retry-After header, and
+// never wait longer than maxRetryDelay.
+func (p *retryPolicy) next(r *colly.Response) (time.Duration, bool) {
+	if !isRetryable(r.StatusCode) {
+		return 0, false
+	}
+
+	key := r.Request.URL.String()
+	p.mu.Lock()
+	attempt := p.attempts[key]
+	if attempt >= p.maxRetries {
+		p.mu.Unlock()
+		return 0, false
+	}
+	p.attempts[key] = attempt + 1
+	p.mu.Unlock()
+
+	if r.Headers != nil {
+		if delay, ok := retryAfter(*r.Headers, time.Now()); ok {
+			return min(delay, maxRetryDelay), true
+		}
+	}
+	// Past 30 doublings the shift could overflow, and the cap applies anyway
+	return min(p.baseDelay<<min(attempt, 30), maxRetryDelay), true
+}
+
+// isRetryable reports whether a status code is worth retrying. A zero
+// status means the request failed before a response arrived.
+func isRetryable(status int) bool {
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryAfter parses a Retry-After header given either as seconds or as an
+// HTTP date.
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	value := strings.TrimSpace(h.Get("Retry-After"))
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil && secs >= 0 {
+		// Keep absurd values from overflowing the duration
+		return time.Duration(min(secs, math.MaxInt64/int64(time.Second))) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
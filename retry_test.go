@@ -0,0 +1,137 @@
+package main
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gocolly/colly/v2"
+)
+
+func TestRetryAfter429(t *testing.T) {
+	var mu sync.Mutex
+	var hits []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		hits = append(hits, time.Now())
+		first := len(hits) == 1
+		mu.Unlock()
+		if first {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(htmlPage("Home", "<p>Finally.</p>")))
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Retries = 2
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatalf("crawl failed: %v", err)
+	}
+	if len(pages) != 1 {
+		t.Fatalf("crawl returned %d pages, want 1", len(pages))
+	}
+	if len(hits) != 2 {
+		t.Fatalf("server was hit %d times, want 2", len(hits))
+	}
+	if wait := hits[1].Sub(hits[0]); wait < time.Second {
+		t.Errorf("retried after %v, before the one second Retry-After", wait)
+	}
+}
+
+// TestRetryLeftQueued stops a crawl while a page waits to be retried and
+// checks that the page is saved to the frontier to be fetched on resume.
+func TestRetryLeftQueued(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Write([]byte(htmlPage("Home", `<p>Start here.</p><a href="/busy">Busy</a>`)))
+		case "/busy":
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	path := filepath.Join(t.TempDir(), "frontier.json")
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Deterministic = false
+	opts.Retries = 1
+	opts.Frontier = path
+	opts.Timeout = 2 * time.Second
+	// The crawl reports /busy as failed, having run out of time to retry it
+	Crawl(opts)
+	saved, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("crawl saved no frontier: %v", err)
+	}
+	if !strings.Contains(string(saved), srv.URL+"/busy") {
+		t.Errorf("frontier %s does not keep /busy, which was waiting to be retried", saved)
+	}
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	now := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"1", time.Second, true},
+		{"120", 2 * time.Minute, true},
+		{"99999999999", math.MaxInt64 / time.Second * time.Second, true},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"", 0, false},
+		{"soon", 0, false},
+	} {
+		got, ok := retryAfter(http.Header{"Retry-After": {tc.value}}, now)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tc.value, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestRetryDelayCapped(t *testing.T) {
+	policy := newRetryPolicy(40, time.Second)
+	req := &colly.Request{URL: &url.URL{Scheme: "http", Host: "example.com", Path: "/"}}
+	for _, tc := range []struct {
+		retryAfter string
+		want       time.Duration
+	}{
+		{"5", 5 * time.Second},
+		{"86400", maxRetryDelay},
+		{"99999999999", maxRetryDelay},
+		{time.Now().Add(48 * time.Hour).UTC().Format(http.TimeFormat), maxRetryDelay},
+	} {
+		headers := http.Header{"Retry-After": {tc.retryAfter}}
+		got, ok := policy.next(&colly.Response{StatusCode: http.StatusServiceUnavailable, Request: req, Headers: &headers})
+		if !ok || got != tc.want {
+			t.Errorf("Retry-After %q: waits %v, %v, want %v", tc.retryAfter, got, ok, tc.want)
+		}
+	}
+
+	// The backoff itself stops growing at the cap, however many attempts
+	for attempt := 4; attempt < 40; attempt++ {
+		got, ok := policy.next(&colly.Response{StatusCode: 0, Request: req})
+		if !ok || got <= 0 || got > maxRetryDelay {
+			t.Fatalf("attempt %d: backoff %v, %v, want at most %v", attempt+1, got, ok, maxRetryDelay)
+		}
+	}
+}
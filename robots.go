@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxRobotsBytes bounds the size of a downloaded robots.txt.
+const maxRobotsBytes = 512 << 10
+
+// robotsInfo is what the crawler uses from a site's robots.txt.
+type robotsInfo struct {
+	// CrawlDelay is the Crawl-delay of the group matching our user agent,
+	// or zero when it sets none.
+	CrawlDelay time.Duration
+	// Sitemaps are the absolute URLs of the Sitemap lines, in file order.
+	Sitemaps []string
+}
+
+// fetchRobots downloads and parses the robots.txt of the site that siteURL
+// belongs to. A missing robots.txt yields an empty robotsInfo.
+func fetchRobots(client *http.Client, siteURL, userAgent string) (robotsInfo, error) {
+	u, err := url.Parse(siteURL)
+	if err != nil {
+		return robotsInfo{}, err
+	}
+	robotsURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/robots.txt"}).String()
+	req, err := http.NewRequest(http.MethodGet, robotsURL, nil)
+	if err != nil {
+		return robotsInfo{}, err
+	}
+	req.Header.Set("User-Agent", userAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return robotsInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return robotsInfo{}, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return robotsInfo{}, fmt.Errorf("unexpected status %s for %s", resp.Status, robotsURL)
+	}
+	return parseRobots(io.LimitReader(resp.Body, maxRobotsBytes), userAgent), nil
+}
+
+// parseRobots reads a robots.txt. The Crawl-delay comes from the group
+// whose User-agent is the longest one contained in userAgent, falling
+// back to the "*" group. Sitemap lines apply whatever group they are in.
+func parseRobots(r io.Reader, userAgent string) robotsInfo {
+	var info robotsInfo
+	agent := strings.ToLower(userAgent)
+	var groupAgents []string
+	inAgents := false // still reading a group's User-agent lines
+	best, wildcard := -1, time.Duration(-1)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		switch key {
+		case "sitemap":
+			if u, err := url.Parse(value); err == nil && u.Host != "" {
+				info.Sitemaps = append(info.Sitemaps, u.String())
+			}
+		case "user-agent":
+			if !inAgents {
+				groupAgents = nil
+			}
+			groupAgents = append(groupAgents, strings.ToLower(value))
+			inAgents = true
+		case "crawl-delay":
+			inAgents = false
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil || seconds < 0 {
+				continue
+			}
+			delay := time.Duration(seconds * float64(time.Second))
+			for _, name := range groupAgents {
+				switch {
+				case name == "*":
+					wildcard = delay
+				case strings.Contains(agent, name) && len(name) > best:
+					best, info.CrawlDelay = len(name), delay
+				}
+			}
+		default:
+			inAgents = false
+		}
+	}
+	if best < 0 && wildcard >= 0 {
+		info.CrawlDelay = wildcard
+	}
+	return info
+}
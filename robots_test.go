@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRobotsCrawlDelay(t *testing.T) {
+	var mu sync.Mutex
+	var requests []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nCrawl-delay: 2\n"))
+			return
+		case "/":
+			w.Write([]byte(htmlPage("Home", `<p>Start here.</p><a href="/a">A</a>`)))
+		case "/a":
+			w.Write([]byte(htmlPage("Page A", `<p>Page A.</p>`)))
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		requests = append(requests, time.Now())
+		mu.Unlock()
+	}))
+	t.Cleanup(srv.Close)
+
+	// -delay 0, so only robots.txt spaces the requests out
+	opts := testCrawlOptions(srv.URL + "/")
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 || len(requests) != 2 {
+		t.Fatalf("crawled %d pages in %d requests, want 2", len(pages), len(requests))
+	}
+	if gap := requests[1].Sub(requests[0]); gap < 2*time.Second {
+		t.Errorf("requests %s apart, want at least the 2s Crawl-delay", gap)
+	}
+}
+
+func TestParseRobotsCrawlDelay(t *testing.T) {
+	robots := `User-agent: *
+Crawl-delay: 1
+
+User-agent: OtherBot
+User-agent: PDFScraper
+Crawl-delay: 2.5
+Disallow: /private
+
+User-agent: PDFScraperBeta
+Crawl-delay: oops
+`
+	for agent, want := range map[string]time.Duration{
+		"PDFScraper/1.0":      2500 * time.Millisecond,
+		"Mozilla/5.0 Firefox": time.Second,
+	} {
+		if got := parseRobots(strings.NewReader(robots), agent).CrawlDelay; got != want {
+			t.Errorf("Crawl-delay for %q is %s, want %s", agent, got, want)
+		}
+	}
+	if got := parseRobots(strings.NewReader("User-agent: *\nDisallow: /\n"), "PDFScraper").CrawlDelay; got != 0 {
+		t.Errorf("Crawl-delay %s without one in robots.txt", got)
+	}
+}
@@ -0,0 +1,843 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/antchfx/xpath"
+	"github.com/gocolly/colly/v2"
+)
+
+// CrawlOptions configures a crawl. They mirror the command-line flags,
+// already parsed and validated.
+type CrawlOptions struct {
+	URL            string
+	AllowDomains   []string // hosts crawled besides the -url host
+	Sitemap        string   // sitemap URL, or "auto" for those in robots.txt
+	SitemapOnly    bool
+	ReachableFrom  string
+	Frontier       string
+	MaxDepth       int
+	Sections       []sectionDepth
+	Timeout        time.Duration
+	RequestTimeout time.Duration
+	PageTimeout    time.Duration // 0 means no limit
+	Deterministic  bool
+	Debug          bool
+
+	// Which links are followed
+	FollowNext       bool
+	NextAttrs        []string
+	LinkSources      []linkSource
+	FollowNofollow   bool
+	NormalizeURLs    bool
+	TrailingSlash    string
+	MaxQueryVariants int
+	AllowQueryCrawl  bool
+	Exclude          []*regexp.Regexp
+
+	// How requests are made
+	Delay              time.Duration
+	AdaptiveRate       bool
+	MaxDelay           time.Duration
+	Retries            int
+	Transport          transportOptions
+	ConcurrentDomains  int
+	UserAgentPerDomain bool
+	HostHeader         string
+
+	// Where a page's content is found
+	SummaryOnly      bool
+	Readability      bool
+	ContentSelectors []string
+	ContentXPath     *xpath.Expr
+	ContentMinWords  int
+	FallbackSelector string
+	StripBoilerplate bool
+	SectionAnchors   []sectionAnchor
+	Extract          extractOptions
+
+	// Which pages are kept, and how
+	RenderEmptyPages bool
+	Since            time.Time
+	IncludeUndated   bool
+	ContentFilterCmd string
+	Redact           *redactor
+	Dedupe           bool
+	DedupeThreshold  float64
+	SortBy           string
+
+	// Reports written after the crawl (optional)
+	StatsJSON   string
+	BrokenLinks string
+	Manifest    string
+	// ManifestOptions are recorded in the manifest as the run's options,
+	// such as the command line's flag values
+	ManifestOptions map[string]string
+
+	// Set with CrawlOption functions such as WithExtractor
+	onPageScraped []PageScrapedFunc
+	extractor     Extractor
+	client        *http.Client
+	logger        *log.Logger
+}
+
+// DefaultCrawlOptions returns the options a crawl starts from before any
+// command-line flags are applied; set URL before passing them to Crawl.
+func DefaultCrawlOptions() CrawlOptions {
+	// The built-in link sources and redact patterns are known to parse
+	linkSources, _ := parseLinkSources(defaultLinkSources)
+	redact, _ := newRedactor(defaultRedactPatterns)
+	return CrawlOptions{
+		Timeout:          300 * time.Second,
+		RequestTimeout:   30 * time.Second,
+		PageTimeout:      30 * time.Second,
+		FollowNext:       true,
+		NextAttrs:        []string{"data-next"},
+		LinkSources:      linkSources,
+		TrailingSlash:    "keep",
+		MaxQueryVariants: 10,
+		Delay:            time.Second,
+		MaxDelay:         30 * time.Second,
+		Retries:          2,
+		ContentSelectors: defaultContentSelectors,
+		FallbackSelector: "body",
+		StripBoilerplate: true,
+		Extract: extractOptions{
+			MultiContainer:     "first",
+			MaxHeadingDepth:    6,
+			BreadcrumbSelector: defaultBreadcrumbSelector,
+			ImageMode:          "embed",
+			Asides:             "inline",
+			ContentOrder:       "dom",
+			TrimCode:           true,
+			CodeTabWidth:       4,
+			AnchorChars:        "¶§#🔗",
+			CollapseBlankLines: true,
+		},
+		IncludeUndated:  true,
+		Redact:          redact,
+		DedupeThreshold: 0.5,
+		SortBy:          "url",
+	}
+}
+
+// Crawl scrapes the site at opts.URL and returns its pages sorted by URL,
+// by breadcrumb trail when opts.SortBy is "breadcrumb", or in discovery
+// order for Deterministic crawls other than SummaryOnly ones. Pages are
+// returned even when some URLs could not be fetched; the error then joins
+// a *CrawlError for each of them. Any other error means the crawl could
+// not run at all. Progress is only logged when given WithLogger.
+func Crawl(opts CrawlOptions, options ...CrawlOption) ([]Page, error) {
+	for _, option := range options {
+		option(&opts)
+	}
+	logger := opts.logger
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	// Parse the URL to get the domain
+	parsedURL, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+
+	// Extract the domain from the URL; links are also followed to the
+	// allowed domains
+	domain := parsedURL.Hostname()
+	domains := append([]string{domain}, opts.AllowDomains...)
+	baseURL := opts.URL
+	// Collapse the spellings of each page's URL before it is checked against visited pages
+	normalize := func(link string) string { return link }
+	if opts.NormalizeURLs {
+		normalize = func(link string) string { return normalizeURL(link, opts.TrailingSlash) }
+		baseURL = normalize(baseURL)
+	}
+	pages := []Page{}
+	visited := newVisitedSet()
+	links := newLinkGraph()
+	// URLs queued but not yet fetched, saved with -frontier
+	queued := newFrontier()
+	var resumed frontierFile
+	if opts.Frontier != "" {
+		if resumed, err = loadFrontier(opts.Frontier, visited, links); err != nil {
+			return nil, fmt.Errorf("failed to load frontier: %w", err)
+		}
+		if len(resumed.Pending) > 0 {
+			logger.Printf("Resuming crawl with %d scraped pages and %d queued URLs from %s\n", len(resumed.Pages), len(resumed.Pending), opts.Frontier)
+		}
+	}
+	// Sitemap lastmod dates by URL, used for pages without their own date
+	var sitemapDates sync.Map
+	modifiedSince := opts.Since.Format(time.DateOnly)
+
+	// Bound the query-string variants followed per path
+	var queries *queryGuard
+	if !opts.AllowQueryCrawl {
+		queries = newQueryGuard(opts.MaxQueryVariants)
+	}
+
+	// Create a context with timeout
+	ctx, cancel := context.WithTimeout(context.Background(), opts.Timeout)
+	defer cancel()
+
+	// Extraction stops early once the overall deadline has passed
+	extractOpts := opts.Extract
+	extractOpts.Ctx = ctx
+	extractOpts.Logger = logger
+	extractor := opts.extractor
+	if extractor == nil {
+		extractor = SelectorExtractor{Options: extractOpts}
+	}
+
+	// The collector enforces the deepest limit; shallower ones are checked per link
+	collectorDepth := opts.MaxDepth
+	for _, section := range opts.Sections {
+		if collectorDepth > 0 && (section.Depth == 0 || section.Depth > collectorDepth) {
+			collectorDepth = section.Depth
+		}
+	}
+
+	// Initialize the collector with configuration
+	c := colly.NewCollector(
+		colly.AllowedDomains(domains...),
+		colly.MaxDepth(collectorDepth),
+		colly.TraceHTTP(),
+	)
+	// colly.Async turns async mode on whatever its argument, so set it directly
+	c.Async = !opts.Deterministic
+
+	// Configure TLS, proxies and headers for every request of the crawl
+	client := opts.client
+	if client == nil {
+		if client, err = newCrawlClient(opts, logger); err != nil {
+			return nil, err
+		}
+	}
+	userAgent := c.UserAgent
+	if agents, ok := client.Transport.(*domainAgents); ok {
+		userAgent = agents.forHost(domain)
+	}
+	c.WithTransport(client.Transport)
+
+	// Set timeouts and limits
+	c.SetRequestTimeout(opts.RequestTimeout)
+
+	limit := &colly.LimitRule{
+		DomainGlob:  "*",
+		Parallelism: 2,
+		Delay:       opts.Delay,
+		RandomDelay: 1 * time.Second,
+	}
+
+	// Space requests out at least as much as robots.txt asks
+	robots, err := fetchRobots(client, baseURL, userAgent)
+	if err != nil {
+		logger.Printf("Failed to read robots.txt: %v\n", err)
+	}
+	if robots.CrawlDelay > limit.Delay {
+		logger.Printf("Using robots.txt Crawl-delay of %s for %s\n", robots.CrawlDelay, domain)
+		limit.Delay = robots.CrawlDelay
+		// A single request at a time keeps the delay between requests
+		limit.Parallelism = 1
+	}
+	if opts.Deterministic {
+		limit.Parallelism = 1
+		limit.RandomDelay = 0
+	}
+	// The adaptive delay takes over spacing requests, starting from the fixed one
+	var adaptive *adaptiveDelay
+	if opts.AdaptiveRate {
+		adaptive = newAdaptiveDelay(limit.Delay, opts.MaxDelay)
+		limit.Delay = 0
+		limit.RandomDelay = 0
+	}
+	c.Limit(limit)
+
+	// Track crawl statistics
+	stats := &crawlStats{}
+	skipped := newSkipLog(logger, opts.Debug)
+	manifest := newCrawlManifest(time.Now())
+
+	// Handle errors, retrying transient failures
+	retry := newRetryPolicy(opts.Retries, 1*time.Second)
+	// adapt feeds a response's status and timing to the adaptive delay
+	adapt := func(r *colly.Response) {
+		if adaptive == nil {
+			return
+		}
+		var elapsed time.Duration
+		if r.Trace != nil {
+			elapsed = r.Trace.FirstByteDuration
+		}
+		if delay, slower := adaptive.observe(r.StatusCode, elapsed); slower {
+			logger.Printf("Slowing down to one request every %s\n", delay)
+		}
+	}
+	// Retries wait out their delay off colly's workers; retried counts the
+	// ones sent, so the crawl can tell when none is left to wait for
+	var retries sync.WaitGroup
+	var retried atomic.Int64
+	c.OnError(func(r *colly.Response, err error) {
+		adapt(r)
+		stats.recordError()
+		manifest.recordError(r.Request.URL.String(), r.StatusCode, err)
+		logger.Printf("Error scraping %s: %v\n", r.Request.URL, err)
+
+		// A URL stays queued while it waits for a retry, so a crawl cut
+		// short in the meantime fetches it again on resume
+		delay, ok := retry.next(r)
+		if !ok {
+			queued.done(r.Request.URL.String())
+			return
+		}
+		logger.Printf("Retrying %s in %s\n", r.Request.URL, delay)
+		retries.Add(1)
+		resend := func() {
+			defer retries.Done()
+			select {
+			case <-time.After(delay):
+				retried.Add(1)
+				if r.Request.Retry() != nil {
+					queued.done(r.Request.URL.String())
+				}
+			case <-ctx.Done():
+			}
+		}
+		// A deterministic crawl is sequential, so it retries in place
+		if c.Async {
+			go resend()
+		} else {
+			resend()
+		}
+	})
+
+	// Record redirects so pages are deduplicated by their final URL
+	c.SetRedirectHandler(func(req *http.Request, via []*http.Request) error {
+		// Keep Go's default limit of 10 redirects
+		if len(via) >= 10 {
+			return http.ErrUseLastResponse
+		}
+		from := via[len(via)-1].URL.String()
+		logger.Printf("Redirected %s -> %s\n", from, req.URL)
+		stats.recordRedirect()
+		visited.redirect(from, req.URL.String())
+		queued.move(from, req.URL.String())
+
+		// Drop credentials when the redirect leaves the host
+		if req.URL.Host != via[len(via)-1].URL.Host {
+			req.Header.Del("Authorization")
+		}
+		return nil
+	})
+
+	c.OnResponse(func(r *colly.Response) {
+		var elapsed time.Duration
+		if r.Trace != nil {
+			elapsed = r.Trace.FirstByteDuration
+		}
+		stats.recordResponse(len(r.Body), elapsed)
+		adapt(r)
+		manifest.recordStatus(r.Request.URL.String(), r.StatusCode)
+		queued.done(r.Request.URL.String())
+		if !strings.Contains(strings.ToLower(r.Headers.Get("Content-Type")), "html") && !isMarkdownResponse(r) {
+			skipped.skip(r.Request.URL.String(), skipNonHTML)
+		}
+	})
+
+	// Create mutex for thread-safe operations
+	var mu sync.Mutex
+
+	// Before making a request print "Visiting ..."
+	c.OnRequest(func(r *colly.Request) {
+		// Stop issuing new requests once the overall deadline has passed
+		if ctx.Err() != nil {
+			r.Abort()
+			return
+		}
+		if adaptive != nil {
+			adaptive.wait(ctx)
+		}
+		stats.recordRequest()
+		logger.Printf("Visiting %s\n", r.URL.String())
+	})
+
+	// notify runs the hooks for the nth page of the document; mu must be held
+	notify := func(p Page, n int) {
+		if len(opts.onPageScraped) == 0 {
+			return
+		}
+		summary := stats.summary()
+		progress := CrawlProgress{Pages: n, Queued: queued.len(), Requests: summary.Requests, Errors: summary.Errors}
+		for _, hook := range opts.onPageScraped {
+			hook(p, progress)
+		}
+	}
+	// Pages that may still be pruned or rewritten after the crawl are
+	// only passed to the hooks once that is done
+	deferHooks := opts.ReachableFrom != "" || (opts.Dedupe && !opts.SummaryOnly)
+
+	// add appends a finished page to the document and runs the hooks; mu must be held
+	add := func(p Page) {
+		pages = append(pages, p)
+		if !deferHooks {
+			notify(p, len(pages))
+		}
+	}
+
+	// keep filters and redacts a page's extracted chapters, then adds them to the document
+	keep := func(resp *colly.Response, extracted []Page) {
+		// Drop pages that came out empty rather than adding blank chapters
+		if !opts.RenderEmptyPages && !opts.SummaryOnly {
+			kept := extracted[:0]
+			for _, p := range extracted {
+				if p.isEmpty() {
+					logger.Printf("Skipping %s: no content extracted\n", p.URL)
+					continue
+				}
+				kept = append(kept, p)
+			}
+			extracted = kept
+		}
+
+		// Skip pages older than -modified-since, but still follow their links
+		if !opts.Since.IsZero() && len(extracted) > 0 {
+			changed, dated := pageDate(resp, extracted[0].Metadata)
+			if lastMod, ok := sitemapDates.Load(resp.Request.URL.String()); ok && !dated {
+				changed, dated = lastMod.(time.Time), true
+			}
+			if (dated && changed.Before(opts.Since)) || (!dated && !opts.IncludeUndated) {
+				logger.Printf("Skipping %s: not modified since %s\n", resp.Request.URL, modifiedSince)
+				extracted = nil
+			}
+		}
+		for i := range extracted {
+			if opts.ContentFilterCmd != "" && !opts.SummaryOnly {
+				filtered, filterErr := filterContent(ctx, opts.ContentFilterCmd, extracted[i])
+				if filterErr != nil {
+					logger.Printf("Warning: -content-filter-cmd failed for %s, keeping its original content: %v\n", extracted[i].URL, filterErr)
+				} else {
+					extracted[i].Content = filtered
+				}
+			}
+			if opts.Redact != nil {
+				opts.Redact.apply(&extracted[i])
+			}
+			extracted[i].Checksum = contentHash(extracted[i])
+		}
+
+		mu.Lock()
+		for _, p := range extracted {
+			add(p)
+		}
+		mu.Unlock()
+	}
+
+	// follow visits the distinct links found on req's page, reporting
+	// whether the crawl was interrupted before they were all queued.
+	// Pagination links are at the depth of the page they continue.
+	follow := func(req *colly.Request, found []string, pagination bool) (interrupted bool) {
+		depth := crawlDepth(req) + 1
+		if pagination {
+			sameDepth := *req
+			sameDepth.Depth--
+			req, depth = &sameDepth, depth-1
+		}
+		for _, link := range found {
+			if ctx.Err() != nil {
+				return true
+			}
+			if opts.SitemapOnly {
+				skipped.skip(link, skipSitemapOnly)
+				continue
+			}
+			if isExcluded(opts.Exclude, link) {
+				skipped.skip(link, skipExcluded)
+				continue
+			}
+			if visited.has(link) {
+				skipped.skip(link, skipVisited)
+				continue
+			}
+			if limit := depthLimit(opts.Sections, link, opts.MaxDepth); limit > 0 && depth > limit {
+				skipped.skip(link, skipDepth)
+				continue
+			}
+			if queries != nil {
+				if ok, limitReached := queries.allow(link); !ok {
+					if limitReached {
+						logger.Printf("Skipping further query variants of %s: limit of %d reached\n", link, opts.MaxQueryVariants)
+					}
+					skipped.skip(link, skipQueryLimit)
+					continue
+				}
+			}
+			queued.queue(link, depth)
+			if req.Visit(link) != nil {
+				queued.done(link)
+			}
+		}
+		return false
+	}
+
+	// On every page
+	c.OnHTML("html", func(page *colly.HTMLElement) {
+		currentURL := page.Request.URL.String()
+		// Claim the URL up front so each page is extracted exactly once
+		if !visited.claim(currentURL) {
+			return
+		}
+
+		// Keep math as its LaTeX source rather than a jumble of symbols
+		preserveMath(page.DOM)
+
+		// Find the content containers, falling back when none matches
+		var containers *goquery.Selection
+		if opts.Readability {
+			containers = readableContent(page.DOM)
+		}
+		if containers == nil || containers.Length() == 0 {
+			switch {
+			case opts.ContentXPath != nil && opts.ContentMinWords > 0:
+				containers = richestContainer(xpathElements(page.DOM, opts.ContentXPath), opts.ContentMinWords)
+			case opts.ContentXPath != nil:
+				containers = findXPathContainers(page.DOM, opts.ContentXPath)
+			case opts.ContentMinWords > 0:
+				// Weigh every match of every selector, not just the first selector's
+				containers = richestContainer(page.DOM.Find(strings.Join(opts.ContentSelectors, ", ")), opts.ContentMinWords)
+			default:
+				containers = findContainers(page.DOM, opts.ContentSelectors)
+			}
+		}
+		if containers.Length() == 0 && opts.FallbackSelector != "" {
+			containers = page.DOM.Find(opts.FallbackSelector).First()
+			if containers.Length() > 0 && opts.StripBoilerplate {
+				containers = containers.Clone()
+				boilerplate := containers.Find(boilerplateSelector)
+				// Asides read as notes are content, not chrome
+				if extractOpts.Asides == "note" {
+					boilerplate = boilerplate.Not("aside")
+				}
+				boilerplate.Remove()
+			}
+		}
+		if containers.Length() == 0 {
+			return
+		}
+		if extractOpts.MultiContainer == "first" {
+			containers = containers.First()
+		}
+		e := colly.NewHTMLElementFromSelectionNode(page.Response, containers, containers.Nodes[0], 0)
+
+		// Narrow extraction to the requested section; links are still
+		// followed from the whole container
+		content := containers
+		if anchor := anchorFor(opts.SectionAnchors, page.Request.URL); anchor != "" {
+			content = sectionContent(containers, anchor)
+			if content == nil {
+				logger.Printf("Skipping %s: no #%s section\n", currentURL, anchor)
+			}
+		}
+
+		// Abandon pages whose extraction overruns the budget, but still follow their links
+		var extracted []Page
+		if content != nil {
+			var ok bool
+			extracted, ok = extractWithin(extractOpts, opts.PageTimeout, func(eo extractOptions) []Page {
+				return extractPages(page, content, extractor, eo)
+			})
+			// Pages cut short by the crawl's own timeout are dropped quietly,
+			// and fetched again on resume
+			switch {
+			case !ok && ctx.Err() != nil:
+				queued.queue(currentURL, crawlDepth(page.Request))
+			case !ok:
+				logger.Printf("Warning: extracting %s took longer than %ds, skipping it\n", currentURL, int(opts.PageTimeout.Seconds()))
+			}
+		}
+
+		// Text held in bare divs and the like rather than paragraphs, as on
+		// pages without a content container, is read as it is
+		for i := range extracted {
+			if extracted[i].isEmpty() && !opts.SummaryOnly {
+				extracted[i].Content = bareText(content)
+			}
+		}
+
+		keep(page.Response, extracted)
+
+		// Gather the page's links first, so each distinct URL is checked
+		// and visited once however often the page repeats it
+		var found []string
+		discovered, interrupted := pageLinks(ctx, page, e, opts.LinkSources, normalize)
+		for _, l := range discovered {
+			if !followsRel(l.Rel, opts.FollowNofollow) {
+				skipped.skip(l.URL, skipNofollow)
+				continue
+			}
+			if skipped.scope(l.URL, domains) {
+				found = append(found, l.URL)
+				links.add(currentURL, l.URL)
+			}
+		}
+
+		// Visit the new links
+		if !interrupted {
+			interrupted = follow(e.Request, found, false)
+		}
+		// A page whose links weren't all followed is fetched again on resume
+		if interrupted {
+			queued.queue(currentURL, crawlDepth(page.Request))
+		}
+
+		// Follow pagination without counting it against the crawl depth
+		if opts.FollowNext && !opts.SitemapOnly && !interrupted {
+			var next []string
+			for _, l := range paginationLinks(page, opts.NextAttrs) {
+				link := normalize(page.Request.AbsoluteURL(l.URL))
+				if !isCrawlable(link, domains) {
+					continue
+				}
+				links.add(currentURL, link)
+				if !followsRel(l.Rel, opts.FollowNofollow) {
+					skipped.skip(link, skipNofollow)
+					continue
+				}
+				next = append(next, link)
+			}
+			if follow(page.Request, next, true) {
+				queued.queue(currentURL, crawlDepth(page.Request))
+			}
+		}
+	})
+
+	// Servers that send raw Markdown get it parsed directly instead of CSS extraction
+	c.OnResponse(func(r *colly.Response) {
+		currentURL := r.Request.URL.String()
+		if !isMarkdownResponse(r) || !visited.claim(currentURL) {
+			return
+		}
+		p := extractMarkdown(r, extractOpts)
+		p.URL = currentURL
+		p.Depth = crawlDepth(r.Request) - 1
+		keep(r, []Page{p})
+
+		var found []string
+		seen := make(map[string]bool)
+		for _, l := range p.Links {
+			link := normalize(l.URL)
+			if seen[link] {
+				continue
+			}
+			seen[link] = true
+			if skipped.scope(link, domains) {
+				found = append(found, link)
+				links.add(currentURL, link)
+			}
+		}
+		if follow(r.Request, found, false) {
+			queued.queue(currentURL, crawlDepth(r.Request))
+		}
+	})
+
+	// Create a channel to signal completion
+	done := make(chan bool)
+
+	// Start a goroutine to check for timeout
+	go func() {
+		select {
+		case <-ctx.Done():
+			if ctx.Err() == context.DeadlineExceeded {
+				logger.Printf("\nScraping timed out after %d seconds. Processing collected pages...\n", int(opts.Timeout.Seconds()))
+			}
+		case <-done:
+			return
+		}
+	}()
+
+	// Pages scraped by earlier runs come first, as they did in those runs
+	mu.Lock()
+	for _, p := range resumed.Pages {
+		add(p)
+	}
+	mu.Unlock()
+
+	// Start scraping, unless a resumed crawl already got past the base URL
+	// or only the sitemap's pages are wanted
+	if !visited.has(baseURL) && !opts.SitemapOnly {
+		queued.queue(baseURL, 1)
+		if err := c.Visit(baseURL); err != nil {
+			queued.done(baseURL)
+			if len(pages) == 0 && opts.Sitemap == "" && len(resumed.Pending) == 0 {
+				return nil, fmt.Errorf("no pages were scraped: %w", err)
+			}
+			logger.Printf("Error visiting base URL: %v\n", err)
+		}
+	}
+
+	// Pick up the URLs left queued by the previous run at their original depth
+	for _, p := range resumed.Pending {
+		if isExcluded(opts.Exclude, p.URL) {
+			skipped.skip(p.URL, skipExcluded)
+			continue
+		}
+		reqCtx := colly.NewContext()
+		reqCtx.Put(depthOffsetKey, strconv.Itoa(p.Depth-1))
+		queued.queue(p.URL, p.Depth)
+		if c.Request("GET", p.URL, nil, reqCtx, nil) != nil {
+			queued.done(p.URL)
+		}
+	}
+
+	// Seed the crawl from the sitemap, skipping pages whose lastmod shows
+	// they have not changed since -modified-since
+	var sitemaps []string
+	switch {
+	case opts.Sitemap == "auto" || (opts.SitemapOnly && opts.Sitemap == ""):
+		// Sitemaps advertised in robots.txt, else the conventional location
+		sitemaps = robots.Sitemaps
+		if len(sitemaps) == 0 {
+			sitemaps = []string{parsedURL.Scheme + "://" + parsedURL.Host + "/sitemap.xml"}
+		}
+		if opts.SitemapOnly {
+			logger.Printf("Crawling only the pages in %s\n", strings.Join(sitemaps, ", "))
+		} else {
+			logger.Printf("Seeding from %s\n", strings.Join(sitemaps, ", "))
+		}
+	case opts.Sitemap != "":
+		sitemaps = []string{opts.Sitemap}
+	}
+	for _, sitemap := range sitemaps {
+		entries, sitemapErr := fetchSitemap(client, logger, sitemap)
+		if sitemapErr != nil {
+			logger.Printf("Failed to read sitemap %s: %v\n", sitemap, sitemapErr)
+		}
+		for _, entry := range entries {
+			entry.Loc = normalize(entry.Loc)
+			if !isCrawlable(entry.Loc, domains) {
+				continue
+			}
+			if isExcluded(opts.Exclude, entry.Loc) {
+				skipped.skip(entry.Loc, skipExcluded)
+				continue
+			}
+			if !entry.LastMod.IsZero() {
+				sitemapDates.Store(entry.Loc, entry.LastMod)
+				if !opts.Since.IsZero() && entry.LastMod.Before(opts.Since) {
+					logger.Printf("Skipping %s: not modified since %s (sitemap)\n", entry.Loc, modifiedSince)
+					continue
+				}
+			}
+			queued.queue(entry.Loc, 1)
+			if c.Visit(entry.Loc) != nil {
+				queued.done(entry.Loc)
+			}
+		}
+	}
+
+	// Wait for scraping to complete or timeout. A retry sent after colly
+	// went idle starts it again, so wait until a round sends none.
+	for {
+		sent := retried.Load()
+		c.Wait()
+		retries.Wait()
+		if retried.Load() == sent {
+			break
+		}
+	}
+	close(done)
+
+	if opts.Frontier != "" {
+		complete, frontierErr := queued.save(opts.Frontier, visited, pages, links)
+		switch {
+		case frontierErr != nil:
+			logger.Printf("Failed to save frontier: %v\n", frontierErr)
+		case complete:
+			logger.Println("Crawl complete, no queued URLs left to resume")
+		default:
+			logger.Printf("Saved queued URLs to %s; run again with the same -frontier to resume\n", opts.Frontier)
+		}
+	}
+
+	// Drop pages that no chain of links leads to from the seed
+	if opts.ReachableFrom != "" {
+		reachable := links.reachable(opts.ReachableFrom, visited.resolve)
+		kept := pages[:0]
+		for _, p := range pages {
+			if reachable[stripFragment(p.URL)] {
+				kept = append(kept, p)
+			} else {
+				logger.Printf("Skipping %s: not reachable from %s\n", p.URL, opts.ReachableFrom)
+			}
+		}
+		pages = kept
+	}
+
+	// Strip paragraphs repeated across the pages as boilerplate
+	if opts.Dedupe && !opts.SummaryOnly {
+		if n := dedupeBoilerplate(pages, opts.DedupeThreshold); n > 0 {
+			logger.Printf("Removed %d boilerplate paragraphs repeated across pages\n", n)
+		}
+	}
+
+	// Sort pages by URL to ensure consistent ordering. Deterministic crawls
+	// are sequential, so pages are already in discovery order unless
+	// another order was asked for.
+	mu.Lock()
+	switch {
+	case opts.SortBy == "breadcrumb":
+		sort.SliceStable(pages, func(i, j int) bool {
+			if c := compareBreadcrumbs(pages[i].Breadcrumb, pages[j].Breadcrumb); c != 0 {
+				return c < 0
+			}
+			return pages[i].URL < pages[j].URL
+		})
+	case !opts.Deterministic || opts.SummaryOnly:
+		sort.Slice(pages, func(i, j int) bool {
+			return pages[i].URL < pages[j].URL
+		})
+	}
+	if deferHooks {
+		for i, p := range pages {
+			notify(p, i+1)
+		}
+	}
+	mu.Unlock()
+
+	logger.Printf("\nScraped %d pages successfully.\n", len(pages))
+
+	summary := stats.summary()
+	summary.Print(logger)
+	skipped.Print()
+	if opts.StatsJSON != "" {
+		if statsErr := summary.WriteJSON(opts.StatsJSON); statsErr != nil {
+			logger.Printf("Failed to write stats file: %v\n", statsErr)
+		}
+	}
+	if opts.BrokenLinks != "" {
+		broken := brokenLinks(manifest, links, visited.resolve)
+		printBrokenLinks(logger, broken)
+		if reportErr := writeBrokenLinks(opts.BrokenLinks, broken); reportErr != nil {
+			logger.Printf("Failed to write broken links report: %v\n", reportErr)
+		}
+	}
+	if opts.Manifest != "" {
+		if manifestErr := manifest.build(baseURL, opts.ManifestOptions, pages, summary).WriteJSON(opts.Manifest); manifestErr != nil {
+			logger.Printf("Failed to write manifest: %v\n", manifestErr)
+		}
+	}
+	return pages, crawlErrors(manifest)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderEmptyPages(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":      htmlPage("Home", `<p>Start here.</p><a href="/empty">Empty</a> <a href="/full">Full</a>`),
+		"/empty": `<html><head><title>Empty</title></head><body><article><div class="spacer"></div></article></body></html>`,
+		"/full":  htmlPage("Full", `<p>Some text.</p>`),
+	})
+	for _, tc := range []struct {
+		render bool
+		want   string
+	}{
+		{false, "/ /full"},
+		{true, "/ /empty /full"},
+	} {
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.RenderEmptyPages = tc.render
+		pages, out, err := crawlLogged(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(pageURLs(pages, srv.URL), " "); got != tc.want {
+			t.Errorf("-render-empty-pages=%t: got pages %s, want %s", tc.render, got, tc.want)
+		}
+		if skipped := strings.Contains(out, "/empty: no content extracted"); skipped == tc.render {
+			t.Errorf("-render-empty-pages=%t: skip reported %t:\n%s", tc.render, skipped, out)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// sectionAnchor limits extraction to the section at an anchor, on every
+// page or, when Path is set, only on the page with that URL path.
+type sectionAnchor struct {
+	Path   string
+	Anchor string
+}
+
+// parseSectionAnchors parses -section-anchor values: "configuration" for
+// every page, or "/docs/setup.html#configuration" for a single page.
+func parseSectionAnchors(values []string) ([]sectionAnchor, error) {
+	var anchors []sectionAnchor
+	for _, value := range values {
+		path, anchor, found := strings.Cut(value, "#")
+		if !found {
+			path, anchor = "", value
+		}
+		if anchor == "" || (found && !strings.HasPrefix(path, "/")) {
+			return nil, fmt.Errorf("invalid -section-anchor %q: expected anchor or /path#anchor", value)
+		}
+		anchors = append(anchors, sectionAnchor{Path: path, Anchor: anchor})
+	}
+	return anchors, nil
+}
+
+// anchorFor returns the anchor whose section is extracted from the page at
+// u, preferring a rule for its path over a global one, or "" for the whole page.
+func anchorFor(anchors []sectionAnchor, u *url.URL) string {
+	anchor := ""
+	for _, a := range anchors {
+		switch a.Path {
+		case u.Path:
+			return a.Anchor
+		case "":
+			if anchor == "" {
+				anchor = a.Anchor
+			}
+		}
+	}
+	return anchor
+}
+
+// headingLevels maps heading element names to their levels.
+var headingLevels = map[string]int{"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6}
+
+// sectionContent returns a copy of the section of containers at anchor,
+// found by id or by <a name>. For a heading, or an anchor inside one, that
+// is the heading and its following siblings up to the next heading of the
+// same or a higher level; any other element is taken whole. It returns
+// nil when the anchor is not there.
+func sectionContent(containers *goquery.Selection, anchor string) *goquery.Selection {
+	target := containers.Find("[id]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+		return s.AttrOr("id", "") == anchor
+	}).First()
+	if target.Length() == 0 {
+		target = containers.Find("a[name]").FilterFunction(func(_ int, s *goquery.Selection) bool {
+			return s.AttrOr("name", "") == anchor
+		}).First()
+	}
+	if target.Length() == 0 {
+		return nil
+	}
+
+	section := target
+	heading := target.Closest("h1, h2, h3, h4, h5, h6")
+	if heading.Length() == 0 && goquery.NodeName(target) == "a" {
+		// An empty <a name> placed just before its heading
+		heading = target.Next().Filter("h1, h2, h3, h4, h5, h6")
+	}
+	if heading.Length() > 0 {
+		level := headingLevels[goquery.NodeName(heading)]
+		section = heading
+		for next := heading.Next(); next.Length() > 0; next = next.Next() {
+			if l, ok := headingLevels[goquery.NodeName(next)]; ok && l <= level {
+				break
+			}
+			section = section.AddSelection(next)
+		}
+	}
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader("<div></div>"))
+	if err != nil {
+		return nil
+	}
+	wrapper := doc.Find("div")
+	wrapper.AppendSelection(section.Clone())
+	return wrapper
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSectionAnchor(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/setup": htmlPage("Setup", `<h2 id="install">Install</h2><p>Download it.</p>
+			<h2 id="configuration">Configuration</h2><p>Edit the config file.</p>
+			<h3>Environment</h3><p>Or set variables.</p>
+			<h2 id="troubleshooting">Troubleshooting</h2><p>Read the logs.</p>
+			<a href="/usage">Usage</a>`),
+		"/usage": htmlPage("Usage", `<p>Run it.</p><a name="flags"></a><h3>Flags</h3><p>Pass -v.</p><h3>Exit codes</h3><p>0 is success.</p>`),
+	})
+	anchors, err := parseSectionAnchors([]string{"configuration", "/usage#flags"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := testCrawlOptions(srv.URL + "/setup")
+	opts.SectionAnchors = anchors
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/setup /usage" {
+		t.Fatalf("crawled %s, want /setup /usage: links outside the section are still followed", got)
+	}
+
+	for _, tc := range []struct {
+		page      Page
+		want, not []string
+	}{
+		{pages[0], []string{"Edit the config file.", "Or set variables."}, []string{"Download it.", "Read the logs."}},
+		{pages[1], []string{"Pass -v."}, []string{"Run it.", "0 is success."}},
+	} {
+		for _, text := range tc.want {
+			if !strings.Contains(tc.page.Content, text) {
+				t.Errorf("%s: section content lacks %q:\n%s", tc.page.URL, text, tc.page.Content)
+			}
+		}
+		for _, text := range tc.not {
+			if strings.Contains(tc.page.Content, text) {
+				t.Errorf("%s: content outside the section captured, %q:\n%s", tc.page.URL, text, tc.page.Content)
+			}
+		}
+	}
+	var headings []string
+	for _, h := range pages[0].Headings {
+		headings = append(headings, h.Text)
+	}
+	if got := strings.Join(headings, ", "); got != "Configuration, Environment" {
+		t.Errorf("section headings %s, want Configuration, Environment", got)
+	}
+
+	if _, err := parseSectionAnchors([]string{"usage#flags"}); err == nil {
+		t.Error("-section-anchor with a relative path accepted")
+	}
+}
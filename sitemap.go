@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxSitemapBytes bounds the size of a single downloaded sitemap.
+const maxSitemapBytes = 50 << 20
+
+// maxSitemapNesting bounds how deep sitemap indexes are followed.
+const maxSitemapNesting = 3
+
+// sitemapEntry is a page listed in a sitemap.
+type sitemapEntry struct {
+	Loc     string
+	LastMod time.Time // zero when the sitemap gives no usable <lastmod>
+}
+
+// sitemapDoc covers both <urlset> sitemaps and <sitemapindex> indexes.
+type sitemapDoc struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+	Sitemaps []struct {
+		Loc string `xml:"loc"`
+	} `xml:"sitemap"`
+}
+
+// fetchSitemap downloads a sitemap and returns the pages it lists,
+// following nested sitemap indexes.
+func fetchSitemap(client *http.Client, logger *log.Logger, sitemapURL string) ([]sitemapEntry, error) {
+	return fetchSitemapNested(client, logger, sitemapURL, 0)
+}
+
+func fetchSitemapNested(client *http.Client, logger *log.Logger, sitemapURL string, nesting int) ([]sitemapEntry, error) {
+	resp, err := client.Get(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s for %s", resp.Status, sitemapURL)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxSitemapBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	var doc sitemapDoc
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid sitemap %s: %w", sitemapURL, err)
+	}
+
+	var entries []sitemapEntry
+	for _, u := range doc.URLs {
+		loc := strings.TrimSpace(u.Loc)
+		if loc == "" {
+			continue
+		}
+		lastMod, _ := parseDate(strings.TrimSpace(u.LastMod))
+		entries = append(entries, sitemapEntry{Loc: loc, LastMod: lastMod})
+	}
+	if nesting < maxSitemapNesting {
+		for _, s := range doc.Sitemaps {
+			nested, err := fetchSitemapNested(client, logger, strings.TrimSpace(s.Loc), nesting+1)
+			if err != nil {
+				logger.Printf("Skipping sitemap %s: %v\n", s.Loc, err)
+				continue
+			}
+			entries = append(entries, nested...)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSitemapLastModSkipsUnchangedPages(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/":       htmlPage("Home", `<p>Start here.</p>`),
+		"/recent": htmlPage("Recent", `<p>Updated last week.</p>`),
+		"/old":    htmlPage("Old", `<p>Unchanged for a year.</p>`),
+		"/older":  htmlPage("Older", `<p>Unchanged for longer.</p>`),
+	})
+	var mu sync.Mutex
+	var fetched []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/sitemap.xml" {
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + srv.URL + `/recent</loc><lastmod>2024-06-01</lastmod></url>
+  <url><loc>` + srv.URL + `/old</loc><lastmod>2023-05-01T10:00:00+00:00</lastmod></url>
+  <url><loc>` + srv.URL + `/older</loc><lastmod>2021-01-01</lastmod></url>
+</urlset>`))
+			return
+		}
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Sitemap = srv.URL + "/sitemap.xml"
+	opts.SitemapOnly = true
+	opts.Since = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/recent" {
+		t.Errorf("crawl returned pages %s, want /recent", got)
+	}
+	for _, path := range []string{"/old", "/older"} {
+		if slices.Contains(fetched, path) {
+			t.Errorf("%s was fetched although its lastmod is before -modified-since", path)
+		}
+	}
+}
+
+func TestCrawlOnlySitemap(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/c">C</a>`),
+		"/a": htmlPage("Page A", `<p>Page A.</p><a href="/c">C</a>`),
+		"/b": htmlPage("Page B", `<p>Page B.</p><a rel="next" href="/d">Next</a> <link rel="prev" href="/e">`),
+		"/c": htmlPage("Page C", `<p>Only linked.</p>`),
+		"/d": htmlPage("Page D", `<p>Only linked.</p>`),
+	})
+	var mu sync.Mutex
+	var fetched []string
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("User-agent: *\nSitemap: " + srv.URL + "/maps/site.xml\n"))
+		case "/maps/site.xml":
+			w.Header().Set("Content-Type", "application/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc>` + srv.URL + `/a</loc></url>
+  <url><loc>` + srv.URL + `/b</loc></url>
+</urlset>`))
+		default:
+			site.Config.Handler.ServeHTTP(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// The sitemap is found through robots.txt when none is given
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.SitemapOnly = true
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/a /b" {
+		t.Errorf("-crawl-only-sitemap returned pages %s, want /a /b", got)
+	}
+	slices.Sort(fetched)
+	if got := strings.Join(fetched, " "); got != "/a /b /maps/site.xml /robots.txt" {
+		t.Errorf("-crawl-only-sitemap fetched %s, want only robots.txt, the sitemap and its pages", got)
+	}
+}
+
+func TestSitemapFromRobots(t *testing.T) {
+	urlset := func(locs ...string) string {
+		xml := `<?xml version="1.0" encoding="UTF-8"?><urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`
+		for _, loc := range locs {
+			xml += "<url><loc>" + loc + "</loc></url>"
+		}
+		return xml + "</urlset>"
+	}
+	site := testSite(t, map[string]string{
+		"/":        htmlPage("Home", `<p>Start here.</p><a href="/linked">Linked</a>`),
+		"/linked":  htmlPage("Linked", `<p>Linked from home.</p>`),
+		"/orphan1": htmlPage("Orphan 1", `<p>Only in a sitemap.</p>`),
+		"/orphan2": htmlPage("Orphan 2", `<p>Only in a sitemap.</p>`),
+		"/never":   htmlPage("Never", `<p>Only in the unadvertised sitemap.</p>`),
+	})
+	for _, advertise := range []bool{true, false} {
+		var srv *httptest.Server
+		srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/robots.txt":
+				if advertise {
+					w.Write([]byte("Sitemap: " + srv.URL + "/maps/one.xml\n\nUser-agent: *\nDisallow: /private\nSitemap: " + srv.URL + "/maps/two.xml\n"))
+				}
+			case "/maps/one.xml":
+				w.Write([]byte(urlset(srv.URL + "/orphan1")))
+			case "/maps/two.xml":
+				w.Write([]byte(urlset(srv.URL+"/orphan2", "https://elsewhere.example/page")))
+			case "/sitemap.xml":
+				w.Write([]byte(urlset(srv.URL + "/never")))
+			default:
+				site.Config.Handler.ServeHTTP(w, r)
+			}
+		}))
+		defer srv.Close()
+
+		opts := testCrawlOptions(srv.URL + "/")
+		opts.Sitemap = "auto"
+		pages, err := Crawl(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "/ /linked /orphan1 /orphan2"
+		if !advertise {
+			// Without Sitemap lines the conventional location is read
+			want = "/ /linked /never"
+		}
+		got := pageURLs(pages, srv.URL)
+		slices.Sort(got)
+		if strings.Join(got, " ") != want {
+			t.Errorf("robots.txt advertising sitemaps %t: crawled %s, want %s", advertise, strings.Join(got, " "), want)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"sort"
+	"sync"
+)
+
+// Reasons a discovered URL is not fetched or not extracted.
+const (
+	skipExternal    = "external"           // host outside the crawled domain
+	skipScheme      = "unsupported-scheme" // not http or https, e.g. mailto:
+	skipNofollow    = "nofollow"           // rel="nofollow" without -follow-nofollow
+	skipExcluded    = "excluded"           // matches an -exclude pattern
+	skipVisited     = "visited"            // already fetched or queued
+	skipDepth       = "depth"              // beyond -depth or its -section-depth
+	skipQueryLimit  = "query-limit"        // over -max-query-variants
+	skipNonHTML     = "non-html"           // response was neither HTML nor Markdown
+	skipSitemapOnly = "sitemap-only"       // links are not followed with -crawl-only-sitemap
+)
+
+// skipLog records skipped URLs by reason. With debug set each URL is
+// logged the first time it is skipped for a reason; repeats, such as a
+// navigation link seen on every page, are only counted once. It is safe
+// for concurrent use.
+type skipLog struct {
+	logger *log.Logger
+	debug  bool
+	mu     sync.Mutex
+	seen   map[string]bool // reason + " " + URL
+	counts map[string]int  // distinct URLs per reason
+}
+
+func newSkipLog(logger *log.Logger, debug bool) *skipLog {
+	return &skipLog{logger: logger, debug: debug, seen: make(map[string]bool), counts: make(map[string]int)}
+}
+
+func (l *skipLog) skip(u, reason string) {
+	if !l.debug {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := reason + " " + u
+	if l.seen[key] {
+		return
+	}
+	l.seen[key] = true
+	l.counts[reason]++
+	l.logger.Printf("[debug] Skipped %s: %s\n", u, reason)
+}
+
+// scope reports whether link is on a crawled domain, recording why not.
+func (l *skipLog) scope(link string, domains []string) bool {
+	if isCrawlable(link, domains) {
+		return true
+	}
+	if u, err := url.Parse(link); err == nil && u.Scheme != "http" && u.Scheme != "https" {
+		l.skip(link, skipScheme)
+	} else {
+		l.skip(link, skipExternal)
+	}
+	return false
+}
+
+// Print logs the number of distinct URLs skipped for each reason.
+func (l *skipLog) Print() {
+	if !l.debug {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	reasons := make([]string, 0, len(l.counts))
+	for reason := range l.counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	l.logger.Println("\nSkipped URLs:")
+	if len(reasons) == 0 {
+		l.logger.Println("  none")
+	}
+	for _, reason := range reasons {
+		l.logger.Printf("  %-20s %d\n", reason+":", l.counts[reason])
+	}
+}
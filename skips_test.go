@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// crawlLogged runs Crawl with a logger and returns what it logged along
+// with its result.
+func crawlLogged(opts CrawlOptions, options ...CrawlOption) (pages []Page, logged string, err error) {
+	var buf bytes.Buffer
+	pages, err = Crawl(opts, append(options, WithLogger(log.New(&buf, "", 0)))...)
+	return pages, buf.String(), err
+}
+
+func TestDebugLogsSkippedURLs(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/": htmlPage("Home", `<p>Start here.</p><a href="/docs">Docs</a> <a href="/private" rel="nofollow">Private</a>
+			<a href="mailto:me@example.com">Mail</a> <a href="https://elsewhere.example/">Elsewhere</a> <a href="/">Home</a>`),
+		"/docs":      htmlPage("Docs", `<p>Docs.</p><a href="/private" rel="nofollow">Private</a> <a href="/">Home</a> <a href="/docs/deep">Deep</a>`),
+		"/docs/deep": htmlPage("Deep", `<p>Too deep.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Debug = true
+	crawlOutput := func() string {
+		_, out, err := crawlLogged(opts)
+		if err != nil {
+			t.Error(err)
+		}
+		return out
+	}
+
+	out := crawlOutput()
+	for _, line := range []string{
+		"[debug] Skipped " + srv.URL + "/private: nofollow\n",
+		"[debug] Skipped mailto:me@example.com: unsupported-scheme\n",
+		"[debug] Skipped https://elsewhere.example/: external\n",
+		"[debug] Skipped " + srv.URL + "/: visited\n",
+		"[debug] Skipped " + srv.URL + "/docs/deep: depth\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output lacks %q:\n%s", line, out)
+		}
+	}
+	// Links repeated on every page are logged and counted once
+	for _, link := range []string{"/private: nofollow", "/: visited"} {
+		if n := strings.Count(out, srv.URL+link); n != 1 {
+			t.Errorf("%s logged %d times, want once", link, n)
+		}
+	}
+	if !regexp.MustCompile(`\n  nofollow: +1\n`).MatchString(out) {
+		t.Errorf("summary lacks a count of 1 nofollow URL:\n%s", out)
+	}
+
+	// Without -debug nothing is logged
+	opts.Debug = false
+	if out := crawlOutput(); strings.Contains(out, "[debug]") || strings.Contains(out, "Skipped URLs:") {
+		t.Errorf("crawl without -debug logged skipped URLs:\n%s", out)
+	}
+}
+
+func TestDebugLogsExcludedURLs(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":          htmlPage("Home", `<p>Start here.</p><a href="/docs">Docs</a> <a href="/blog/1">Post</a> <a href="/blog/2">Post</a> <a href="mailto:me@example.com">Mail</a>`),
+		"/docs":      htmlPage("Docs", `<p>Docs.</p><a href="/blog/1">Post</a> <a href="/">Home</a>`),
+		"/blog/1":    htmlPage("Post 1", `<p>Post.</p>`),
+		"/blog/2":    htmlPage("Post 2", `<p>Post.</p>`),
+		"/blog/feed": htmlPage("Feed", `<p>Feed.</p>`),
+	})
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Debug = true
+	opts.Exclude = []*regexp.Regexp{regexp.MustCompile(`/blog/`)}
+
+	pages, out, err := crawlLogged(opts)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if got := strings.Join(pageURLs(pages, srv.URL), " "); got != "/ /docs" {
+		t.Errorf("crawl returned %s, want / /docs", got)
+	}
+	for _, line := range []string{
+		"[debug] Skipped " + srv.URL + "/blog/1: excluded\n",
+		"[debug] Skipped " + srv.URL + "/blog/2: excluded\n",
+		"[debug] Skipped mailto:me@example.com: unsupported-scheme\n",
+		"[debug] Skipped " + srv.URL + "/: visited\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("output lacks %q", line)
+		}
+	}
+	// /blog/1 is linked twice but logged and counted once
+	if n := strings.Count(out, "/blog/1: excluded"); n != 1 {
+		t.Errorf("/blog/1 logged %d times, want once", n)
+	}
+	if !regexp.MustCompile(`\n  excluded: +2\n`).MatchString(out) {
+		t.Errorf("summary lacks a count of 2 excluded URLs:\n%s", out)
+	}
+}
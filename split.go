@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// pdfPart is one of the PDFs a split bundle is written as.
+type pdfPart struct {
+	Title string
+	Path  string
+	Pages []Page
+}
+
+// splitPages divides the pages into numbered parts written next to output.
+// by is "section" to start a part for each top-level path segment below
+// base, or a number of chapters per part. Pages keep their order, and a
+// section's pages are gathered into the part of its first page.
+func splitPages(pages []Page, by string, base *url.URL, output string) []pdfPart {
+	stem := strings.TrimSuffix(output, filepath.Ext(output))
+	var parts []pdfPart
+
+	if size, err := strconv.Atoi(by); err == nil {
+		for start := 0; start < len(pages); start += size {
+			n := len(parts) + 1
+			parts = append(parts, pdfPart{
+				Title: fmt.Sprintf("Part %d", n),
+				Path:  fmt.Sprintf("%s-%02d.pdf", stem, n),
+				Pages: pages[start:min(start+size, len(pages))],
+			})
+		}
+		return parts
+	}
+
+	prefix := base.Path
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix[:strings.LastIndex(prefix, "/")+1]
+	}
+	index := make(map[string]int)
+	for _, page := range pages {
+		section := "index"
+		if u, err := url.Parse(page.URL); err == nil {
+			rest := strings.TrimPrefix(u.Path, prefix)
+			if name, _, nested := strings.Cut(strings.TrimPrefix(rest, "/"), "/"); nested && name != "" {
+				section = name
+			}
+		}
+		i, ok := index[section]
+		if !ok {
+			i = len(parts)
+			index[section] = i
+			parts = append(parts, pdfPart{
+				Title: page.Title,
+				Path:  fmt.Sprintf("%s-%02d-%s.pdf", stem, i+1, slugify(section)),
+			})
+		}
+		parts[i].Pages = append(parts[i].Pages, page)
+	}
+	return parts
+}
+
+// writeMasterPDF saves a slim index of a split bundle to path, listing
+// each part and its chapters with links to the part's file. Links are
+// relative, so the bundle can be moved as long as its files stay together.
+func writeMasterPDF(parts []pdfPart, path string, opts pdfOptions) error {
+	var pages []Page
+	for _, part := range parts {
+		pages = append(pages, part.Pages...)
+	}
+	pdf, fonts, err := newPDF(pages, opts)
+	if err != nil {
+		return err
+	}
+
+	pdf.AddPage()
+	pdf.SetFont(fonts.Heading, "B", 24)
+	pdf.Cell(0, 10, opts.TOCTitle)
+	pdf.Ln(20)
+	left, _, _, _ := pdf.GetMargins()
+	for i, part := range parts {
+		file := filepath.Base(part.Path)
+		pdf.Bookmark(part.Title, 0, -1)
+		pdf.SetFont(fonts.Body, "B", 12)
+		pdf.SetX(left)
+		pdf.CellFormat(0, 10, fmt.Sprintf("%d. %s (%s)", i+1, part.Title, file), "", 1, "", false, 0, file)
+
+		pdf.SetFont(fonts.Body, "", 10)
+		for j, page := range part.Pages {
+			pdf.SetX(20)
+			pdf.CellFormat(0, 8, numberedTitle(page.Title, opts.Numbering, j+1), "", 1, "", false, 0, file)
+		}
+		pdf.Ln(5)
+	}
+	return pdf.OutputFileAndClose(path)
+}
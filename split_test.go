@@ -0,0 +1,67 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var pdfURIPattern = regexp.MustCompile(`/URI \(([^)]*)\)`)
+
+func TestSplitBySectionWithMasterIndex(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":        htmlPage("Home", `<p>Start here.</p><a href="/guide/a">Guide A</a> <a href="/api/x">API X</a> <a href="/guide/b">Guide B</a>`),
+		"/guide/a": htmlPage("Guide A", `<p>First guide.</p>`),
+		"/guide/b": htmlPage("Guide B", `<p>Second guide.</p>`),
+		"/api/x":   htmlPage("API X", `<p>An endpoint.</p>`),
+	})
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-output", "docs/bundle.pdf", "-split-by", "section", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	docs := filepath.Join(dir, "docs")
+	entries, err := os.ReadDir(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var files []string
+	for _, e := range entries {
+		files = append(files, e.Name())
+	}
+	want := []string{"bundle-01-index.pdf", "bundle-02-guide.pdf", "bundle-03-api.pdf", "bundle.pdf"}
+	if !slices.Equal(files, want) {
+		t.Fatalf("wrote %q, want %q", files, want)
+	}
+
+	master := readPDF(t, filepath.Join(docs, "bundle.pdf"))
+	var linked []string
+	for _, m := range pdfURIPattern.FindAllSubmatch(master.Raw, -1) {
+		if !slices.Contains(linked, string(m[1])) {
+			linked = append(linked, string(m[1]))
+		}
+	}
+	if !slices.Equal(linked, want[:3]) {
+		t.Errorf("master PDF links to %q, want each part file %q", linked, want[:3])
+	}
+	if text := master.AllText(); !strings.Contains(text, "Guide A") || !strings.Contains(text, "Guide B") || !strings.Contains(text, "API X") {
+		t.Errorf("master PDF does not list the chapters:\n%s", text)
+	}
+
+	for file, chapters := range map[string][]string{
+		"bundle-02-guide.pdf": {"Guide A", "Guide B"},
+		"bundle-03-api.pdf":   {"API X"},
+	} {
+		text := readPDF(t, filepath.Join(docs, file)).AllText()
+		for _, chapter := range chapters {
+			if !strings.Contains(text, chapter) {
+				t.Errorf("%s lacks chapter %s", file, chapter)
+			}
+		}
+		if strings.Contains(text, "Home") {
+			t.Errorf("%s holds the home page", file)
+		}
+	}
+}
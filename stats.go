@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// crawlStats collects operational metrics for a scraping run.
+type crawlStats struct {
+	mu        sync.Mutex
+	requests  int
+	responses int
+	bytes     int64
+	errors    int
+	redirects int
+	elapsed   time.Duration
+}
+
+// StatsSummary is the final snapshot of a run's metrics.
+type StatsSummary struct {
+	Requests          int     `json:"requests"`
+	Bytes             int64   `json:"bytes"`
+	Errors            int     `json:"errors"`
+	Redirects         int     `json:"redirects"`
+	AvgResponseTimeMs float64 `json:"avg_response_time_ms"`
+}
+
+func (s *crawlStats) recordRequest() {
+	s.mu.Lock()
+	s.requests++
+	s.mu.Unlock()
+}
+
+func (s *crawlStats) recordResponse(size int, elapsed time.Duration) {
+	s.mu.Lock()
+	s.responses++
+	s.bytes += int64(size)
+	s.elapsed += elapsed
+	s.mu.Unlock()
+}
+
+func (s *crawlStats) recordError() {
+	s.mu.Lock()
+	s.errors++
+	s.mu.Unlock()
+}
+
+func (s *crawlStats) recordRedirect() {
+	s.mu.Lock()
+	s.redirects++
+	s.mu.Unlock()
+}
+
+func (s *crawlStats) summary() StatsSummary {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summary := StatsSummary{
+		Requests:  s.requests,
+		Bytes:     s.bytes,
+		Errors:    s.errors,
+		Redirects: s.redirects,
+	}
+	if s.responses > 0 {
+		avg := s.elapsed / time.Duration(s.responses)
+		summary.AvgResponseTimeMs = float64(avg) / float64(time.Millisecond)
+	}
+	return summary
+}
+
+// Print logs the summary block.
+func (s StatsSummary) Print(logger *log.Logger) {
+	logger.Println("\nCrawl statistics:")
+	logger.Printf("  Requests:          %d\n", s.Requests)
+	logger.Printf("  Bytes downloaded:  %d\n", s.Bytes)
+	logger.Printf("  Avg response time: %.1f ms\n", s.AvgResponseTimeMs)
+	logger.Printf("  Redirects:         %d\n", s.Redirects)
+	logger.Printf("  Errors:            %d\n", s.Errors)
+}
+
+// WriteJSON saves the summary as JSON to the given file.
+func (s StatsSummary) WriteJSON(path string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
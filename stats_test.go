@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestCrawlStats(t *testing.T) {
+	site := map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="/missing">Missing</a> <a href="/old">Old</a>`),
+		"/a": htmlPage("A", `<p>Page A, with a little more text to it.</p>`),
+	}
+	var mu sync.Mutex
+	requests, bytes := 0, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/a", http.StatusMovedPermanently)
+			return
+		}
+		body, ok := site[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		n, _ := w.Write([]byte(body))
+		bytes += n
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.StatsJSON = path
+	Crawl(opts)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got StatsSummary
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	// The redirect is followed within its request, so the server sees one
+	// request more than the crawl makes
+	if got.Requests != 4 || requests != 5 {
+		t.Errorf("stats count %d requests for %d served, want 4 for 5", got.Requests, requests)
+	}
+	if got.Bytes != int64(bytes) {
+		t.Errorf("stats count %d bytes, want the %d served", got.Bytes, bytes)
+	}
+	if got.Errors != 1 {
+		t.Errorf("stats count %d errors, want 1", got.Errors)
+	}
+	if got.Redirects != 1 {
+		t.Errorf("stats count %d redirects, want 1", got.Redirects)
+	}
+	if got.AvgResponseTimeMs <= 0 {
+		t.Errorf("stats report an average response time of %g ms", got.AvgResponseTimeMs)
+	}
+}
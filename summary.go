@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gocolly/colly/v2"
+	"github.com/jung-kurt/gofpdf"
+)
+
+// SummaryExtractor is an Extractor that reads only a container's title,
+// for quick site maps that skip content extraction.
+type SummaryExtractor struct{}
+
+// Extract implements Extractor.
+func (SummaryExtractor) Extract(_ context.Context, e *colly.HTMLElement) (*Page, error) {
+	first := e.DOM.First()
+	return &Page{Title: pageTitle(colly.NewHTMLElementFromSelectionNode(e.Response, first, first.Nodes[0], 0))}, nil
+}
+
+// writeSummaryPDF saves a PDF listing each page's title with its URL.
+func writeSummaryPDF(pages []Page, path string) error {
+	pdf := gofpdf.New("P", "mm", "A4", "")
+	pdf.SetAuthor("PDF Scraper", false)
+	pdf.SetTitle("Site Summary", false)
+	pdf.SetCreator("PDF Scraper", false)
+
+	pdf.AddPage()
+	pdf.SetFont("Arial", "B", 24)
+	pdf.Cell(0, 10, "Site Summary")
+	pdf.Ln(20)
+	for _, page := range pages {
+		pdf.SetFont("Arial", "B", 12)
+		pdf.MultiCell(0, 6, page.Title, "", "", false)
+		pdf.SetFont("Arial", "", 10)
+		pdf.SetTextColor(0, 0, 238)
+		pdf.CellFormat(0, 6, page.URL, "", 1, "", false, 0, page.URL)
+		pdf.SetTextColor(0, 0, 0)
+		pdf.Ln(3)
+	}
+	return pdf.OutputFileAndClose(path)
+}
+
+// writeSummaryMarkdown saves a Markdown list of links to each page.
+func writeSummaryMarkdown(pages []Page, path string, bom bool) error {
+	var b strings.Builder
+	b.WriteString("# Site Summary\n\n")
+	for _, page := range pages {
+		fmt.Fprintf(&b, "- [%s](%s)\n", page.Title, page.URL)
+	}
+
+	f, err := createTextFile(path, bom)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, b.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
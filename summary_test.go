@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSummaryOnly(t *testing.T) {
+	srv := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Welcome text.</p><a href="/b">B</a> <a href="/a">A</a>`),
+		"/a": htmlPage("Alpha", `<p>Alpha body.</p><pre><code>alpha()</code></pre>`),
+		"/b": htmlPage("Bravo", `<p>Bravo body.</p>`),
+	})
+	bodies := []string{"Welcome text.", "Alpha body.", "alpha()", "Bravo body."}
+
+	dir, out, status := runMain(t, "-url", srv.URL+"/", "-summary-only", "-output", "summary.md", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	md, err := os.ReadFile(filepath.Join(dir, "summary.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sorted by URL
+	want := "# Site Summary\n\n- [Home](" + srv.URL + "/)\n- [Alpha](" + srv.URL + "/a)\n- [Bravo](" + srv.URL + "/b)\n"
+	if string(md) != want {
+		t.Errorf("Markdown summary:\n%s\nwant:\n%s", md, want)
+	}
+
+	dir, out, status = runMain(t, "-url", srv.URL+"/", "-summary-only", "-output", "summary.json", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "summary.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pages []Page
+	if err := json.Unmarshal(data, &pages); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 3 || pages[1].Title != "Alpha" || pages[1].URL != srv.URL+"/a" {
+		t.Errorf("JSON summary lists %+v, want the three pages' titles and URLs", pages)
+	}
+	for _, body := range bodies {
+		if strings.Contains(string(md), body) || strings.Contains(string(data), body) {
+			t.Errorf("summary includes the body text %q", body)
+		}
+	}
+
+	dir, out, status = runMain(t, "-url", srv.URL+"/", "-summary-only", "-output", "summary.pdf", "-deterministic")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	text := readPDF(t, filepath.Join(dir, "summary.pdf")).AllText()
+	for _, line := range []string{"Site Summary", "Alpha", srv.URL + "/a", "Bravo", srv.URL + "/b"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("PDF summary lacks %q:\n%s", line, text)
+		}
+	}
+	for _, body := range bodies {
+		if strings.Contains(text, body) {
+			t.Errorf("PDF summary includes the body text %q", body)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// transportOptions configures the HTTP transport shared by page and image requests.
+type transportOptions struct {
+	ClientCert string // PEM client certificate for mutual TLS
+	ClientKey  string // PEM private key for ClientCert
+	CACert     string // PEM CA bundle trusted in addition to the system roots
+	Insecure   bool   // skip server certificate verification
+	// Resolve holds curl-style "host:port:ip" overrides that connect to ip
+	// instead of the DNS address of host, keeping the original Host header.
+	Resolve []string
+	// Proxy is an http(s):// or socks5:// proxy URL, with credentials in
+	// the userinfo. SOCKS5 proxies may be chained by separating their URLs
+	// with commas, the first being connected to directly.
+	Proxy string
+}
+
+// newTransport builds an HTTP transport from the options, starting from
+// the defaults of http.DefaultTransport.
+func newTransport(opts transportOptions) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{}
+
+	if opts.ClientCert != "" || opts.ClientKey != "" {
+		if opts.ClientCert == "" || opts.ClientKey == "" {
+			return nil, fmt.Errorf("-client-cert and -client-key must be used together")
+		}
+		cert, err := tls.LoadX509KeyPair(opts.ClientCert, opts.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.CACert != "" {
+		pem, err := os.ReadFile(opts.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", opts.CACert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	tlsConfig.InsecureSkipVerify = opts.Insecure
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := dialer.DialContext
+	if opts.Proxy != "" {
+		proxyDial, proxyURL, err := parseProxy(opts.Proxy, dialer)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = nil
+		if proxyURL != nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		} else {
+			dial = proxyDial
+			transport.DialContext = dial
+		}
+	}
+
+	if len(opts.Resolve) > 0 {
+		overrides := make(map[string]string)
+		for _, entry := range opts.Resolve {
+			host, port, ip, err := parseResolve(entry)
+			if err != nil {
+				return nil, err
+			}
+			overrides[net.JoinHostPort(host, port)] = net.JoinHostPort(ip, port)
+		}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			if override, ok := overrides[addr]; ok {
+				addr = override
+			}
+			return dial(ctx, network, addr)
+		}
+	}
+
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
+
+// newCrawlClient builds the HTTP client for a crawl's page, robots.txt,
+// sitemap and image requests, applying its TLS, proxy, -concurrent-domains,
+// -host-header and User-Agent options. Requests time out after
+// opts.RequestTimeout. Warnings and the User-Agents picked go to logger.
+func newCrawlClient(opts CrawlOptions, logger *log.Logger) (*http.Client, error) {
+	parsedURL, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL: %w", err)
+	}
+	transport, err := newTransport(opts.Transport)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Transport.Insecure {
+		logger.Println("WARNING: -insecure is set, TLS certificates will not be verified")
+	}
+	var roundTripper http.RoundTripper = transport
+	if opts.ConcurrentDomains > 0 {
+		roundTripper = newHostLimiter(transport, opts.ConcurrentDomains)
+	}
+	if opts.HostHeader != "" {
+		roundTripper = &hostHeader{next: roundTripper, hostname: parsedURL.Hostname(), host: opts.HostHeader}
+	}
+	if opts.UserAgentPerDomain {
+		roundTripper = newDomainAgents(roundTripper, !opts.Deterministic, logger)
+	}
+	return &http.Client{Transport: roundTripper, Timeout: opts.RequestTimeout}, nil
+}
+
+// parseResolve splits a "host:port:ip" override. IPv6 addresses may be
+// given in brackets, e.g. "example.com:443:[::1]".
+func parseResolve(entry string) (host, port, ip string, err error) {
+	parts := strings.SplitN(entry, ":", 3)
+	if len(parts) != 3 {
+		return "", "", "", fmt.Errorf("invalid -resolve %q: expected host:port:ip", entry)
+	}
+	host, port = parts[0], parts[1]
+	ip = strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+	if host == "" || net.ParseIP(ip) == nil {
+		return "", "", "", fmt.Errorf("invalid -resolve %q: expected host:port:ip", entry)
+	}
+	if n, convErr := strconv.Atoi(port); convErr != nil || n < 1 || n > 65535 {
+		return "", "", "", fmt.Errorf("invalid -resolve %q: bad port %q", entry, port)
+	}
+	return host, port, ip, nil
+}
+
+// parseProxy reads a -proxy value. An HTTP proxy is returned as a URL for
+// http.Transport.Proxy; SOCKS5 proxies, which may be chained, are returned
+// as a dial function that tunnels through each in turn.
+func parseProxy(value string, direct *net.Dialer) (dial func(ctx context.Context, network, addr string) (net.Conn, error), httpProxy *url.URL, err error) {
+	var forward proxy.Dialer = direct
+	hops := strings.Split(value, ",")
+	for _, hop := range hops {
+		u, parseErr := url.Parse(strings.TrimSpace(hop))
+		if parseErr != nil || u.Host == "" {
+			return nil, nil, fmt.Errorf("invalid -proxy %q: expected scheme://[user:pass@]host:port", hop)
+		}
+		switch u.Scheme {
+		case "http", "https":
+			if len(hops) > 1 {
+				return nil, nil, fmt.Errorf("invalid -proxy %q: only socks5 proxies can be chained", value)
+			}
+			return nil, u, nil
+		case "socks5", "socks5h":
+			forward, err = proxy.FromURL(u, forward)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid -proxy %q: %w", hop, err)
+			}
+		default:
+			return nil, nil, fmt.Errorf("invalid -proxy %q: unsupported scheme %q", hop, u.Scheme)
+		}
+	}
+	return forward.(proxy.ContextDialer).DialContext, nil, nil
+}
+
+// hostHeader is a RoundTripper that sends requests for one hostname with
+// a different Host header, for virtual hosts reached by IP address or
+// under another name. The URL, and so scope checks and TLS, are unchanged.
+type hostHeader struct {
+	next     http.RoundTripper
+	hostname string // requests to this URL hostname are rewritten
+	host     string // Host header they are sent with
+}
+
+func (h *hostHeader) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.EqualFold(req.URL.Hostname(), h.hostname) {
+		req = req.Clone(req.Context())
+		req.Host = h.host
+	}
+	return h.next.RoundTrip(req)
+}
+
+// hostLimiter is a RoundTripper that lets at most max distinct hosts have
+// requests in flight at once. Further requests to an active host go ahead,
+// leaving per-host parallelism to the collector's limit rules, while
+// requests to other hosts wait for an active host to go idle. Hosts are
+// the crawled ones, -url and -allow-domain, and the ones images come from.
+type hostLimiter struct {
+	next   http.RoundTripper
+	max    int
+	mu     sync.Mutex
+	idle   chan struct{}  // closed, and replaced, whenever a host goes idle
+	active map[string]int // in-flight requests by host
+}
+
+func newHostLimiter(next http.RoundTripper, max int) *hostLimiter {
+	return &hostLimiter{next: next, max: max, idle: make(chan struct{}), active: make(map[string]int)}
+}
+
+// RoundTrip waits for a host slot until the request's context is done,
+// so a stuck host cannot hold up requests past their timeout.
+func (l *hostLimiter) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	l.mu.Lock()
+	for l.active[host] == 0 && len(l.active) >= l.max {
+		idle := l.idle
+		l.mu.Unlock()
+		select {
+		case <-idle:
+		case <-req.Context().Done():
+			if req.Body != nil {
+				req.Body.Close()
+			}
+			return nil, req.Context().Err()
+		}
+		l.mu.Lock()
+	}
+	l.active[host]++
+	l.mu.Unlock()
+
+	resp, err := l.next.RoundTrip(req)
+	if err != nil {
+		l.release(host)
+		return nil, err
+	}
+	// The host stays active until the body has been read and closed
+	resp.Body = &releaseOnClose{ReadCloser: resp.Body, release: func() { l.release(host) }}
+	return resp, nil
+}
+
+func (l *hostLimiter) release(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[host]--; l.active[host] == 0 {
+		delete(l.active, host)
+		close(l.idle)
+		l.idle = make(chan struct{})
+	}
+}
+
+// releaseOnClose calls release once when the body is closed.
+type releaseOnClose struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releaseOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
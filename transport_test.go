@@ -0,0 +1,564 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testCert is a certificate and key written as PEM files for the
+// command-line flags that take them.
+type testCert struct {
+	Cert     *x509.Certificate
+	Key      *ecdsa.PrivateKey
+	TLS      tls.Certificate
+	CertFile string
+	KeyFile  string
+}
+
+// issueCert creates a certificate from template, signed by parent or
+// self-signed when parent is nil.
+func issueCert(t testing.TB, name string, template *x509.Certificate, parent *testCert) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.Subject = pkix.Name{CommonName: name}
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.Cert, parent.Key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	c := &testCert{Cert: cert, Key: key, CertFile: filepath.Join(dir, name+".crt"), KeyFile: filepath.Join(dir, name+".key")}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(c.CertFile, certPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(c.KeyFile, keyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if c.TLS, err = tls.X509KeyPair(certPEM, keyPEM); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestClientCertificate(t *testing.T) {
+	ca := issueCert(t, "ca", &x509.Certificate{IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}, nil)
+	server := issueCert(t, "server", &x509.Certificate{IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)}, ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}, ca)
+	client := issueCert(t, "client", &x509.Certificate{ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}, ca)
+
+	site := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Internal docs.</p><a href="/a">A</a>`),
+		"/a": htmlPage("A", `<p>Page A.</p>`),
+	})
+	srv := httptest.NewUnstartedServer(site.Config.Handler)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{server.TLS}, ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	// Rejected handshakes are expected, so keep them out of the test log
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	opts.Transport = transportOptions{CACert: ca.CertFile}
+	if pages, err := Crawl(opts); len(pages) != 0 || err == nil {
+		t.Errorf("crawl without -client-cert returned %d pages and error %v, want none and an error", len(pages), err)
+	}
+
+	opts.Transport = transportOptions{ClientCert: client.CertFile, ClientKey: client.KeyFile, CACert: ca.CertFile}
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 2 {
+		t.Errorf("crawl with -client-cert returned %d pages, want 2", len(pages))
+	}
+
+	if _, err := newTransport(transportOptions{ClientCert: client.CertFile}); err == nil {
+		t.Error("newTransport accepted -client-cert without -client-key")
+	}
+}
+
+func TestInsecure(t *testing.T) {
+	site := testSite(t, map[string]string{"/": htmlPage("Home", `<p>Self-signed.</p>`)})
+	srv := httptest.NewUnstartedServer(site.Config.Handler)
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	opts := testCrawlOptions(srv.URL + "/")
+	if pages, err := Crawl(opts); len(pages) != 0 || err == nil {
+		t.Errorf("crawl of a self-signed host returned %d pages and error %v, want none and an error", len(pages), err)
+	}
+
+	opts.Transport.Insecure = true
+	pages, logged, err := crawlLogged(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logged, "WARNING: -insecure") {
+		t.Errorf("crawl with -insecure logged %q, want a warning", logged)
+	}
+	if len(pages) != 1 {
+		t.Errorf("crawl with -insecure returned %d pages, want 1", len(pages))
+	}
+}
+
+func TestResolveOverride(t *testing.T) {
+	site := testSite(t, map[string]string{
+		"/":  htmlPage("Home", `<p>Staging.</p><a href="/a">A</a>`),
+		"/a": htmlPage("A", `<p>Page A.</p>`),
+	})
+	var mu sync.Mutex
+	var hosts []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		site.Config.Handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := "docs.staging.invalid:" + port
+	opts := testCrawlOptions("http://" + host + "/")
+	opts.Transport.Resolve = []string{"docs.staging.invalid:" + port + ":127.0.0.1"}
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(pageURLs(pages, "http://"+host), " "); got != "/ /a" {
+		t.Errorf("crawl returned pages %s, want / /a", got)
+	}
+	for _, h := range hosts {
+		if h != host {
+			t.Errorf("request sent with Host %q, want %q", h, host)
+		}
+	}
+
+	for _, entry := range []string{"docs.staging.invalid:443", "docs.staging.invalid:443:not-an-ip"} {
+		if _, err := newTransport(transportOptions{Resolve: []string{entry}}); err == nil {
+			t.Errorf("newTransport accepted -resolve %q", entry)
+		}
+	}
+}
+
+func TestResolveRejectsHTTPProxy(t *testing.T) {
+	for _, proxy := range []string{"http://proxy.invalid:3128", "HTTPS://proxy.invalid:3128"} {
+		_, out, status := runMain(t, "-url", "http://docs.staging.invalid/", "-resolve", "docs.staging.invalid:80:127.0.0.1", "-proxy", proxy)
+		if status == 0 || !strings.Contains(out, "-resolve cannot be combined with an http:// or https:// -proxy") {
+			t.Errorf("-proxy %s: exit status %d:\n%s", proxy, status, out)
+		}
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	var mu sync.Mutex
+	active := make(map[string]int)
+	peak := 0
+	var servers []*httptest.Server
+	for i := 0; i < 3; i++ {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			active[r.Host]++
+			peak = max(peak, len(active))
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			if active[r.Host]--; active[r.Host] == 0 {
+				delete(active, r.Host)
+			}
+			mu.Unlock()
+			w.Write([]byte("ok"))
+		}))
+		t.Cleanup(srv.Close)
+		servers = append(servers, srv)
+	}
+
+	// Two requests per host at once, so each host may still be fetched in parallel
+	client := &http.Client{Transport: newHostLimiter(http.DefaultTransport, 1)}
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		for j := 0; j < 2; j++ {
+			wg.Add(1)
+			go func(u string) {
+				defer wg.Done()
+				resp, err := client.Get(u)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			}(srv.URL)
+		}
+	}
+	wg.Wait()
+	if peak != 1 {
+		t.Errorf("%d hosts were fetched at once, want 1 with -concurrent-domains 1", peak)
+	}
+}
+
+func TestHostLimiterWaitCancelled(t *testing.T) {
+	// The first host holds the only slot until the test ends
+	release := make(chan struct{})
+	stuck := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-release
+	}))
+	t.Cleanup(stuck.Close)
+	t.Cleanup(func() { close(release) })
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	t.Cleanup(other.Close)
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+
+	limiter := newHostLimiter(http.DefaultTransport, 1)
+	resp, err := (&http.Client{Transport: limiter}).Get(stuck.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	client := &http.Client{Transport: limiter, Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if _, err := client.Get(otherURL); err == nil {
+		t.Fatal("request waiting for a host slot succeeded while the only slot was taken")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("request waiting for a host slot gave up after %s, want about its 100ms timeout", elapsed)
+	}
+}
+
+// loopbackServer starts a server for handler listening on ip, a loopback
+// address other than 127.0.0.1, so tests can crawl several distinct hosts.
+func loopbackServer(t testing.TB, ip string, handler http.Handler) *httptest.Server {
+	ln, err := net.Listen("tcp", ip+":0")
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", ip, err)
+	}
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener.Close()
+	srv.Listener = ln
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// TestConcurrentDomainsAcrossCrawledHosts crawls pages on three hosts, the
+// -url host and two -allow-domain ones, with a limit of one host at a time.
+func TestConcurrentDomainsAcrossCrawledHosts(t *testing.T) {
+	var mu sync.Mutex
+	active := make(map[string]int)
+	peak := 0
+	track := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, _, _ := net.SplitHostPort(r.Host)
+			mu.Lock()
+			active[host]++
+			peak = max(peak, len(active))
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			if active[host]--; active[host] == 0 {
+				delete(active, host)
+			}
+			mu.Unlock()
+			next.ServeHTTP(w, r)
+		})
+	}
+	hostPages := func(name string) map[string]string {
+		return map[string]string{
+			"/":  htmlPage(name, `<p>`+name+` home.</p><a href="/1">1</a> <a href="/2">2</a>`),
+			"/1": htmlPage(name+" 1", `<p>`+name+` page 1.</p>`),
+			"/2": htmlPage(name+" 2", `<p>`+name+` page 2.</p>`),
+		}
+	}
+	second := loopbackServer(t, "127.0.0.2", track(siteHandler(hostPages("Second"))))
+	// The third host is the first one's address under another name
+	third := httptest.NewServer(track(siteHandler(hostPages("Third"))))
+	defer third.Close()
+	thirdURL := strings.Replace(third.URL, "127.0.0.1", "localhost", 1)
+	start := hostPages("Start")
+	start["/"] = htmlPage("Start", `<p>Start home.</p><a href="/1">1</a> <a href="/2">2</a> <a href="`+second.URL+`/">Second</a> <a href="`+thirdURL+`/">Third</a>`)
+	first := httptest.NewServer(track(siteHandler(start)))
+	defer first.Close()
+
+	opts := testCrawlOptions(first.URL + "/")
+	opts.Deterministic = false
+	opts.MaxDepth = 3
+	opts.AllowDomains = []string{"127.0.0.2", "localhost"}
+	opts.ConcurrentDomains = 1
+	pages, err := Crawl(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 9 {
+		t.Errorf("crawled %d pages, want all 9 on the three hosts", len(pages))
+	}
+	if peak != 1 {
+		t.Errorf("%d hosts were fetched at once, want 1 with -concurrent-domains 1", peak)
+	}
+}
+
+// socksServer is a minimal SOCKS5 proxy for CONNECT requests. When user
+// is set it requires username/password authentication with those
+// credentials. It counts the connections it tunnels.
+type socksServer struct {
+	ln         net.Listener
+	user, pass string
+	mu         sync.Mutex
+	tunnels    int
+}
+
+func newSOCKSServer(t testing.TB, user, pass string) *socksServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{ln: ln, user: user, pass: pass}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *socksServer) URL(userinfo string) string {
+	if userinfo != "" {
+		userinfo += "@"
+	}
+	return "socks5://" + userinfo + s.ln.Addr().String()
+}
+
+func (s *socksServer) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tunnels
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	buf := make([]byte, 262)
+	// Greeting: version, then the offered methods
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != 5 {
+		return
+	}
+	methods := buf[2 : 2+buf[1]]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	want := byte(0) // no authentication
+	if s.user != "" {
+		want = 2 // username/password
+	}
+	if !slices.Contains(methods, want) {
+		conn.Write([]byte{5, 0xff})
+		return
+	}
+	conn.Write([]byte{5, want})
+	if want == 2 {
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+		if string(user) != s.user || string(pass) != s.pass {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+
+	// Request: version, CONNECT, reserved, then the address
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[1] != 1 {
+		return
+	}
+	var host string
+	switch buf[3] {
+	case 1:
+		ip := make([]byte, 4)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case 3:
+		io.ReadFull(conn, buf[:1])
+		name := make([]byte, buf[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		return
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	target, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1]))))
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer target.Close()
+	s.mu.Lock()
+	s.tunnels++
+	s.mu.Unlock()
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	go io.Copy(target, conn)
+	io.Copy(conn, target)
+}
+
+func TestSOCKS5Proxy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "through the proxy")
+	}))
+	t.Cleanup(srv.Close)
+	authed := newSOCKSServer(t, "alice", "s3cret")
+	open := newSOCKSServer(t, "", "")
+
+	get := func(proxyURL string) error {
+		transport, err := newTransport(transportOptions{Proxy: proxyURL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer transport.CloseIdleConnections()
+		resp, err := (&http.Client{Transport: transport, Timeout: 5 * time.Second}).Get(srv.URL)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != "through the proxy" {
+			t.Errorf("-proxy %s: got body %q", proxyURL, body)
+		}
+		return nil
+	}
+
+	if err := get(authed.URL("alice:s3cret")); err != nil {
+		t.Errorf("authenticated request failed: %v", err)
+	}
+	for _, userinfo := range []string{"", "alice:wrong"} {
+		if err := get(authed.URL(userinfo)); err == nil {
+			t.Errorf("request with credentials %q succeeded", userinfo)
+		}
+	}
+	if n := authed.count(); n != 1 {
+		t.Errorf("authenticated proxy tunnelled %d connections, want 1", n)
+	}
+
+	// A chain connects to the first proxy, which tunnels to the second
+	if err := get(open.URL("") + "," + authed.URL("alice:s3cret")); err != nil {
+		t.Errorf("chained request failed: %v", err)
+	}
+	if first, second := open.count(), authed.count()-1; first != 1 || second != 1 {
+		t.Errorf("chain tunnelled %d and %d connections, want one through each", first, second)
+	}
+
+	for _, value := range []string{"socks5://" + srv.Listener.Addr().String() + ",http://example.com:3128", "ftp://example.com", "socks5://"} {
+		if _, err := newTransport(transportOptions{Proxy: value}); err == nil {
+			t.Errorf("-proxy %q accepted", value)
+		}
+	}
+}
+
+func TestHostHeader(t *testing.T) {
+	var mu sync.Mutex
+	var imageHosts []string
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		imageHosts = append(imageHosts, r.Host)
+		mu.Unlock()
+		imageHandler(8).ServeHTTP(w, r)
+	}))
+	defer images.Close()
+	imageHost := strings.Replace(strings.TrimPrefix(images.URL, "http://"), "127.0.0.1", "localhost", 1)
+	vhosts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Host == "docs.internal" && r.URL.Path == "/":
+			w.Write([]byte(htmlPage("Docs", `<p>The docs virtual host.</p><img src="http://`+imageHost+`/logo.png" alt="Logo"><a href="/guide">Guide</a>`)))
+		case r.Host == "docs.internal" && r.URL.Path == "/guide":
+			w.Write([]byte(htmlPage("Guide", `<p>The docs guide.</p>`)))
+		case r.URL.Path == "/":
+			w.Write([]byte(htmlPage("Default", `<p>The default virtual host.</p>`)))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer vhosts.Close()
+
+	for _, tc := range []struct {
+		host, want string
+	}{
+		{"", "Default"},
+		{"docs.internal", "Docs Guide"},
+	} {
+		opts := testCrawlOptions(vhosts.URL + "/")
+		opts.HostHeader = tc.host
+		pages, err := Crawl(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var titles []string
+		for _, p := range pages {
+			titles = append(titles, p.Title)
+		}
+		if got := strings.Join(titles, " "); got != tc.want {
+			t.Errorf("-host-header %q: crawled %s, want %s", tc.host, got, tc.want)
+		}
+	}
+
+	_, out, status := runMain(t, "-url", vhosts.URL+"/", "-host-header", "docs.internal", "-output", "out.pdf")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	if len(imageHosts) != 1 || imageHosts[0] != imageHost {
+		t.Errorf("image host was sent Host headers %v, want only %s", imageHosts, imageHost)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+)
+
+// userAgents are current desktop browser User-Agent strings, used by
+// -random-user-agent-per-domain.
+var userAgents = []string{
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 14.7; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+	"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/129.0.0.0 Safari/537.36 Edg/129.0.0.0",
+}
+
+// domainAgents is a RoundTripper that sends every request to a host with
+// the same User-Agent, picked from userAgents the first time the host is
+// seen. Hosts get different agents until the list runs out.
+type domainAgents struct {
+	next   http.RoundTripper
+	logger *log.Logger
+	mu     sync.Mutex
+	order  []int // indexes into userAgents, in the order they are handed out
+	byHost map[string]string
+}
+
+// newDomainAgents hands out agents in a random order, or in list order
+// when shuffle is false so runs are reproducible.
+func newDomainAgents(next http.RoundTripper, shuffle bool, logger *log.Logger) *domainAgents {
+	order := rand.Perm(len(userAgents))
+	if !shuffle {
+		for i := range order {
+			order[i] = i
+		}
+	}
+	return &domainAgents{next: next, logger: logger, order: order, byHost: make(map[string]string)}
+}
+
+// forHost returns the User-Agent used for host.
+func (d *domainAgents) forHost(host string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	agent, ok := d.byHost[host]
+	if !ok {
+		agent = userAgents[d.order[len(d.byHost)%len(d.order)]]
+		d.byHost[host] = agent
+		d.logger.Printf("Using User-Agent %q for %s\n", agent, host)
+	}
+	return agent
+}
+
+func (d *domainAgents) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", d.forHost(req.URL.Hostname()))
+	return d.next.RoundTrip(req)
+}
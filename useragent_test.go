@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRandomUserAgentPerDomain(t *testing.T) {
+	var mu sync.Mutex
+	agents := map[string]map[string]bool{} // server -> User-Agents seen
+	record := func(server string, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if agents[server] == nil {
+			agents[server] = map[string]bool{}
+		}
+		agents[server][r.UserAgent()] = true
+	}
+	recordAs := func(server string, next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			record(server, r)
+			next.ServeHTTP(w, r)
+		})
+	}
+	other := httptest.NewServer(recordAs("other", siteHandler(map[string]string{
+		"/":  htmlPage("Other", `<p>The other domain.</p><a href="/b">B</a>`),
+		"/b": htmlPage("Page B", `<p>Page B.</p>`),
+	})))
+	defer other.Close()
+	// The other domain is reached as localhost so the two hosts differ by name
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	site := httptest.NewServer(recordAs("site", siteHandler(map[string]string{
+		"/":  htmlPage("Home", `<p>Start here.</p><a href="/a">A</a> <a href="`+otherURL+`/">Other</a>`),
+		"/a": htmlPage("Page A", `<p>Page A.</p>`),
+	})))
+	defer site.Close()
+
+	dir, out, status := runMain(t, "-url", site.URL+"/", "-allow-domain", "localhost", "-output", "out.json", "-random-user-agent-per-domain")
+	if status != 0 {
+		t.Fatalf("exit status %d:\n%s", status, out)
+	}
+	var pages []Page
+	if err := json.Unmarshal(readOutput(t, filepath.Join(dir, "out.json")), &pages); err != nil {
+		t.Fatal(err)
+	}
+	if len(pages) != 4 {
+		t.Fatalf("crawled %d pages, want 4 across both domains:\n%s", len(pages), out)
+	}
+	var picked []string
+	for _, server := range []string{"site", "other"} {
+		if len(agents[server]) != 1 {
+			t.Fatalf("%s host saw User-Agents %v, want the same one for every request", server, agents[server])
+		}
+		for agent := range agents[server] {
+			if !slices.Contains(userAgents, agent) {
+				t.Errorf("%s host got User-Agent %q, not one from the built-in list", server, agent)
+			}
+			picked = append(picked, agent)
+		}
+	}
+	if picked[0] == picked[1] {
+		t.Errorf("both hosts got User-Agent %q, want one each", picked[0])
+	}
+}